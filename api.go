@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -34,39 +35,149 @@ const (
 // RepoInfo holds metadata about a Hugging Face repository.
 type RepoInfo struct {
 	ID           string
+	SHA          string // The commit the metadata was read at
 	LastModified time.Time
-	Siblings     []HFFile // The list of files/folders in the root directory
+	Tags         []string
+	PipelineTag  string // e.g. "text-generation"; models only
+	LibraryName  string // e.g. "transformers"; models only
+	Gated        string // "" if anyone may download, otherwise the approval mode ("auto" or "manual")
+	Downloads    int    // Downloads over the last 30 days
+	Likes        int
+	License      string         // From the model card, or else a "license:" tag
+	CardData     map[string]any // The model card's YAML front matter, as parsed by the Hub
+	Siblings     []HFFile       // Every file and folder in the repository
 }
 
-// UnmarshalJSON for RepoInfo handles custom parsing.
+// UnmarshalJSON for RepoInfo handles custom parsing. Siblings may be either
+// the API's {"rfilename": ...} entries or full HFFile objects as written by
+// MarshalJSON.
 func (r *RepoInfo) UnmarshalJSON(data []byte) error {
 	type Alias RepoInfo
 	aux := &struct {
-		ID           string    `json:"id"`
-		LastModified time.Time `json:"lastModified"`
-		Siblings     []struct {
-			Rfilename string `json:"rfilename"`
-		} `json:"siblings"`
+		ID           string            `json:"id"`
+		SHA          string            `json:"sha"`
+		LastModified time.Time         `json:"lastModified"`
+		Tags         []string          `json:"tags"`
+		PipelineTag  string            `json:"pipeline_tag"`
+		LibraryName  string            `json:"library_name"`
+		Gated        json.RawMessage   `json:"gated"`
+		Downloads    int               `json:"downloads"`
+		Likes        int               `json:"likes"`
+		License      string            `json:"license"`
+		CardData     map[string]any    `json:"cardData"`
+		Siblings     []json.RawMessage `json:"siblings"`
 	}{}
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return err
 	}
 	r.ID = aux.ID
+	r.SHA = aux.SHA
 	r.LastModified = aux.LastModified
+	r.Tags = aux.Tags
+	r.PipelineTag = aux.PipelineTag
+	r.LibraryName = aux.LibraryName
+	r.Downloads = aux.Downloads
+	r.Likes = aux.Likes
+	r.CardData = aux.CardData
+	// The API sends false for public repositories and the approval mode
+	// for gated ones.
+	r.Gated = ""
+	var gated any
+	if len(aux.Gated) > 0 && json.Unmarshal(aux.Gated, &gated) == nil {
+		switch v := gated.(type) {
+		case string:
+			r.Gated = v
+		case bool:
+			if v {
+				r.Gated = "true"
+			}
+		}
+	}
+	r.License = aux.License
+	if r.License == "" {
+		r.License = findLicense(aux.CardData, aux.Tags)
+	}
 	r.Siblings = make([]HFFile, len(aux.Siblings))
-	for i, s := range aux.Siblings {
-		r.Siblings[i] = HFFile{Path: s.Rfilename, Type: "file"}
+	for i, raw := range aux.Siblings {
+		var s struct {
+			Rfilename string `json:"rfilename"`
+		}
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		if s.Rfilename != "" {
+			r.Siblings[i] = HFFile{Path: s.Rfilename, Type: "file"}
+			continue
+		}
+		if err := json.Unmarshal(raw, &r.Siblings[i]); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// findLicense returns the license named by the model card or, failing
+// that, by a "license:" tag.
+func findLicense(cardData map[string]any, tags []string) string {
+	switch v := cardData["license"].(type) {
+	case string:
+		if v == "other" {
+			if name, ok := cardData["license_name"].(string); ok && name != "" {
+				return name
+			}
+		}
+		return v
+	case []any:
+		var names []string
+		for _, n := range v {
+			if s, ok := n.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	for _, tag := range tags {
+		if license, ok := strings.CutPrefix(tag, "license:"); ok {
+			return license
+		}
+	}
+	return ""
+}
+
+// MarshalJSON for RepoInfo writes the fields UnmarshalJSON reads back.
+func (r *RepoInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           string         `json:"id"`
+		SHA          string         `json:"sha,omitempty"`
+		LastModified time.Time      `json:"lastModified"`
+		Tags         []string       `json:"tags,omitempty"`
+		PipelineTag  string         `json:"pipeline_tag,omitempty"`
+		LibraryName  string         `json:"library_name,omitempty"`
+		Gated        string         `json:"gated,omitempty"`
+		Downloads    int            `json:"downloads,omitempty"`
+		Likes        int            `json:"likes,omitempty"`
+		License      string         `json:"license,omitempty"`
+		CardData     map[string]any `json:"cardData,omitempty"`
+		Siblings     []HFFile       `json:"siblings"`
+	}{r.ID, r.SHA, r.LastModified, r.Tags, r.PipelineTag, r.LibraryName, r.Gated,
+		r.Downloads, r.Likes, r.License, r.CardData, r.Siblings})
+}
+
 // HFFile represents a file or directory node from the Hugging Face API.
 type HFFile struct {
-	Type string `json:"type"`
-	Oid  string `json:"oid"`
-	Size int64  `json:"size"`
-	Path string `json:"path"`
-	LFS  HFLFS  `json:"lfs"`
+	Type       string    `json:"type"`
+	Oid        string    `json:"oid"`
+	Size       int64     `json:"size"`
+	Path       string    `json:"path"`
+	LFS        HFLFS     `json:"lfs,omitzero"`
+	LastCommit *HFCommit `json:"lastCommit,omitempty"` // Only set by ListTree with Expand
+}
+
+// HFCommit is the last commit that touched a file.
+type HFCommit struct {
+	ID    string    `json:"id"`
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
 }
 
 // HFLFS contains LFS metadata for a file.
@@ -93,7 +204,7 @@ func (f *HFFile) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// fetchRepoInfo fetches the main metadata and root file list for a repository.
+// fetchRepoInfo fetches the main metadata and full file list for a repository.
 func (d *Downloader) fetchRepoInfo(ctx context.Context) (*RepoInfo, error) {
 	var urlFormat string
 	if d.isDataset {
@@ -131,20 +242,40 @@ func (d *Downloader) fetchRepoInfo(ctx context.Context) (*RepoInfo, error) {
 		return nil, fmt.Errorf("failed to unmarshal repo info from %s: %w", apiURL, err)
 	}
 	
-	rootTree, err := d.fetchTree(ctx, "")
+	tree, err := d.fetchTree(ctx, "", url.Values{"recursive": {"true"}})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch root tree to complement repo info: %w", err)
+		return nil, fmt.Errorf("failed to fetch file tree to complement repo info: %w", err)
 	}
-	info.Siblings = rootTree
+	info.Siblings = tree
 	return &info, nil
 }
 
-// fetchTree calls the Hugging Face API to get the file list for a directory.
-func (d *Downloader) fetchTree(ctx context.Context, folderPath string) ([]HFFile, error) {
+// fetchTree calls the Hugging Face API to list a directory, following the
+// API's pagination. query is sent with the first request, e.g.
+// recursive=true to list everything under the directory.
+func (d *Downloader) fetchTree(ctx context.Context, folderPath string, query url.Values) ([]HFFile, error) {
+	var files []HFFile
 	apiURL := d.buildTreeURL(folderPath)
+	if len(query) > 0 {
+		apiURL += "?" + query.Encode()
+	}
+	for apiURL != "" {
+		page, next, err := d.fetchTreePage(ctx, apiURL)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+		apiURL = next
+	}
+	return files, nil
+}
+
+// fetchTreePage fetches one page of a tree listing and returns the URL of
+// the next page, if any.
+func (d *Downloader) fetchTreePage(ctx context.Context, apiURL string) ([]HFFile, string, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create tree request for %s: %w", apiURL, err)
+		return nil, "", fmt.Errorf("failed to create tree request for %s: %w", apiURL, err)
 	}
 	if d.authToken != "" {
 		req.Header.Add("Authorization", "Bearer "+d.authToken)
@@ -152,24 +283,44 @@ func (d *Downloader) fetchTree(ctx context.Context, folderPath string) ([]HFFile
 
 	resp, err := d.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request failed for %s: %w", apiURL, err)
+		return nil, "", fmt.Errorf("http request failed for %s: %w", apiURL, err)
 	}
 	defer resp.Body.Close()
 
 	if err := handleAPIError(resp, apiURL); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body from %s: %w", apiURL, err)
+		return nil, "", fmt.Errorf("failed to read response body from %s: %w", apiURL, err)
 	}
 
 	var files []HFFile
 	if err := json.Unmarshal(body, &files); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON from %s: %w", apiURL, err)
+		return nil, "", fmt.Errorf("failed to unmarshal JSON from %s: %w", apiURL, err)
 	}
-	return files, nil
+	return files, nextPageURL(resp), nil
+}
+
+// nextPageURL returns the rel="next" target of the response's Link header,
+// resolved against the request URL, or "" on the last page.
+func nextPageURL(resp *http.Response) string {
+	for _, link := range resp.Header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+			if !ok || !strings.Contains(params, `rel="next"`) {
+				continue
+			}
+			target = strings.Trim(strings.TrimSpace(target), "<>")
+			next, err := resp.Request.URL.Parse(target)
+			if err != nil {
+				return ""
+			}
+			return next.String()
+		}
+	}
+	return ""
 }
 
 // resolveDownloadURL gets the final, redirect S3/Cloudfront URL for a file.
@@ -216,10 +367,26 @@ func handleAPIError(resp *http.Response, url string) error {
 	case http.StatusNotFound:
 		return ErrNotFound
 	default:
-		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+		return &StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 }
 
+// StatusError is an HTTP status the Hub or a CDN returned that has no more
+// specific error.
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.StatusCode, e.URL)
+}
+
+// Temporary reports whether the status may clear up if the request is
+// retried later: 408, 429 and any 5xx.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
 
 func (d *Downloader) buildTreeURL(folderPath string) string {
 	var urlFormat string
@@ -231,7 +398,7 @@ func (d *Downloader) buildTreeURL(folderPath string) string {
 	baseAPIPath := fmt.Sprintf(urlFormat, d.repoName, url.QueryEscape(d.branch))
 	fullURL := baseURL + baseAPIPath
 	if folderPath != "" {
-		fullURL = fullURL + "/" + url.PathEscape(folderPath)
+		fullURL = fullURL + "/" + (&url.URL{Path: folderPath}).EscapedPath()
 	}
 	return fullURL
 }
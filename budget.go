@@ -0,0 +1,131 @@
+package hfget
+
+import (
+	"fmt"
+	pathpkg "path"
+	"sort"
+	"strings"
+)
+
+// BudgetPriority decides which files a download budget keeps when the
+// planned downloads do not all fit.
+type BudgetPriority int
+
+const (
+	// BudgetSmallestFirst fits as many files as possible by taking the
+	// smallest first.
+	BudgetSmallestFirst BudgetPriority = iota
+	// BudgetLargestFirst takes the largest file that fits, then fills the
+	// remaining budget with smaller files. Combined with an include pattern
+	// this picks e.g. the largest quantization that fits; the parts of a
+	// split file count as one file.
+	BudgetLargestFirst
+	// BudgetRepoOrder takes files in the order the repository lists them.
+	BudgetRepoOrder
+)
+
+var budgetPriorityNames = map[BudgetPriority]string{
+	BudgetSmallestFirst: "smallest",
+	BudgetLargestFirst:  "largest",
+	BudgetRepoOrder:     "order",
+}
+
+func (p BudgetPriority) String() string {
+	if name, ok := budgetPriorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("BudgetPriority(%d)", int(p))
+}
+
+// ParseBudgetPriority converts "smallest", "largest" or "order" into a BudgetPriority.
+func ParseBudgetPriority(s string) (BudgetPriority, error) {
+	for p, name := range budgetPriorityNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown budget priority %q: want smallest, largest or order", s)
+}
+
+// outsideSizeLimits reports whether file falls outside the configured
+// minimum and maximum file sizes.
+func (d *Downloader) outsideSizeLimits(file HFFile) bool {
+	if d.minFileSize > 0 && file.Size < d.minFileSize {
+		return true
+	}
+	return d.maxFileSize > 0 && file.Size > d.maxFileSize
+}
+
+// splitSetKey returns a key shared by the parts of a split file, such as a
+// split GGUF quantization or model-00001-of-00004.safetensors, and false
+// for files that are not split. Split GGUF and sharded safetensors or
+// PyTorch checkpoints use the same part suffix.
+func splitSetKey(path string) (string, bool) {
+	ext := pathpkg.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	m := ggufSplitPattern.FindStringSubmatch(stem)
+	if m == nil || m[2] == "00001" {
+		return "", false
+	}
+	return stem[:len(stem)-len(m[0])] + "-of-" + m[2] + ext, true
+}
+
+// budgetUnit is a file, or every part of a split file, that the budget
+// keeps or leaves out as a whole.
+type budgetUnit struct {
+	files []int // Indexes into plan.FilesToDownload
+	size  int64
+}
+
+// applyBudget trims plan.FilesToDownload to fit d.budget, moving the files
+// left out to plan.FilesFiltered with ReasonOverBudget. Files already
+// present locally do not count against the budget. The parts of a split
+// file are kept or left out together, since some parts alone are useless.
+func (d *Downloader) applyBudget(plan *DownloadPlan) {
+	if d.budget <= 0 {
+		return
+	}
+	var units []*budgetUnit
+	sets := make(map[string]*budgetUnit)
+	for i, f := range plan.FilesToDownload {
+		key, split := splitSetKey(f.File.Path)
+		u := sets[key]
+		if !split || u == nil {
+			u = &budgetUnit{}
+			units = append(units, u)
+			if split {
+				sets[key] = u
+			}
+		}
+		u.files = append(u.files, i)
+		u.size += f.File.Size
+	}
+	switch d.budgetPriority {
+	case BudgetSmallestFirst:
+		sort.SliceStable(units, func(a, b int) bool { return units[a].size < units[b].size })
+	case BudgetLargestFirst:
+		sort.SliceStable(units, func(a, b int) bool { return units[a].size > units[b].size })
+	}
+
+	keep := make([]bool, len(plan.FilesToDownload))
+	remaining := d.budget
+	for _, u := range units {
+		if u.size <= remaining {
+			for _, i := range u.files {
+				keep[i] = true
+			}
+			remaining -= u.size
+		}
+	}
+
+	var kept []FileDownload
+	for i, f := range plan.FilesToDownload {
+		if keep[i] {
+			kept = append(kept, f)
+			continue
+		}
+		d.logger.Printf("Leaving out %s (%s): over the download budget of %s", f.File.Path, formatBytes(f.File.Size), formatBytes(d.budget))
+		plan.FilesFiltered = append(plan.FilesFiltered, FileSkip{File: f.File, Reason: ReasonOverBudget})
+	}
+	plan.FilesToDownload = kept
+}
@@ -0,0 +1,335 @@
+package hfget
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheLayout is how a repository is stored under a destination directory.
+type CacheLayout int
+
+const (
+	// LayoutFlat is hfget's default "org_model" directory.
+	LayoutFlat CacheLayout = iota
+	// LayoutTree is hfget's "org/model" directory; see WithTreeStructure.
+	LayoutTree
+	// LayoutHub is the huggingface_hub cache: "models--org--model" with
+	// blobs, snapshots and refs.
+	LayoutHub
+)
+
+var cacheLayoutNames = map[CacheLayout]string{
+	LayoutFlat: "flat",
+	LayoutTree: "tree",
+	LayoutHub:  "hub",
+}
+
+func (l CacheLayout) String() string {
+	if name, ok := cacheLayoutNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("CacheLayout(%d)", int(l))
+}
+
+// MarshalText encodes the layout by name.
+func (l CacheLayout) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a layout name written by MarshalText.
+func (l *CacheLayout) UnmarshalText(text []byte) error {
+	for layout, name := range cacheLayoutNames {
+		if string(text) == name {
+			*l = layout
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown cache layout %q", text)
+}
+
+// hubRepoPrefixes maps the directory prefixes of the huggingface_hub cache
+// to whether they hold datasets. Spaces are not downloaded by hfget.
+var hubRepoPrefixes = map[string]bool{"models--": false, "datasets--": true}
+
+// CachedRepo is a repository found on disk by ScanCache.
+type CachedRepo struct {
+	Repo      string      `json:"repo"`                // e.g. "org/model"
+	IsDataset bool        `json:"isDataset,omitempty"` // Only known for LayoutHub
+	Layout    CacheLayout `json:"layout"`
+	Path      string      `json:"path"`
+	Revision  string      `json:"revision,omitempty"` // Branch or tag, or the refs of a hub snapshot
+	Commit    string      `json:"commit,omitempty"`
+	Size      int64       `json:"size"`  // Bytes on disk, including hfget's bookkeeping
+	Files     int         `json:"files"` // Repository files, excluding bookkeeping
+	LastSync  time.Time   `json:"lastSync"`
+}
+
+// ScanCache finds the repositories stored under the destination directory:
+// hfget downloads in the flat or tree layout, recognised by their .hfget
+// directory, and huggingface_hub cache entries. They are sorted by Repo.
+func (d *Downloader) ScanCache(ctx context.Context) ([]CachedRepo, error) {
+	root := d.destinationBasePath
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var repos []CachedRepo
+	add := func(repo *CachedRepo, err error) error {
+		if err != nil {
+			return err
+		}
+		if repo != nil {
+			repos = append(repos, *repo)
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(root, entry.Name())
+		if repo, isDataset, ok := hubRepoName(entry.Name()); ok {
+			if err := add(scanHubRepo(path, repo, isDataset)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if isHFGetRepo(path) {
+			if err := add(scanHFGetRepo(path, entry.Name(), LayoutFlat)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// An organisation directory of the tree layout.
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			childPath := filepath.Join(path, child.Name())
+			if child.IsDir() && isHFGetRepo(childPath) {
+				if err := add(scanHFGetRepo(childPath, entry.Name()+"/"+child.Name(), LayoutTree)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Repo < repos[j].Repo })
+	return repos, nil
+}
+
+// hubRepoName returns the repository ID of a huggingface_hub cache
+// directory name such as "models--org--model".
+func hubRepoName(name string) (repo string, isDataset, ok bool) {
+	for prefix, isDataset := range hubRepoPrefixes {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && rest != "" {
+			return strings.ReplaceAll(rest, "--", "/"), isDataset, true
+		}
+	}
+	return "", false, false
+}
+
+func isHFGetRepo(path string) bool {
+	info, err := os.Stat(filepath.Join(path, metaDirName))
+	return err == nil && info.IsDir()
+}
+
+// scanHFGetRepo describes a directory written by hfget. name is its path
+// relative to the destination, used when the sync state does not record the
+// repository ID.
+func scanHFGetRepo(path, name string, layout CacheLayout) (*CachedRepo, error) {
+	state := loadSyncState(path)
+	repo := &CachedRepo{
+		Repo:     state.Repo,
+		Layout:   layout,
+		Path:     path,
+		Revision: state.Revision,
+		Commit:   state.Commit,
+		LastSync: state.LastSync,
+	}
+	if repo.Repo == "" {
+		repo.Repo = name
+	}
+	var newest time.Time
+	err := filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		repo.Size += info.Size()
+		rel, _ := filepath.Rel(path, p)
+		top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if top != metaDirName && top != stagingDirName {
+			repo.Files++
+			if info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	// Downloads interrupted before any state was saved still have files.
+	if repo.LastSync.IsZero() {
+		repo.LastSync = newest
+	}
+	return repo, nil
+}
+
+// scanHubRepo describes a huggingface_hub cache entry. Its size is that of
+// the blobs; its files are those of the snapshot "main" points to, or else
+// the most recent snapshot.
+func scanHubRepo(path, repoID string, isDataset bool) (*CachedRepo, error) {
+	repo := &CachedRepo{
+		Repo:      repoID,
+		IsDataset: isDataset,
+		Layout:    LayoutHub,
+		Path:      path,
+	}
+	refs := make(map[string][]string) // commit -> ref names
+	refsDir := filepath.Join(path, "refs")
+	_ = filepath.WalkDir(refsDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil
+		}
+		name, _ := filepath.Rel(refsDir, p)
+		commit := strings.TrimSpace(string(data))
+		refs[commit] = append(refs[commit], filepath.ToSlash(name))
+		if info, err := entry.Info(); err == nil && info.ModTime().After(repo.LastSync) {
+			repo.LastSync = info.ModTime()
+		}
+		return nil
+	})
+
+	snapshots, _ := os.ReadDir(filepath.Join(path, "snapshots"))
+	var newest time.Time
+	var onMain bool
+	for _, s := range snapshots {
+		info, err := s.Info()
+		if err != nil || !s.IsDir() {
+			continue
+		}
+		switch {
+		case slices.Contains(refs[s.Name()], "main"):
+			repo.Commit, newest, onMain = s.Name(), info.ModTime(), true
+		case !onMain && info.ModTime().After(newest):
+			repo.Commit, newest = s.Name(), info.ModTime()
+		}
+	}
+	if names := refs[repo.Commit]; len(names) > 0 {
+		sort.Strings(names)
+		repo.Revision = strings.Join(names, ",")
+	}
+	if repo.LastSync.IsZero() {
+		repo.LastSync = newest
+	}
+
+	err := filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(path, p)
+		rel = filepath.ToSlash(rel)
+		if repo.Commit != "" && strings.HasPrefix(rel, "snapshots/"+repo.Commit+"/") {
+			repo.Files++
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			repo.Size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", path, err)
+	}
+	return repo, nil
+}
+
+// RemoveCached deletes a repository found by ScanCache. For hfget's own
+// layouts the directory lock is checked first, so a repository that is
+// being downloaded is not removed; an emptied tree-layout organisation
+// directory is removed too.
+func (d *Downloader) RemoveCached(ctx context.Context, repo CachedRepo) error {
+	if repo.Layout != LayoutHub {
+		lock, err := d.acquireLock(ctx, repo.Path)
+		if err != nil {
+			return err
+		}
+		if canRemoveOpenFiles {
+			// Hold the lock until the directory is gone, so that a download
+			// cannot start in it halfway through the removal.
+			defer lock.release()
+		} else {
+			lock.release()
+		}
+	}
+	d.logger.Printf("Removing %s", repo.Path)
+	if err := os.RemoveAll(repo.Path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", repo.Path, err)
+	}
+	if repo.Layout == LayoutTree {
+		_ = os.Remove(filepath.Dir(repo.Path))
+	}
+	return nil
+}
+
+// PruneOptions selects repositories for SelectPrune. Zero fields are not
+// applied.
+type PruneOptions struct {
+	OlderThan time.Duration // Last synced longer ago than this
+	MaxSize   int64         // Remove the least recently synced until the rest fit
+	Now       time.Time     // Defaults to time.Now()
+}
+
+// SelectPrune returns the repositories to remove under opts, least recently
+// synced first.
+func SelectPrune(repos []CachedRepo, opts PruneOptions) []CachedRepo {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	byAge := make([]CachedRepo, len(repos))
+	copy(byAge, repos)
+	sort.SliceStable(byAge, func(i, j int) bool { return byAge[i].LastSync.Before(byAge[j].LastSync) })
+
+	var total int64
+	for _, r := range byAge {
+		total += r.Size
+	}
+	var selected []CachedRepo
+	for _, r := range byAge {
+		old := opts.OlderThan > 0 && opts.Now.Sub(r.LastSync) > opts.OlderThan
+		over := opts.MaxSize > 0 && total > opts.MaxSize
+		if old || over {
+			selected = append(selected, r)
+			total -= r.Size
+		}
+	}
+	return selected
+}
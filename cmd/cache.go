@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// cacheCommands are the subcommands of "hfget cache".
+var cacheCommands = []commandInfo{
+	{"cache list", "[options]", "List the repositories under the destination with revision, files, size and last sync",
+		"hfget cache list -d ./models"},
+	{"cache du", "[options]", "Show the disk usage of each repository, largest first",
+		"hfget cache du --hub"},
+	{"cache rm", "[options] repo...", "Delete repositories from the destination",
+		"hfget cache rm -d ./models TheBloke/Llama-2-7B-GGUF"},
+	{"cache prune", "[options]", "Delete repositories not synced recently, or the least recently synced until the rest fit a size",
+		"hfget cache prune --older-than 30d --max-size 500GB --dry-run"},
+}
+
+// cacheConfig holds the flags shared by the cache subcommands.
+type cacheConfig struct {
+	globalConfig
+	dest string
+	hub  bool
+}
+
+// register adds the global and cache flags to fs.
+func (cfg *cacheConfig) register(fs *flag.FlagSet) {
+	cfg.globalConfig.register(fs)
+	fs.StringVar(&cfg.dest, "d", envOrDefault("HFGET_DEST", "./"), "Directory holding the repositories ($HFGET_DEST)")
+	fs.BoolVar(&cfg.hub, "hub", false, "Use the huggingface_hub cache ($HF_HUB_CACHE, or $HF_HOME/hub) instead of -d")
+}
+
+// root returns the directory the cache commands work on.
+func (cfg *cacheConfig) root() string {
+	if !cfg.hub {
+		return cfg.dest
+	}
+	if dir := os.Getenv("HF_HUB_CACHE"); dir != "" {
+		return dir
+	}
+	if home := os.Getenv("HF_HOME"); home != "" {
+		return filepath.Join(home, "hub")
+	}
+	// huggingface_hub uses ~/.cache on every platform, not os.UserCacheDir.
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "huggingface", "hub")
+}
+
+func (cfg *cacheConfig) downloader(app *cliApp) downloader {
+	opts := []hfg.Option{hfg.WithDestination(cfg.root())}
+	if cfg.verbose {
+		opts = append(opts, hfg.WithVerboseOutput(app.err))
+	}
+	return app.newDownloader("", opts...)
+}
+
+// runCache implements "hfget cache": dispatch to a subcommand.
+func (app *cliApp) runCache(ctx context.Context, g globalConfig, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		app.cacheUsage()
+		if len(args) == 0 {
+			return usageErrorf("a cache subcommand is required")
+		}
+		return nil
+	}
+	cfg := cacheConfig{globalConfig: g}
+	switch args[0] {
+	case "list":
+		return app.runCacheList(ctx, &cfg, args[1:])
+	case "du":
+		return app.runCacheDu(ctx, &cfg, args[1:])
+	case "rm":
+		return app.runCacheRm(ctx, &cfg, args[1:])
+	case "prune":
+		return app.runCachePrune(ctx, &cfg, args[1:])
+	}
+	app.cacheUsage()
+	return usageErrorf("unknown cache subcommand %q", args[0])
+}
+
+func (app *cliApp) cacheUsage() {
+	fmt.Fprintf(app.err, "Usage: %s cache <subcommand> [options]\n\nSubcommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(app.err, 0, 0, 2, ' ', 0)
+	for _, c := range cacheCommands {
+		fmt.Fprintf(w, "  %s\t%s\n", strings.TrimPrefix(c.name, "cache "), c.summary)
+	}
+	w.Flush()
+	fmt.Fprintf(app.err, "\nRun '%s help cache <subcommand>' for its options.\n", os.Args[0])
+}
+
+func (app *cliApp) runCacheList(ctx context.Context, cfg *cacheConfig, args []string) error {
+	var asJSON bool
+	fs := app.newFlagSet("cache list")
+	cfg.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "Write the repositories as JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	repos, err := cfg.downloader(app).ScanCache(ctx)
+	if err != nil {
+		return fmt.Errorf("could not scan %s: %w", cfg.root(), err)
+	}
+	if asJSON {
+		return app.writeCachedRepos(repos)
+	}
+	if len(repos) == 0 {
+		fmt.Fprintf(app.err, "No repositories found in %s.\n", cfg.root())
+		return nil
+	}
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tLAYOUT\tREVISION\tCOMMIT\tFILES\tSIZE\tLAST SYNC")
+	for _, r := range repos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", r.Repo, r.Layout, orDash(r.Revision), orDash(shortOid(r.Commit)),
+			r.Files, formatBytes(r.Size), formatSyncTime(r.LastSync))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "%d repositories, %s\n", len(repos), formatBytes(totalCachedSize(repos)))
+	return nil
+}
+
+func (app *cliApp) runCacheDu(ctx context.Context, cfg *cacheConfig, args []string) error {
+	var asJSON bool
+	fs := app.newFlagSet("cache du")
+	cfg.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "Write the repositories as JSON to stdout, largest first")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	repos, err := cfg.downloader(app).ScanCache(ctx)
+	if err != nil {
+		return fmt.Errorf("could not scan %s: %w", cfg.root(), err)
+	}
+	sort.SliceStable(repos, func(i, j int) bool { return repos[i].Size > repos[j].Size })
+	if asJSON {
+		return app.writeCachedRepos(repos)
+	}
+	total := totalCachedSize(repos)
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, r := range repos {
+		share := 0.0
+		if total > 0 {
+			share = float64(r.Size) * 100 / float64(total)
+		}
+		fmt.Fprintf(w, "%s\t%.1f%%\t\t%s\n", formatBytes(r.Size), share, r.Repo)
+	}
+	fmt.Fprintf(w, "%s\t\t\t%s\n", formatBytes(total), "total")
+	return w.Flush()
+}
+
+func (app *cliApp) runCacheRm(ctx context.Context, cfg *cacheConfig, args []string) error {
+	var dryRun, force bool
+	fs := app.newFlagSet("cache rm")
+	cfg.register(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting it")
+	fs.BoolVar(&force, "f", false, "Do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("at least one repository argument is required")
+	}
+	d := cfg.downloader(app)
+	repos, err := d.ScanCache(ctx)
+	if err != nil {
+		return fmt.Errorf("could not scan %s: %w", cfg.root(), err)
+	}
+	var selected []hfg.CachedRepo
+	for _, name := range fs.Args() {
+		matches := matchCachedRepos(repos, cfg.root(), name)
+		if len(matches) == 0 {
+			return fmt.Errorf("%s is not in %s", name, cfg.root())
+		}
+		selected = append(selected, matches...)
+	}
+	return app.removeCachedRepos(ctx, d, selected, dryRun, force)
+}
+
+func (app *cliApp) runCachePrune(ctx context.Context, cfg *cacheConfig, args []string) error {
+	var (
+		olderThan, maxSize string
+		dryRun, force      bool
+	)
+	fs := app.newFlagSet("cache prune")
+	cfg.register(fs)
+	fs.StringVar(&olderThan, "older-than", "", "Delete repositories last synced longer ago than this (e.g. '30d', '2w', '12h')")
+	fs.StringVar(&maxSize, "max-size", "", "Delete the least recently synced repositories until the rest fit in this size (e.g. '500GB')")
+	fs.BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting it")
+	fs.BoolVar(&force, "f", false, "Do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if olderThan == "" && maxSize == "" {
+		return usageErrorf("nothing to prune: use --older-than and/or --max-size")
+	}
+	var opts hfg.PruneOptions
+	if olderThan != "" {
+		age, err := parseAge(olderThan)
+		if err != nil {
+			return usageErrorf("invalid --older-than: %w", err)
+		}
+		opts.OlderThan = age
+	}
+	if maxSize != "" {
+		size, err := parseSize(maxSize)
+		if err != nil {
+			return usageErrorf("invalid --max-size: %w", err)
+		}
+		opts.MaxSize = size
+	}
+	d := cfg.downloader(app)
+	repos, err := d.ScanCache(ctx)
+	if err != nil {
+		return fmt.Errorf("could not scan %s: %w", cfg.root(), err)
+	}
+	selected := hfg.SelectPrune(repos, opts)
+	if len(selected) == 0 {
+		fmt.Fprintln(app.err, "Nothing to prune.")
+		return nil
+	}
+	return app.removeCachedRepos(ctx, d, selected, dryRun, force)
+}
+
+// matchCachedRepos returns the repositories whose ID or path relative to
+// root is name.
+func matchCachedRepos(repos []hfg.CachedRepo, root, name string) []hfg.CachedRepo {
+	var matches []hfg.CachedRepo
+	for _, r := range repos {
+		rel, _ := filepath.Rel(root, r.Path)
+		if r.Repo == name || filepath.ToSlash(rel) == strings.TrimSuffix(name, "/") {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// removeCachedRepos lists repos and deletes them unless dryRun is set,
+// asking first on a terminal unless force is set.
+func (app *cliApp) removeCachedRepos(ctx context.Context, d downloader, repos []hfg.CachedRepo, dryRun, force bool) error {
+	verb := "Deleting"
+	if dryRun {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(app.out, "%s %d repositories (%s):\n", verb, len(repos), formatBytes(totalCachedSize(repos)))
+	for _, r := range repos {
+		fmt.Fprintf(app.out, "  - %s (%s, last sync %s): %s\n", r.Repo, formatBytes(r.Size), formatSyncTime(r.LastSync), r.Path)
+	}
+	if dryRun {
+		return nil
+	}
+	if !force && app.isTerminal {
+		yes, err := app.prompt(ctx, bufio.NewReader(os.Stdin), "Proceed? [y/N]: ")
+		if err != nil {
+			return err
+		}
+		if !yes {
+			fmt.Fprintln(app.err, "Cancelled.")
+			return nil
+		}
+	}
+	var errs []error
+	for _, r := range repos {
+		if err := d.RemoveCached(ctx, r); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.Repo, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("some repositories could not be deleted:\n%w", err)
+	}
+	return nil
+}
+
+func (app *cliApp) writeCachedRepos(repos []hfg.CachedRepo) error {
+	if repos == nil {
+		repos = []hfg.CachedRepo{}
+	}
+	enc := json.NewEncoder(app.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(repos)
+}
+
+func totalCachedSize(repos []hfg.CachedRepo) int64 {
+	var total int64
+	for _, r := range repos {
+		total += r.Size
+	}
+	return total
+}
+
+// formatSyncTime shows when a repository was last synced, or "-".
+func formatSyncTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// downloadConfig holds the flags shared by every command that builds or
+// executes a download plan.
+type downloadConfig struct {
+	repoConfig
+	filterConfig
+	destConfig
+	numConnections  int
+	skipChecksum    bool
+	maxRetries      int
+	retryInterval   time.Duration
+	force           bool
+	minSize         string
+	maxSize         string
+	budget          string
+	budgetPriority  string
+	quant           string
+	mmproj          bool
+	preferFormat    string
+	scanPickles     string
+	limitRate       string
+	limitRateConn   string
+	limitSchedule   string
+	ignoreDiskSpace bool
+	lockMode        string
+	prune           bool
+	onConflict      string
+	conflictPolicy  hfg.ConflictPolicy // Parsed from onConflict by options
+	progressMode    string
+	progressFD      int
+	events          *eventWriter // Set by setupProgress for --progress=json
+}
+
+// register adds the download flags to fs.
+func (cfg *downloadConfig) register(fs *flag.FlagSet) {
+	cfg.repoConfig.register(fs)
+	cfg.filterConfig.register(fs)
+	cfg.destConfig.register(fs)
+	defaultConnections, _ := strconv.Atoi(envOrDefault("HFGET_CONCURRENT_CONNECTIONS", "5"))
+	fs.IntVar(&cfg.numConnections, "c", defaultConnections, "Number of concurrent connections ($HFGET_CONCURRENT_CONNECTIONS)")
+	defaultSkipChecksum, _ := strconv.ParseBool(envOrDefault("HFGET_SKIP_CHECKSUM", "false"))
+	fs.BoolVar(&cfg.skipChecksum, "skip-checksum", defaultSkipChecksum, "Skip SHA256 checksum verification ($HFGET_SKIP_CHECKSUM)")
+	fs.IntVar(&cfg.maxRetries, "max-retries", 3, "Maximum number of retries")
+	fs.DurationVar(&cfg.retryInterval, "retry-interval", 5*time.Second, "Interval between retries")
+	fs.BoolVar(&cfg.force, "f", false, "Force re-download of all files, implies quiet mode")
+	fs.StringVar(&cfg.minSize, "min-size", "", "Skip files smaller than this size, e.g. 1M")
+	fs.StringVar(&cfg.maxSize, "max-size", "", "Skip files larger than this size, e.g. 100M")
+	fs.StringVar(&cfg.budget, "budget", "", "Download at most this much in total, e.g. 24G")
+	fs.StringVar(&cfg.budgetPriority, "budget-priority", "smallest", "Which files --budget keeps: 'smallest' (as many files as fit), 'largest' (largest that fits first) or 'order' (repository order)")
+	fs.StringVar(&cfg.quant, "quant", "", "Download one quantization of a GGUF repo (e.g. Q4_K_M) with all its parts and small companion files; 'list' shows what is available")
+	fs.BoolVar(&cfg.mmproj, "mmproj", false, "With --quant, also download a multimodal projector (mmproj) file")
+	fs.StringVar(&cfg.preferFormat, "prefer-format", envOrDefault("HFGET_PREFER_FORMAT", "safetensors"), "Where weights come in several formats, download only the first available of this comma-separated list (e.g. 'safetensors,onnx'), or 'all' to download every format ($HFGET_PREFER_FORMAT)")
+	fs.StringVar(&cfg.scanPickles, "scan-pickles", envOrDefault("HFGET_SCAN_PICKLES", "warn"), "Scan .bin/.pt/.pkl/.ckpt pickle files for code execution: 'off', 'warn', or 'refuse' to quarantine unsafe files ($HFGET_SCAN_PICKLES)")
+	fs.BoolVar(&cfg.ignoreDiskSpace, "ignore-disk-space", false, "Start downloading even if the destination appears to lack free space")
+	fs.StringVar(&cfg.lockMode, "lock", envOrDefault("HFGET_LOCK", "fail"), "When another hfget holds the destination: 'fail', 'wait', or a timeout such as '10m' ($HFGET_LOCK)")
+	fs.BoolVar(&cfg.prune, "prune", false, "Delete local files that are no longer in the repository (within --include/--exclude)")
+	fs.StringVar(&cfg.onConflict, "on-conflict", envOrDefault("HFGET_ON_CONFLICT", "backup"), "What to do with files edited locally since the last sync: overwrite, keep, backup (to .orig) or fail ($HFGET_ON_CONFLICT)")
+	fs.StringVar(&cfg.limitRate, "limit-rate", envOrDefault("HFGET_LIMIT_RATE", ""), "Cap total download speed, e.g. 50M or 512K per second ($HFGET_LIMIT_RATE)")
+	fs.StringVar(&cfg.limitRateConn, "limit-rate-per-conn", "", "Cap the speed of each connection, e.g. 10M")
+	fs.StringVar(&cfg.limitSchedule, "limit-schedule", envOrDefault("HFGET_LIMIT_SCHEDULE", ""), "Time-of-day rate overrides, e.g. \"00:00-07:00=0,09:00-18:00=20M\" (0 = unlimited) ($HFGET_LIMIT_SCHEDULE)")
+}
+
+// registerProgress adds the flags that choose how a download reports
+// progress; only commands that execute a plan have them.
+func (cfg *downloadConfig) registerProgress(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.progressMode, "progress", envOrDefault("HFGET_PROGRESS", "auto"), "Progress output: 'auto' (bars and prompts on a terminal), 'none', or 'json' for JSON-lines events without prompts ($HFGET_PROGRESS)")
+	fs.IntVar(&cfg.progressFD, "progress-fd", 1, "With --progress=json, write events to this file descriptor instead of stdout")
+}
+
+// setupProgress applies --progress: 'none' and 'json' imply quiet mode, and
+// 'json' opens the event stream.
+func (app *cliApp) setupProgress(cfg *downloadConfig) error {
+	switch cfg.progressMode {
+	case "auto", "":
+		return nil
+	case "none":
+		cfg.quiet = true
+		return nil
+	case "json":
+	default:
+		return usageErrorf("invalid --progress value %q: want 'auto', 'none' or 'json'", cfg.progressMode)
+	}
+	cfg.quiet = true
+	var w io.Writer
+	switch cfg.progressFD {
+	case 1:
+		w = app.out
+	case 2:
+		w = app.err
+	default:
+		f := os.NewFile(uintptr(cfg.progressFD), "progress-fd")
+		if f == nil {
+			return usageErrorf("invalid --progress-fd %d", cfg.progressFD)
+		}
+		if _, err := f.Stat(); err != nil {
+			return usageErrorf("invalid --progress-fd %d: %w", cfg.progressFD, err)
+		}
+		w = f
+	}
+	cfg.events = newEventWriter(w)
+	return nil
+}
+
+// options converts the parsed flags into library options.
+func (cfg *downloadConfig) options(app *cliApp) ([]hfg.Option, error) {
+	opts := append(cfg.repoConfig.options(app), cfg.filterConfig.options()...)
+	opts = append(opts, cfg.destConfig.options()...)
+	opts = append(opts, hfg.WithConnections(cfg.numConnections))
+	if cfg.skipChecksum {
+		opts = append(opts, hfg.SkipSHACheck())
+	}
+	if cfg.force {
+		opts = append(opts, hfg.WithForceRedownload())
+	}
+	if cfg.ignoreDiskSpace {
+		opts = append(opts, hfg.WithoutDiskSpaceCheck())
+	}
+	if cfg.prune {
+		opts = append(opts, hfg.WithPrune())
+	}
+	conflictPolicy, err := hfg.ParseConflictPolicy(cfg.onConflict)
+	if err != nil {
+		return nil, usageErrorf("invalid --on-conflict: %w", err)
+	}
+	cfg.conflictPolicy = conflictPolicy
+	opts = append(opts, hfg.WithConflictPolicy(conflictPolicy))
+	switch cfg.lockMode {
+	case "fail", "":
+	case "wait":
+		opts = append(opts, hfg.WithLockWait(0))
+	default:
+		timeout, err := time.ParseDuration(cfg.lockMode)
+		if err != nil || timeout <= 0 {
+			return nil, usageErrorf("invalid --lock value %q: want 'fail', 'wait' or a duration", cfg.lockMode)
+		}
+		opts = append(opts, hfg.WithLockWait(timeout))
+	}
+	if cfg.minSize != "" {
+		n, err := parseSize(cfg.minSize)
+		if err != nil {
+			return nil, usageErrorf("invalid --min-size: %w", err)
+		}
+		opts = append(opts, hfg.WithMinFileSize(n))
+	}
+	if cfg.maxSize != "" {
+		n, err := parseSize(cfg.maxSize)
+		if err != nil {
+			return nil, usageErrorf("invalid --max-size: %w", err)
+		}
+		opts = append(opts, hfg.WithMaxFileSize(n))
+	}
+	if cfg.budget != "" {
+		n, err := parseSize(cfg.budget)
+		if err != nil {
+			return nil, usageErrorf("invalid --budget: %w", err)
+		}
+		priority, err := hfg.ParseBudgetPriority(cfg.budgetPriority)
+		if err != nil {
+			return nil, usageErrorf("invalid --budget-priority: %w", err)
+		}
+		opts = append(opts, hfg.WithDownloadBudget(n, priority))
+	}
+	if cfg.quant != "" && !strings.EqualFold(cfg.quant, "list") {
+		opts = append(opts, hfg.WithQuant(cfg.quant))
+		if cfg.mmproj {
+			opts = append(opts, hfg.WithMMProj())
+		}
+	}
+	if cfg.preferFormat != "" && cfg.preferFormat != "all" {
+		var order []hfg.WeightFormat
+		for _, name := range strings.Split(cfg.preferFormat, ",") {
+			format, err := hfg.ParseWeightFormat(strings.TrimSpace(name))
+			if err != nil {
+				return nil, usageErrorf("invalid --prefer-format: %w", err)
+			}
+			order = append(order, format)
+		}
+		opts = append(opts, hfg.WithFormatPreference(order...))
+	}
+	scanPolicy, err := hfg.ParsePickleScanPolicy(cfg.scanPickles)
+	if err != nil {
+		return nil, usageErrorf("invalid --scan-pickles: %w", err)
+	}
+	opts = append(opts, hfg.WithPickleScan(scanPolicy))
+	if cfg.limitRate != "" {
+		rate, err := parseSize(cfg.limitRate)
+		if err != nil {
+			return nil, usageErrorf("invalid --limit-rate: %w", err)
+		}
+		opts = append(opts, hfg.WithRateLimit(rate))
+	}
+	if cfg.limitRateConn != "" {
+		rate, err := parseSize(cfg.limitRateConn)
+		if err != nil {
+			return nil, usageErrorf("invalid --limit-rate-per-conn: %w", err)
+		}
+		opts = append(opts, hfg.WithConnectionRateLimit(rate))
+	}
+	if cfg.limitSchedule != "" {
+		windows, err := parseRateSchedule(cfg.limitSchedule)
+		if err != nil {
+			return nil, usageErrorf("invalid --limit-schedule: %w", err)
+		}
+		opts = append(opts, hfg.WithRateSchedule(windows...))
+	}
+	return opts, nil
+}
+
+// runDownload implements "hfget download", which is also what a bare
+// "hfget model_or_dataset_name" runs.
+func (app *cliApp) runDownload(ctx context.Context, g globalConfig, args []string) (err error) {
+	// --- FIX: Create a single reader to be used for all prompts ---
+	stdinReader := bufio.NewReader(os.Stdin)
+
+	cfg := downloadConfig{repoConfig: repoConfig{globalConfig: g}}
+	fs := app.newFlagSet("download")
+	cfg.register(fs)
+	cfg.registerProgress(fs)
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	repoName := fs.Arg(0)
+
+	if !app.isTerminal || cfg.force {
+		cfg.quiet = true
+	}
+	if err := app.setupProgress(&cfg); err != nil {
+		return err
+	}
+	defer func() { cfg.events.done(err) }()
+
+	opts, err := cfg.options(app)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(cfg.quant, "list") {
+		return app.listQuants(ctx, repoName, opts)
+	}
+
+	plan, err := app.buildPlan(ctx, &cfg, repoName, opts)
+	if err != nil {
+		return err
+	}
+	cfg.events.plan(plan)
+
+	if len(plan.FilesToDownload) == 0 && len(plan.FilesToDelete) == 0 && len(plan.FilesConflicted) == 0 {
+		if len(plan.FilesToSkip) > 0 {
+			log.Printf("%d files are already present and valid (Total Size: %s).", len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize))
+		}
+		log.Println("Nothing to download.")
+
+		if !cfg.force && !cfg.quiet {
+			yes, err := app.prompt(ctx, stdinReader, "Would you like to force a re-download anyway? [y/N]: ")
+			if err != nil {
+				return err
+			}
+			if yes {
+				log.Println("Forcing re-download as requested...")
+				for _, skippedFile := range plan.FilesToSkip {
+					plan.FilesToDownload = append(plan.FilesToDownload, hfg.FileDownload{File: skippedFile.File, Reason: hfg.ReasonForced})
+				}
+				plan.TotalDownloadSize += plan.TotalSkipSize
+				plan.FilesToSkip = nil
+				plan.TotalSkipSize = 0
+			} else {
+				log.Println("Exiting.")
+				return nil
+			}
+		} else {
+			return nil
+		}
+	}
+
+	if !cfg.quiet {
+		app.printPlanSummary(plan, &cfg)
+		if err := plan.CheckConflicts(); err != nil {
+			return err
+		}
+		yes, err := app.prompt(ctx, stdinReader, "Proceed with download? [y/N]: ")
+		if err != nil {
+			return err
+		}
+		if !yes {
+			log.Println("Download cancelled by user.")
+			return nil
+		}
+	}
+
+	return app.executePlan(ctx, &cfg, repoName, opts, plan)
+}
+
+// buildPlan fetches the repository metadata and compares it with local
+// files, showing analysis progress unless cfg.quiet is set.
+func (app *cliApp) buildPlan(ctx context.Context, cfg *downloadConfig, repoName string, opts []hfg.Option) (*hfg.DownloadPlan, error) {
+	downloader := app.newDownloader(repoName, opts...)
+
+	fmt.Fprintln(app.err, "Fetching repository information...")
+	repoInfo, err := downloader.FetchRepoInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch repository info: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var progressChan chan hfg.Progress
+	var totalAnalysisSize int64
+	for _, s := range repoInfo.Siblings {
+		if s.Type != "directory" {
+			totalAnalysisSize += s.Size
+		}
+	}
+
+	if !cfg.quiet {
+		progressChan = make(chan hfg.Progress, cfg.numConnections*2)
+		optsWithProgress := append(opts, hfg.WithProgressChannel(progressChan))
+		downloader = app.newDownloader(repoName, optsWithProgress...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			analysisDisplayProgress(app.err, progressChan, app.terminalFd, totalAnalysisSize)
+		}()
+	}
+
+	plan, err := downloader.BuildPlan(ctx, repoInfo)
+	if !cfg.quiet {
+		close(progressChan)
+		wg.Wait()
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Println("Interrupted while analyzing local files; nothing was downloaded.")
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not build download plan: %w", err)
+	}
+	if len(plan.FilesRejected) > 0 {
+		log.Printf("SECURITY WARNING: %d file(s) in %s would be written outside the destination and were rejected:", len(plan.FilesRejected), repoName)
+		for _, r := range plan.FilesRejected {
+			log.Printf("  - %s: %s", r.File.Path, r.Detail)
+		}
+	}
+	return plan, nil
+}
+
+// listQuants prints the quantizations available in a GGUF repository.
+func (app *cliApp) listQuants(ctx context.Context, repoName string, opts []hfg.Option) error {
+	repoInfo, err := app.newDownloader(repoName, opts...).FetchRepoInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch repository info: %w", err)
+	}
+	quants := hfg.GGUFQuants(repoInfo.Siblings)
+	if len(quants) == 0 {
+		return fmt.Errorf("%s has no GGUF files", repoName)
+	}
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUANT\tSIZE\tPARTS")
+	for _, q := range quants {
+		parts := strconv.Itoa(q.Parts)
+		if !q.Complete {
+			parts = fmt.Sprintf("%d of %d (incomplete)", len(q.Files), q.Parts)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", q.Name, formatBytes(q.Size), parts)
+	}
+	return w.Flush()
+}
+
+// printPlanSummary describes what executing plan will do.
+func (app *cliApp) printPlanSummary(plan *hfg.DownloadPlan, cfg *downloadConfig) {
+	fmt.Fprintln(app.err, "----------------------------------------------------")
+	fmt.Fprintf(app.err, "Repository:    %s\n", plan.Repo.ID)
+	if plan.Repo.SHA != "" {
+		fmt.Fprintf(app.err, "Commit:        %s\n", plan.Repo.SHA)
+	}
+	fmt.Fprintf(app.err, "Last Modified: %s\n", plan.Repo.LastModified.Format(time.RFC1123))
+	fmt.Fprintln(app.err, "----------------------------------------------------")
+
+	if len(plan.FilesToSkip) > 0 {
+		fmt.Fprintf(app.err, "%d files already present and valid (Total: %s) will be skipped.\n", len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize))
+	}
+	var filtered, sizeLimited int
+	var overBudget, duplicates []hfg.FileSkip
+	for _, f := range plan.FilesFiltered {
+		switch f.Reason {
+		case hfg.ReasonSizeLimit:
+			sizeLimited++
+		case hfg.ReasonOverBudget:
+			overBudget = append(overBudget, f)
+		case hfg.ReasonDuplicateFormat:
+			duplicates = append(duplicates, f)
+		default:
+			filtered++
+		}
+	}
+	if filtered > 0 {
+		fmt.Fprintf(app.err, "%d files excluded by --include/--exclude.\n", filtered)
+	}
+	if sizeLimited > 0 {
+		fmt.Fprintf(app.err, "%d files excluded by --min-size/--max-size.\n", sizeLimited)
+	}
+	if len(duplicates) > 0 {
+		fmt.Fprintln(app.err, "Duplicate weight formats skipped (--prefer-format):")
+		for _, f := range duplicates {
+			format, _ := hfg.WeightFormatOf(f.File.Path)
+			fmt.Fprintf(app.err, "  - %-60s (%s, %s)\n", f.File.Path, format, formatBytes(f.File.Size))
+		}
+	}
+	if len(overBudget) > 0 {
+		fmt.Fprintln(app.err, "Files left out to stay within --budget:")
+		for _, f := range overBudget {
+			fmt.Fprintf(app.err, "  - %-60s (%s)\n", f.File.Path, formatBytes(f.File.Size))
+		}
+	}
+
+	if len(plan.FilesConflicted) > 0 {
+		fmt.Fprintf(app.err, "Files modified locally since the last sync (policy: %s):\n", cfg.conflictPolicy)
+		for _, c := range plan.FilesConflicted {
+			fmt.Fprintf(app.err, "  - %-60s (%s, modified %s)\n", c.File.Path, formatBytes(c.LocalSize), c.LocalModTime.Format(time.RFC1123))
+		}
+	}
+
+	filesByReason := make(map[hfg.PlanReason][]hfg.FileDownload)
+	for _, f := range plan.FilesToDownload {
+		if f.Reason == hfg.ReasonLocallyModified {
+			continue // Already listed with the conflicts above.
+		}
+		filesByReason[f.Reason] = append(filesByReason[f.Reason], f)
+	}
+
+	for _, reason := range slices.Sorted(maps.Keys(filesByReason)) {
+		fmt.Fprintf(app.err, "Files to download (Reason: %s):\n", reason)
+		for _, file := range filesByReason[reason] {
+			fmt.Fprintf(app.err, "  - %-60s (%s)\n", file.File.Path, formatBytes(file.File.Size))
+		}
+	}
+
+	if len(plan.FilesToDelete) > 0 {
+		fmt.Fprintln(app.err, "Files to delete (no longer in repository):")
+		for _, file := range plan.FilesToDelete {
+			fmt.Fprintf(app.err, "  - %-60s (%s)\n", file.Path, formatBytes(file.Size))
+		}
+	}
+
+	fmt.Fprintln(app.err, "----------------------------------------------------")
+	fmt.Fprintf(app.err, "Total download size: %s\n", formatBytes(plan.TotalDownloadSize))
+	if len(plan.FilesToDelete) > 0 {
+		fmt.Fprintf(app.err, "Total to delete:     %s (after a successful download)\n", formatBytes(plan.TotalDeleteSize))
+	}
+	if plan.AvailableBytes > 0 {
+		fmt.Fprintf(app.err, "Disk space:          %s required (including staging), %s available\n",
+			formatBytes(plan.RequiredBytes), formatBytes(plan.AvailableBytes))
+		if plan.RequiredBytes > plan.AvailableBytes {
+			if cfg.ignoreDiskSpace {
+				fmt.Fprintln(app.err, "WARNING: not enough free disk space; continuing because --ignore-disk-space was given.")
+			} else {
+				fmt.Fprintln(app.err, "WARNING: not enough free disk space; the download will be refused unless --ignore-disk-space is given.")
+			}
+		}
+	}
+}
+
+// executePlan runs plan with progress display and retries on transient errors.
+func (app *cliApp) executePlan(ctx context.Context, cfg *downloadConfig, repoName string, opts []hfg.Option, plan *hfg.DownloadPlan) error {
+	var wg sync.WaitGroup
+	var progressChan chan hfg.Progress
+	downloader := app.newDownloader(repoName, opts...)
+	if !cfg.quiet || cfg.events != nil {
+		progressChan = make(chan hfg.Progress, cfg.numConnections*2)
+		optsWithProgress := append(opts, hfg.WithProgressChannel(progressChan))
+		downloader = app.newDownloader(repoName, optsWithProgress...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cfg.events != nil {
+				cfg.events.consume(progressChan, plan)
+			} else {
+				downloadDisplayProgress(app.err, progressChan, app.terminalFd, plan)
+			}
+		}()
+	}
+
+	log.Println("Starting download...")
+	var lastErr error
+	for i := 0; i < cfg.maxRetries; i++ {
+		if i > 0 {
+			log.Printf("Retrying after transient error (attempt %d/%d)...", i+1, cfg.maxRetries)
+			cfg.events.retry(i+1, cfg.maxRetries, cfg.retryInterval, lastErr)
+			select {
+			case <-time.After(cfg.retryInterval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
+		}
+		lastErr = downloader.ExecutePlan(ctx, plan)
+		if lastErr == nil || !isTransientError(lastErr) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if progressChan != nil {
+		close(progressChan)
+		wg.Wait()
+	}
+	printPickleScans(plan.PickleScans)
+
+	if lastErr != nil {
+		if errors.Is(lastErr, context.Canceled) {
+			log.Printf("Download of %s interrupted.", repoName)
+			log.Println("Partially downloaded files were kept; run the same command again to resume.")
+		}
+		return lastErr
+	}
+
+	log.Printf("\nDownload of %s completed.", repoName)
+	return nil
+}
+
+// printPickleScans reports pickle files that import globals outside the
+// allowlist.
+func printPickleScans(reports []hfg.PickleReport) {
+	var unsafe int
+	for _, r := range reports {
+		if !r.Unsafe() {
+			continue
+		}
+		unsafe++
+		log.Printf("WARNING: %s is a pickle that can run code when loaded (%s):", r.Path, r.Safety)
+		for _, g := range r.Globals {
+			if g.Safety != hfg.PickleSafe {
+				log.Printf("  - %s (%s)", g, g.Safety)
+			}
+		}
+		if r.Error != "" {
+			log.Printf("  - could not be fully parsed: %s", r.Error)
+		}
+	}
+	if len(reports) > 0 {
+		log.Printf("Pickle scan: %d file(s) scanned, %d unsafe.", len(reports), unsafe)
+	}
+}
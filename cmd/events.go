@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// eventSchemaVersion is written into every JSON progress event as "v". It
+// changes only when a field is removed or changes meaning; new events and
+// fields may be added without a change.
+const eventSchemaVersion = 1
+
+// progressSnapshotInterval is how often a "progress" event is written while
+// files are downloading.
+const progressSnapshotInterval = time.Second
+
+// eventWriter writes the JSON-lines events of --progress=json, one object
+// per line. A nil *eventWriter discards events, so callers need not check.
+type eventWriter struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	now     func() time.Time
+	started time.Time
+	status  map[string]string // Last outcome per file: "verified" or "failed"
+	bytes   int64             // Downloaded in this run
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w), now: time.Now, started: time.Now(), status: make(map[string]string)}
+}
+
+// eventHeader starts every event.
+type eventHeader struct {
+	V     int       `json:"v"`
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+}
+
+type planEvent struct {
+	eventHeader
+	Repo         string `json:"repo"`
+	Revision     string `json:"revision"`
+	Commit       string `json:"commit,omitempty"`
+	ModelPath    string `json:"modelPath"`
+	Files        int    `json:"files"` // To download
+	Bytes        int64  `json:"bytes"`
+	SkippedFiles int    `json:"skippedFiles"`
+	SkippedBytes int64  `json:"skippedBytes"`
+	DeleteFiles  int    `json:"deleteFiles"`
+}
+
+type fileStartEvent struct {
+	eventHeader
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"` // Bytes already present from an earlier attempt
+}
+
+type fileSnapshot struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Size  int64  `json:"size"`
+}
+
+type progressEvent struct {
+	eventHeader
+	Bytes      int64          `json:"bytes"`
+	TotalBytes int64          `json:"totalBytes"`
+	Rate       float64        `json:"rate"`    // Bytes per second since the previous snapshot
+	AvgRate    float64        `json:"avgRate"` // Bytes per second since the start
+	ETASeconds float64        `json:"etaSeconds,omitempty"`
+	Active     []fileSnapshot `json:"active"`
+}
+
+type fileDoneEvent struct {
+	eventHeader
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Method string `json:"method,omitempty"` // file_verified: how the file was checked
+	Error  string `json:"error,omitempty"`  // file_failed
+}
+
+type retryEvent struct {
+	eventHeader
+	Attempt      int     `json:"attempt"` // The attempt about to start, from 2
+	MaxAttempts  int     `json:"maxAttempts"`
+	DelaySeconds float64 `json:"delaySeconds"`
+	Error        string  `json:"error"`
+}
+
+type doneEvent struct {
+	eventHeader
+	Status         string  `json:"status"` // "ok", "failed" or "interrupted"
+	VerifiedFiles  int     `json:"verifiedFiles"`
+	FailedFiles    int     `json:"failedFiles"`
+	Bytes          int64   `json:"bytes"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	Error          string  `json:"error,omitempty"`
+}
+
+func (w *eventWriter) header(event string) eventHeader {
+	return eventHeader{V: eventSchemaVersion, Time: w.now().UTC(), Event: event}
+}
+
+func (w *eventWriter) write(event any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.enc.Encode(event)
+}
+
+// plan writes a "plan" event.
+func (w *eventWriter) plan(plan *hfg.DownloadPlan) {
+	if w == nil {
+		return
+	}
+	e := planEvent{
+		eventHeader:  w.header("plan"),
+		Repo:         plan.RepoName,
+		Revision:     plan.Revision,
+		ModelPath:    plan.ModelPath,
+		Files:        len(plan.FilesToDownload),
+		Bytes:        plan.TotalDownloadSize,
+		SkippedFiles: len(plan.FilesToSkip),
+		SkippedBytes: plan.TotalSkipSize,
+		DeleteFiles:  len(plan.FilesToDelete),
+	}
+	if plan.Repo != nil {
+		e.Commit = plan.Repo.SHA
+	}
+	w.write(e)
+}
+
+// retry writes a "retry" event before attempt (counted from 1) starts.
+func (w *eventWriter) retry(attempt, maxAttempts int, delay time.Duration, cause error) {
+	if w == nil {
+		return
+	}
+	w.write(retryEvent{w.header("retry"), attempt, maxAttempts, delay.Seconds(), cause.Error()})
+}
+
+// done writes the final "done" event for the outcome err.
+func (w *eventWriter) done(err error) {
+	if w == nil {
+		return
+	}
+	e := doneEvent{eventHeader: w.header("done"), Status: "ok"}
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Status = "interrupted"
+	case err != nil:
+		e.Status = "failed"
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	w.mu.Lock()
+	for _, s := range w.status {
+		if s == "verified" {
+			e.VerifiedFiles++
+		} else {
+			e.FailedFiles++
+		}
+	}
+	e.Bytes = w.bytes
+	w.mu.Unlock()
+	e.ElapsedSeconds = w.now().Sub(w.started).Seconds()
+	w.write(e)
+}
+
+// consume turns the library's progress updates for plan into file_start,
+// progress, file_verified and file_failed events until progressChan is
+// closed.
+func (w *eventWriter) consume(progressChan <-chan hfg.Progress, plan *hfg.DownloadPlan) {
+	type fileState struct {
+		snapshot fileSnapshot
+		active   bool
+	}
+	files := make(map[string]*fileState)
+	for _, f := range plan.FilesToDownload {
+		files[f.File.Path] = &fileState{snapshot: fileSnapshot{Path: f.File.Path, Size: f.File.Size}}
+	}
+	addBytes := func(f *fileState, current int64) {
+		if current > f.snapshot.Bytes {
+			w.mu.Lock()
+			w.bytes += current - f.snapshot.Bytes
+			w.mu.Unlock()
+			f.snapshot.Bytes = current
+		}
+	}
+	finish := func(f *fileState, status string) {
+		f.active = false
+		w.mu.Lock()
+		w.status[f.snapshot.Path] = status
+		w.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(progressSnapshotInterval)
+	defer ticker.Stop()
+	lastTick, lastBytes := w.now(), int64(0)
+	for {
+		select {
+		case pr, ok := <-progressChan:
+			if !ok {
+				return
+			}
+			f := files[pr.Filepath]
+			if f == nil {
+				continue
+			}
+			switch pr.State {
+			case hfg.ProgressStateDownloading:
+				if !f.active {
+					f.active = true
+					w.write(fileStartEvent{w.header("file_start"), f.snapshot.Path, f.snapshot.Size, pr.CurrentSize})
+				}
+				addBytes(f, pr.CurrentSize)
+			case hfg.ProgressStateComplete:
+				addBytes(f, f.snapshot.Size)
+			case hfg.ProgressStateVerified:
+				addBytes(f, f.snapshot.Size)
+				finish(f, "verified")
+				w.write(fileDoneEvent{eventHeader: w.header("file_verified"), Path: f.snapshot.Path, Size: f.snapshot.Size, Method: pr.Message})
+			case hfg.ProgressStateFailed:
+				finish(f, "failed")
+				w.write(fileDoneEvent{eventHeader: w.header("file_failed"), Path: f.snapshot.Path, Size: f.snapshot.Size, Error: pr.Message})
+			}
+
+		case <-ticker.C:
+			e := progressEvent{eventHeader: w.header("progress"), TotalBytes: plan.TotalDownloadSize, Active: []fileSnapshot{}}
+			for _, f := range plan.FilesToDownload {
+				if s := files[f.File.Path]; s.active {
+					e.Active = append(e.Active, s.snapshot)
+				}
+			}
+			w.mu.Lock()
+			e.Bytes = w.bytes
+			w.mu.Unlock()
+			if len(e.Active) == 0 && e.Bytes == lastBytes {
+				continue
+			}
+			now := w.now()
+			if elapsed := now.Sub(lastTick).Seconds(); elapsed > 0 {
+				e.Rate = float64(e.Bytes-lastBytes) / elapsed
+			}
+			if elapsed := now.Sub(w.started).Seconds(); elapsed > 0 {
+				e.AvgRate = float64(e.Bytes) / elapsed
+			}
+			if e.Rate > 0 && e.TotalBytes > e.Bytes {
+				e.ETASeconds = float64(e.TotalBytes-e.Bytes) / e.Rate
+			}
+			lastTick, lastBytes = now, e.Bytes
+			w.write(e)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// Exit codes. Scripts rely on them to decide whether to retry, so they must
+// not be renumbered; see "Exit Codes" in the README.
+const (
+	exitFailure      = 1 // Any error not covered below
+	exitUsage        = 2 // Bad flags or arguments
+	exitAuth         = 3 // Token rejected, or a gated repository not accepted
+	exitNotFound     = 4 // Repository, revision, file or quantization not found
+	exitNetwork      = 5 // Timeouts, connection failures and 408, 429 or 5xx responses
+	exitVerification = 6 // Local files do not match the repository
+	exitPartial      = 7 // Some files were downloaded, others failed
+	exitDiskFull     = 8 // Not enough space on the destination
+	exitInterrupted  = 130
+)
+
+// exitError gives err an explicit exit code. reported is set when the
+// message has already been printed, as the flag package does for bad flags.
+type exitError struct {
+	code     int
+	err      error
+	reported bool
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// usageErrorf returns an error that exits with exitUsage.
+func usageErrorf(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// flagError converts an error from flag.FlagSet.Parse, which has already
+// printed it along with the usage. -h is not an error.
+func flagError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return &exitError{code: exitUsage, err: err, reported: true}
+}
+
+// exitCode returns the process exit status for err. Where an error has
+// several causes, as a partial download does, the first matching class in
+// this order wins.
+func exitCode(err error) int {
+	var exitErr *exitError
+	var partial *hfg.DownloadError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, hfg.ErrInsufficientSpace) || isDiskFull(err):
+		return exitDiskFull
+	case errors.Is(err, hfg.ErrAuthentication) || errors.Is(err, hfg.ErrForbidden):
+		return exitAuth
+	case errors.Is(err, hfg.ErrNotFound) || errors.Is(err, hfg.ErrQuantNotFound):
+		return exitNotFound
+	case errors.As(err, &partial) && partial.Downloaded > 0:
+		return exitPartial
+	case errors.Is(err, hfg.ErrVerification) || errors.Is(err, hfg.ErrChecksumMismatch) || errors.Is(err, hfg.ErrSizeMismatch):
+		return exitVerification
+	case isNetworkError(err):
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// isDiskFull reports whether err is the system's error for a full disk.
+func isDiskFull(err error) bool {
+	for _, target := range diskFullErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetworkError reports whether err is a network failure or a response that
+// may succeed if retried later.
+func isNetworkError(err error) bool {
+	if isTransientError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var statusErr *hfg.StatusError
+	return errors.As(err, &statusErr) && statusErr.Temporary()
+}
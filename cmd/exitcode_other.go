@@ -0,0 +1,6 @@
+//go:build !(unix || windows)
+
+package main
+
+// diskFullErrors is empty where a full disk has no distinct error.
+var diskFullErrors []error
@@ -0,0 +1,8 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// diskFullErrors are the system errors for a full destination.
+var diskFullErrors = []error{syscall.ENOSPC}
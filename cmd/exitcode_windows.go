@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// diskFullErrors are the system errors for a full destination.
+var diskFullErrors = []error{windows.ERROR_DISK_FULL, windows.ERROR_HANDLE_DISK_FULL}
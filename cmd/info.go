@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// cardFields are the model card entries "hfget info" shows; --json has the
+// rest.
+var cardFields = []string{"base_model", "datasets", "language"}
+
+// sizeGroup is one row of a size breakdown.
+type sizeGroup struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// repoSummary is what "hfget info --json" writes.
+type repoSummary struct {
+	Repo        *hfg.RepoInfo `json:"repo"`
+	Files       int           `json:"files"`
+	TotalSize   int64         `json:"totalSize"`
+	ByExtension []sizeGroup   `json:"byExtension"`
+	ByFormat    []sizeGroup   `json:"byFormat"`
+}
+
+// summarizeRepo totals the files of info by extension and weight format.
+func summarizeRepo(info *hfg.RepoInfo) *repoSummary {
+	s := &repoSummary{Repo: info}
+	byExt := make(map[string]*sizeGroup)
+	byFormat := make(map[string]*sizeGroup)
+	add := func(groups map[string]*sizeGroup, name string, size int64) {
+		g := groups[name]
+		if g == nil {
+			g = &sizeGroup{Name: name}
+			groups[name] = g
+		}
+		g.Files++
+		g.Size += size
+	}
+	for _, f := range info.Siblings {
+		if f.Type == "directory" {
+			continue
+		}
+		s.Files++
+		s.TotalSize += f.Size
+		ext := strings.ToLower(path.Ext(f.Path))
+		if ext == "" {
+			ext = "(none)"
+		}
+		add(byExt, ext, f.Size)
+		format := "other"
+		if wf, ok := hfg.WeightFormatOf(f.Path); ok {
+			format = wf.String()
+		}
+		add(byFormat, format, f.Size)
+	}
+	s.ByExtension = sortedGroups(byExt)
+	s.ByFormat = sortedGroups(byFormat)
+	return s
+}
+
+// sortedGroups returns groups largest first.
+func sortedGroups(groups map[string]*sizeGroup) []sizeGroup {
+	sorted := make([]sizeGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, *g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Size != sorted[j].Size {
+			return sorted[i].Size > sorted[j].Size
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// runInfo implements "hfget info": print a repository's metadata and what
+// its files add up to.
+func (app *cliApp) runInfo(ctx context.Context, g globalConfig, args []string) error {
+	cfg := repoConfig{globalConfig: g}
+	var asJSON bool
+	fs := app.newFlagSet("info")
+	cfg.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "Write the metadata and size breakdown as JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	repoName := fs.Arg(0)
+
+	info, err := app.newDownloader(repoName, cfg.options(app)...).FetchRepoInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch repository info: %w", err)
+	}
+	summary := summarizeRepo(info)
+	if asJSON {
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	return app.printInfo(summary)
+}
+
+// printInfo writes summary as labelled lines and two size tables.
+func (app *cliApp) printInfo(s *repoSummary) error {
+	info := s.Repo
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	field := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", label, value)
+		}
+	}
+	field("Repository", info.ID)
+	field("Commit", info.SHA)
+	if !info.LastModified.IsZero() {
+		field("Last Modified", info.LastModified.Format(time.RFC1123))
+	}
+	field("Pipeline", info.PipelineTag)
+	field("Library", info.LibraryName)
+	field("License", info.License)
+	gated := "no"
+	if info.Gated != "" {
+		gated = "yes (" + info.Gated + " approval); accept the terms on the Hub and use a token"
+	}
+	field("Gated", gated)
+	field("Downloads", fmt.Sprintf("%d (last 30 days)", info.Downloads))
+	field("Likes", fmt.Sprint(info.Likes))
+	field("Tags", strings.Join(info.Tags, ", "))
+	for _, key := range cardFields {
+		if v, ok := info.CardData[key]; ok {
+			field("Card "+key, formatCardValue(v))
+		}
+	}
+	field("Files", fmt.Sprintf("%d (%s)", s.Files, formatBytes(s.TotalSize)))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, table := range []struct {
+		title  string
+		groups []sizeGroup
+	}{{"EXTENSION", s.ByExtension}, {"FORMAT", s.ByFormat}} {
+		fmt.Fprintln(app.out)
+		fmt.Fprintf(w, "%s\tFILES\tSIZE\n", table.title)
+		for _, g := range table.groups {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", g.Name, g.Files, formatBytes(g.Size))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatCardValue renders a model card value, joining lists with commas.
+func formatCardValue(v any) string {
+	if list, ok := v.([]any); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(v)
+}
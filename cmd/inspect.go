@@ -0,0 +1,221 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// inspectReport is what "hfget inspect --json" writes.
+type inspectReport struct {
+	Safetensors []hfg.SafetensorsHeader `json:"safetensors,omitempty"`
+	GGUF        []hfg.GGUFHeader        `json:"gguf,omitempty"`
+}
+
+// runInspect implements "hfget inspect": read weight file headers with
+// Range requests instead of downloading the weights.
+func (app *cliApp) runInspect(ctx context.Context, g globalConfig, args []string) error {
+	var (
+		cfg                       = repoConfig{globalConfig: g}
+		filters                   filterConfig
+		tensors, metadata, asJSON bool
+	)
+	fs := app.newFlagSet("inspect")
+	cfg.register(fs)
+	filters.register(fs)
+	fs.BoolVar(&tensors, "tensors", false, "List every tensor with its dtype and shape")
+	fs.BoolVar(&metadata, "metadata", false, "List every GGUF metadata key and value")
+	fs.BoolVar(&asJSON, "json", false, "Write the parsed headers as JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	repoName := fs.Arg(0)
+
+	downloader := app.newDownloader(repoName, append(cfg.options(app), filters.options()...)...)
+	repoInfo, err := downloader.FetchRepoInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch repository info: %w", err)
+	}
+	var report inspectReport
+	var safetensorsErr, ggufErr error
+	report.Safetensors, safetensorsErr = downloader.InspectSafetensors(ctx, repoInfo)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	report.GGUF, ggufErr = downloader.InspectGGUF(ctx, repoInfo)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	inspectErr := errors.Join(safetensorsErr, ggufErr)
+
+	if asJSON {
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		if len(report.Safetensors) > 0 {
+			if err := app.printSafetensors(report.Safetensors, tensors); err != nil {
+				return err
+			}
+		}
+		if len(report.GGUF) > 0 {
+			if len(report.Safetensors) > 0 {
+				fmt.Fprintln(app.out)
+			}
+			if err := app.printGGUF(report.GGUF, tensors, metadata); err != nil {
+				return err
+			}
+		}
+		if len(report.Safetensors) == 0 && len(report.GGUF) == 0 && inspectErr == nil {
+			fmt.Fprintf(app.err, "%s has no safetensors or GGUF files to inspect.\n", repoName)
+		}
+	}
+	if inspectErr != nil {
+		return fmt.Errorf("some headers could not be read:\n%w", inspectErr)
+	}
+	return nil
+}
+
+// printSafetensors writes one row per file and a total, followed by every
+// tensor when tensors is set.
+func (app *cliApp) printSafetensors(headers []hfg.SafetensorsHeader, tensors bool) error {
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tTENSORS\tDTYPES\tPARAMS\tSIZE")
+	var numTensors int
+	var params, size int64
+	dtypes := make(map[string]int64)
+	for _, h := range headers {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", h.Path, len(h.Tensors), formatDTypes(h.DTypes()), formatCount(h.Params()), formatBytes(h.Size))
+		numTensors += len(h.Tensors)
+		params += h.Params()
+		size += h.Size
+		for dtype, n := range h.DTypes() {
+			dtypes[dtype] += n
+		}
+	}
+	if len(headers) > 1 {
+		fmt.Fprintf(w, "TOTAL\t%d\t%s\t%s\t%s\n", numTensors, formatDTypes(dtypes), formatCount(params), formatBytes(size))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !tensors {
+		return nil
+	}
+	for _, h := range headers {
+		fmt.Fprintf(app.out, "\n%s:\n", h.Path)
+		for _, t := range h.Tensors {
+			fmt.Fprintf(w, "  %s\t%s\t%v\n", t.Name, t.DType, t.Shape)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printGGUF writes one row per GGUF file, followed by the metadata and the
+// tensors of each file when asked.
+func (app *cliApp) printGGUF(headers []hfg.GGUFHeader, tensors, metadata bool) error {
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tTYPE\tARCH\tCONTEXT\tTOKENIZER\tTENSORS\tSIZE")
+	for _, h := range headers {
+		fileType := h.FileType()
+		if fileType == "" {
+			fileType = h.Quant
+		}
+		tokenizer, vocab := h.Tokenizer()
+		if vocab > 0 {
+			tokenizer = fmt.Sprintf("%s (%d)", tokenizer, vocab)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%d\t%s\n", h.Path, orDash(fileType), orDash(h.Architecture()),
+			h.ContextLength(), orDash(tokenizer), h.TensorCount(), formatBytes(h.Size))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, h := range headers {
+		if !metadata && !tensors {
+			break
+		}
+		fmt.Fprintf(app.out, "\n%s:\n", h.Path)
+		if metadata {
+			for _, key := range slices.Sorted(maps.Keys(h.Metadata)) {
+				fmt.Fprintf(w, "  %s\t%s\n", key, formatGGUFValue(h.Metadata[key]))
+			}
+		}
+		if tensors {
+			for _, t := range h.Tensors {
+				fmt.Fprintf(w, "  %s\t%s\t%v\n", t.Name, t.Type, t.Shape)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatGGUFValue renders a metadata value on one line, shortening long
+// strings such as chat templates.
+func formatGGUFValue(v any) string {
+	var s string
+	switch v := v.(type) {
+	case hfg.GGUFArray:
+		return fmt.Sprintf("[%d × %s]", v.Len, v.Type)
+	case string:
+		s = strconv.Quote(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return s
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatDTypes lists dtypes by the number of parameters they hold, most
+// first.
+func formatDTypes(dtypes map[string]int64) string {
+	names := slices.Sorted(maps.Keys(dtypes))
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cmp.Compare(dtypes[b], dtypes[a])
+	})
+	return strings.Join(names, ",")
+}
+
+// formatCount abbreviates a parameter count, e.g. 7.24B or 110.1M.
+func formatCount(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.2fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
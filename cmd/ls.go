@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// runLs implements "hfget ls": list a repository's tree as the API reports
+// it, filtered by --include/--exclude.
+func (app *cliApp) runLs(ctx context.Context, g globalConfig, args []string) error {
+	var (
+		cfg                     = repoConfig{globalConfig: g}
+		filters                 filterConfig
+		recursive, long, asJSON bool
+		sortBy                  string
+	)
+	fs := app.newFlagSet("ls")
+	cfg.register(fs)
+	filters.register(fs)
+	fs.BoolVar(&recursive, "r", false, "List subdirectories recursively")
+	fs.BoolVar(&long, "l", false, "Long format: also show the oid and the last commit of each file")
+	fs.StringVar(&sortBy, "sort", "name", "Sort order: 'name' or 'size' (largest first)")
+	fs.BoolVar(&asJSON, "json", false, "Write the listing as JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	if sortBy != "name" && sortBy != "size" {
+		return usageErrorf("invalid --sort %q: want 'name' or 'size'", sortBy)
+	}
+	repoName, dir := fs.Arg(0), fs.Arg(1)
+
+	opts := append(cfg.options(app), filters.options()...)
+	files, err := app.newDownloader(repoName, opts...).ListTree(ctx, dir, hfg.TreeOptions{Recursive: recursive, Expand: long})
+	if err != nil {
+		return fmt.Errorf("could not list %s: %w", repoName, err)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if sortBy == "size" && files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	if asJSON {
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+	return app.printListing(files, long)
+}
+
+// printListing writes files as a table followed by a count and total size.
+func (app *cliApp) printListing(files []hfg.HFFile, long bool) error {
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	if long {
+		fmt.Fprintln(w, "SIZE\tLFS\tOID\tDATE\tCOMMIT\tPATH")
+	} else {
+		fmt.Fprintln(w, "SIZE\tLFS\tPATH")
+	}
+	var numFiles, numDirs int
+	var total int64
+	for _, f := range files {
+		size, lfs, oid, path := "-", "", shortOid(f.Oid), f.Path
+		if f.Type == "directory" {
+			numDirs++
+			path += "/"
+		} else {
+			numFiles++
+			total += f.Size
+			size = formatBytes(f.Size)
+		}
+		if f.LFS.IsLFS {
+			lfs, oid = "LFS", shortOid(f.LFS.Oid)
+		}
+		if !long {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", size, lfs, path)
+			continue
+		}
+		date, commit := "-", "-"
+		if c := f.LastCommit; c != nil {
+			date = c.Date.Format(time.DateOnly)
+			commit = truncateEnd(shortOid(c.ID)+" "+c.Title, 50)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", size, lfs, oid, date, commit, path)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.out, "%d files, %d directories, %s\n", numFiles, numDirs, formatBytes(total))
+	return nil
+}
+
+// shortOid abbreviates a git or LFS object id the way git log does.
+func shortOid(oid string) string {
+	if len(oid) > 10 {
+		return oid[:10]
+	}
+	return oid
+}
@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	hfg "github.com/drgo/hfget"
@@ -22,8 +25,8 @@ import (
 var VERSION = ""
 
 const (
-	moveUp    = "\033[A"
 	clearLine = "\r\033[2K"
+	clearDown = "\033[J" // Erase from the cursor to the end of the screen
 )
 
 // interface to facilitate testing
@@ -31,6 +34,15 @@ type downloader interface {
 	FetchRepoInfo(ctx context.Context) (*hfg.RepoInfo, error)
 	BuildPlan(ctx context.Context, repoInfo *hfg.RepoInfo) (*hfg.DownloadPlan, error)
 	ExecutePlan(ctx context.Context, plan *hfg.DownloadPlan) error
+	CheckPlan(ctx context.Context, plan *hfg.DownloadPlan) error
+	ListTree(ctx context.Context, dir string, opts hfg.TreeOptions) ([]hfg.HFFile, error)
+	InspectSafetensors(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.SafetensorsHeader, error)
+	InspectGGUF(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.GGUFHeader, error)
+	ValidateStructure(ctx context.Context) (*hfg.StructureReport, error)
+	Verify(ctx context.Context, repoInfo *hfg.RepoInfo) (*hfg.VerifyReport, error)
+	NewLockfile(repoInfo *hfg.RepoInfo) (*hfg.Lockfile, error)
+	ScanCache(ctx context.Context) ([]hfg.CachedRepo, error)
+	RemoveCached(ctx context.Context, repo hfg.CachedRepo) error
 }
 
 type realDownloader struct {
@@ -46,6 +58,33 @@ func (r *realDownloader) BuildPlan(ctx context.Context, repoInfo *hfg.RepoInfo)
 func (r *realDownloader) ExecutePlan(ctx context.Context, plan *hfg.DownloadPlan) error {
 	return r.Downloader.ExecutePlan(ctx, plan)
 }
+func (r *realDownloader) CheckPlan(ctx context.Context, plan *hfg.DownloadPlan) error {
+	return r.Downloader.CheckPlan(ctx, plan)
+}
+func (r *realDownloader) ListTree(ctx context.Context, dir string, opts hfg.TreeOptions) ([]hfg.HFFile, error) {
+	return r.Downloader.ListTree(ctx, dir, opts)
+}
+func (r *realDownloader) InspectSafetensors(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.SafetensorsHeader, error) {
+	return r.Downloader.InspectSafetensors(ctx, repoInfo)
+}
+func (r *realDownloader) InspectGGUF(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.GGUFHeader, error) {
+	return r.Downloader.InspectGGUF(ctx, repoInfo)
+}
+func (r *realDownloader) ValidateStructure(ctx context.Context) (*hfg.StructureReport, error) {
+	return r.Downloader.ValidateStructure(ctx)
+}
+func (r *realDownloader) Verify(ctx context.Context, repoInfo *hfg.RepoInfo) (*hfg.VerifyReport, error) {
+	return r.Downloader.Verify(ctx, repoInfo)
+}
+func (r *realDownloader) NewLockfile(repoInfo *hfg.RepoInfo) (*hfg.Lockfile, error) {
+	return r.Downloader.NewLockfile(repoInfo)
+}
+func (r *realDownloader) ScanCache(ctx context.Context) ([]hfg.CachedRepo, error) {
+	return r.Downloader.ScanCache(ctx)
+}
+func (r *realDownloader) RemoveCached(ctx context.Context, repo hfg.CachedRepo) error {
+	return r.Downloader.RemoveCached(ctx, repo)
+}
 
 type cliApp struct {
 	out           io.Writer
@@ -66,446 +105,306 @@ func main() {
 			return &realDownloader{Downloader: hfg.New(repoName, opts...)}
 		},
 	}
-	if err := app.run(os.Args[1:]); err != nil {
-		log.New(app.err, "", 0).Printf("Error:\n%v", err)
-		os.Exit(1)
+	ctx, stop := app.signalContext(context.Background())
+	err := app.run(ctx, os.Args[1:])
+	stop()
+	if err != nil {
+		var exitErr *exitError
+		if !errors.Is(err, context.Canceled) && !(errors.As(err, &exitErr) && exitErr.reported) {
+			log.New(app.err, "", 0).Printf("Error:\n%v", err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
-func (app *cliApp) run(args []string) error {
-	log.SetOutput(app.err)
-	log.SetFlags(0)
+// signalContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM so that in-flight work can stop cleanly and keep resumable data.
+// A second signal aborts the process immediately.
+func (app *cliApp) signalContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	sigCh := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
-	// --- FIX: Create a single reader to be used for all prompts ---
-	stdinReader := bufio.NewReader(os.Stdin)
-
-	var (
-		isDatasetFlag   bool
-		branch          string
-		dest            string
-		numConnections  int
-		token           string
-		skipChecksum    bool
-		maxRetries      int
-		retryInterval   time.Duration
-		quiet           bool
-		force           bool
-		useTree         bool
-		includePatterns string
-		excludePatterns string
-		showVersion     bool
-		verbose         bool
-	)
-
-	fs := flag.NewFlagSet("hfget", flag.ContinueOnError)
-	fs.SetOutput(app.err)
-
-	fs.BoolVar(&isDatasetFlag, "dataset", false, "Specify that the repo is a dataset")
-	fs.StringVar(&branch, "b", envOrDefault("HFGET_BRANCH", "main"), "Branch of the model or dataset ($HFGET_BRANCH)")
-	fs.StringVar(&dest, "d", envOrDefault("HFGET_DEST", "./"), "Destination path for downloads ($HFGET_DEST)")
-	defaultConnections, _ := strconv.Atoi(envOrDefault("HFGET_CONCURRENT_CONNECTIONS", "5"))
-	fs.IntVar(&numConnections, "c", defaultConnections, "Number of concurrent connections ($HFGET_CONCURRENT_CONNECTIONS)")
-	fs.StringVar(&token, "t", envOrDefault("HFGET_TOKEN", ""), "HuggingFace Auth Token ($HFGET_TOKEN)")
-	defaultSkipChecksum, _ := strconv.ParseBool(envOrDefault("HFGET_SKIP_CHECKSUM", "false"))
-	fs.BoolVar(&skipChecksum, "skip-checksum", defaultSkipChecksum, "Skip SHA256 checksum verification ($HFGET_SKIP_CHECKSUM)")
-	fs.IntVar(&maxRetries, "max-retries", 3, "Maximum number of retries")
-	fs.DurationVar(&retryInterval, "retry-interval", 5*time.Second, "Interval between retries")
-	fs.BoolVar(&quiet, "q", false, "Quiet mode (suppress progress display and prompts)")
-	fs.BoolVar(&force, "f", false, "Force re-download of all files, implies quiet mode")
-	fs.BoolVar(&useTree, "tree", false, "Use nested tree structure for output directory (e.g. 'org/model')")
-	fs.StringVar(&includePatterns, "include", "", "Comma-separated glob patterns for files to download")
-	fs.StringVar(&excludePatterns, "exclude", "", "Comma-separated glob patterns for files to exclude")
-	fs.BoolVar(&showVersion, "version", false, "Show version information")
-	fs.BoolVar(&verbose, "v", false, "Enable verbose diagnostic logging to stderr")
+	go func() {
+		select {
+		case <-sigCh:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(app.err, "\nInterrupt received, stopping after current writes are flushed (press Ctrl-C again to abort)...")
+		cancel()
+		select {
+		case <-sigCh:
+			fmt.Fprintln(app.err, "\nAborted.")
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
 
-	fs.Usage = func() {
-		fmt.Fprintf(app.err, "Usage: %s [options] model_or_dataset_name\n", os.Args[0])
-		fmt.Fprintln(app.err, "Example: hfget TheBloke/Llama-2-7B-GGUF --include \"*.gguf\"")
-		fmt.Fprintln(app.err, "Options:")
-		fs.PrintDefaults()
+	return ctx, func() {
+		signal.Stop(sigCh)
+		close(done)
+		cancel()
 	}
+}
 
-	if err := fs.Parse(args); err != nil {
-		return nil
+// prompt asks a yes/no question and reports whether the user answered "y".
+// It returns ctx.Err() if the context is cancelled while waiting for input.
+func (app *cliApp) prompt(ctx context.Context, reader *bufio.Reader, question string) (bool, error) {
+	fmt.Fprint(app.err, question)
+	answer := make(chan string, 1)
+	go func() {
+		input, _ := reader.ReadString('\n')
+		answer <- input
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(app.err)
+		return false, ctx.Err()
+	case input := <-answer:
+		return strings.TrimSpace(strings.ToLower(input)) == "y", nil
 	}
+}
 
-	if showVersion {
-		fmt.Fprintf(app.out, "hfget version %s\n", VERSION)
-		return nil
-	}
+// globalConfig holds the flags every command accepts. They may be given
+// before the command name or among the command's own flags.
+type globalConfig struct {
+	token   string
+	quiet   bool
+	verbose bool
+}
 
-	if fs.NArg() < 1 {
-		return errors.New("a model or dataset name argument is required")
-	}
-	repoName := fs.Arg(0)
+func newGlobalConfig() globalConfig {
+	return globalConfig{token: envOrDefault("HFGET_TOKEN", "")}
+}
 
-	if !app.isTerminal || force {
-		quiet = true
-	}
+// register adds the global flags to fs. The current values are the
+// defaults, so flags given before the command name carry over.
+func (g *globalConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.token, "t", g.token, "HuggingFace Auth Token ($HFGET_TOKEN)")
+	fs.BoolVar(&g.quiet, "q", g.quiet, "Quiet mode (suppress progress display and prompts)")
+	fs.BoolVar(&g.verbose, "v", g.verbose, "Enable verbose diagnostic logging to stderr")
+}
 
-	opts := []hfg.Option{
-		hfg.WithBranch(branch), hfg.WithDestination(dest), hfg.WithConnections(numConnections),
-	}
-	if isDatasetFlag {
+// repoConfig holds the flags of every command that reads a repository.
+type repoConfig struct {
+	globalConfig
+	isDataset bool
+	branch    string
+}
+
+// register adds the global and repository flags to fs.
+func (cfg *repoConfig) register(fs *flag.FlagSet) {
+	cfg.globalConfig.register(fs)
+	fs.BoolVar(&cfg.isDataset, "dataset", false, "Specify that the repo is a dataset")
+	fs.StringVar(&cfg.branch, "b", envOrDefault("HFGET_BRANCH", "main"), "Branch of the model or dataset ($HFGET_BRANCH)")
+}
+
+// options converts the repository flags into library options.
+func (cfg *repoConfig) options(app *cliApp) []hfg.Option {
+	opts := []hfg.Option{hfg.WithBranch(cfg.branch)}
+	if cfg.isDataset {
 		opts = append(opts, hfg.AsDataset())
 	}
-	if token != "" {
-		opts = append(opts, hfg.WithAuthToken(token))
-	}
-	if skipChecksum {
-		opts = append(opts, hfg.SkipSHACheck())
-	}
-	if force {
-		opts = append(opts, hfg.WithForceRedownload())
-	}
-	if useTree {
-		opts = append(opts, hfg.WithTreeStructure())
-	}
-	if includePatterns != "" {
-		opts = append(opts, hfg.WithIncludePatterns(strings.Split(includePatterns, ",")))
-	}
-	if excludePatterns != "" {
-		opts = append(opts, hfg.WithExcludePatterns(strings.Split(excludePatterns, ",")))
+	if cfg.token != "" {
+		opts = append(opts, hfg.WithAuthToken(cfg.token))
 	}
-	if verbose {
+	if cfg.verbose {
 		opts = append(opts, hfg.WithVerboseOutput(app.err))
 	}
+	return opts
+}
 
-	downloader := app.newDownloader(repoName, opts...)
-
-	fmt.Fprintln(app.err, "Fetching repository information...")
-	repoInfo, err := downloader.FetchRepoInfo(context.Background())
-	if err != nil {
-		return fmt.Errorf("could not fetch repository info: %w", err)
-	}
-
-	var wg sync.WaitGroup
-	var progressChan chan hfg.Progress
-	var totalAnalysisSize int64
-	for _, s := range repoInfo.Siblings {
-		if s.Type != "directory" {
-			totalAnalysisSize += s.Size
-		}
-	}
-
-	if !quiet {
-		progressChan = make(chan hfg.Progress, numConnections*2)
-		optsWithProgress := append(opts, hfg.WithProgressChannel(progressChan))
-		downloader = app.newDownloader(repoName, optsWithProgress...)
+// filterConfig holds the --include and --exclude flags.
+type filterConfig struct {
+	includePatterns string
+	excludePatterns string
+}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			analysisDisplayProgress(app.err, progressChan, app.terminalFd, totalAnalysisSize)
-		}()
-	}
+func (cfg *filterConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.includePatterns, "include", "", "Comma-separated patterns for files to download (globs with **, {a,b}, [..], trailing / for directories, ! to negate, re: for regex)")
+	fs.StringVar(&cfg.excludePatterns, "exclude", "", "Comma-separated patterns for files to exclude (same syntax as --include)")
+}
 
-	plan, err := downloader.BuildPlan(context.Background(), repoInfo)
-	if !quiet {
-		close(progressChan)
-		wg.Wait()
+func (cfg *filterConfig) options() []hfg.Option {
+	var opts []hfg.Option
+	if cfg.includePatterns != "" {
+		opts = append(opts, hfg.WithIncludePatterns(splitPatterns(cfg.includePatterns)))
 	}
-	if err != nil {
-		return fmt.Errorf("could not build download plan: %w", err)
+	if cfg.excludePatterns != "" {
+		opts = append(opts, hfg.WithExcludePatterns(splitPatterns(cfg.excludePatterns)))
 	}
+	return opts
+}
 
-	if len(plan.FilesToDownload) == 0 {
-		if len(plan.FilesToSkip) > 0 {
-			log.Printf("%d files are already present and valid (Total Size: %s).", len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize))
-		}
-		log.Println("Nothing to download.")
-
-		if !force && !quiet {
-			fmt.Fprint(app.err, "Would you like to force a re-download anyway? [y/N]: ")
-			// --- FIX: Use the shared reader ---
-			input, _ := stdinReader.ReadString('\n')
-			if strings.TrimSpace(strings.ToLower(input)) == "y" {
-				log.Println("Forcing re-download as requested...")
-				for _, skippedFile := range plan.FilesToSkip {
-					plan.FilesToDownload = append(plan.FilesToDownload, hfg.FileDownload{File: skippedFile.File, Reason: "forced re-download"})
-				}
-				plan.TotalDownloadSize += plan.TotalSkipSize
-				plan.FilesToSkip = nil
-				plan.TotalSkipSize = 0
-			} else {
-				log.Println("Exiting.")
-				return nil
-			}
-		} else {
-			return nil
-		}
-	}
+// destConfig holds the flags that say where repositories are stored.
+type destConfig struct {
+	dest    string
+	useTree bool
+}
 
-	if !quiet {
-		fmt.Fprintln(app.err, "----------------------------------------------------")
-		fmt.Fprintf(app.err, "Repository:    %s\n", plan.Repo.ID)
-		fmt.Fprintf(app.err, "Last Modified: %s\n", plan.Repo.LastModified.Format(time.RFC1123))
-		fmt.Fprintln(app.err, "----------------------------------------------------")
+func (cfg *destConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.dest, "d", envOrDefault("HFGET_DEST", "./"), "Destination path for downloads ($HFGET_DEST)")
+	fs.BoolVar(&cfg.useTree, "tree", false, "Use nested tree structure for output directory (e.g. 'org/model')")
+}
 
-		if len(plan.FilesToSkip) > 0 {
-			fmt.Fprintf(app.err, "%d files already present and valid (Total: %s) will be skipped.\n", len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize))
-		}
+func (cfg *destConfig) options() []hfg.Option {
+	opts := []hfg.Option{hfg.WithDestination(cfg.dest)}
+	if cfg.useTree {
+		opts = append(opts, hfg.WithTreeStructure())
+	}
+	return opts
+}
 
-		filesByReason := make(map[string][]hfg.FileDownload)
-		for _, f := range plan.FilesToDownload {
-			filesByReason[f.Reason] = append(filesByReason[f.Reason], f)
-		}
+// commandInfo describes a subcommand for usage messages.
+type commandInfo struct {
+	name    string
+	args    string // Synopsis of the arguments after the command name
+	summary string
+	example string
+}
 
-		for reason, files := range filesByReason {
-			fmt.Fprintf(app.err, "Files to download (Reason: %s):\n", reason)
-			for _, file := range files {
-				fmt.Fprintf(app.err, "  - %-60s (%s)\n", file.File.Path, formatBytes(file.File.Size))
-			}
-		}
+// commands lists the subcommands in the order usage shows them.
+var commands = []commandInfo{
+	{"download", "[options] model_or_dataset_name", "Download a model or dataset (the default command)",
+		`hfget download TheBloke/Llama-2-7B-GGUF --include "*.gguf"`},
+	{"ls", "[options] model_or_dataset_name [path]", "List the files in a repository with their sizes, without building a plan",
+		`hfget ls -l --sort size --include "*.gguf" TheBloke/Llama-2-7B-GGUF`},
+	{"info", "[options] model_or_dataset_name", "Show a repository's metadata, license and size by file type",
+		"hfget info meta-llama/Llama-3.1-8B"},
+	{"inspect", "[options] model_or_dataset_name", "Read safetensors and GGUF headers remotely: dtypes, parameters, quantization and metadata",
+		"hfget inspect --tensors mistralai/Mistral-7B-v0.1"},
+	{"verify", "[options] model_or_dataset_name", "Check a local copy against the Hub or a lockfile, or its safetensors structure, without downloading",
+		"hfget verify --lock hfget.lock --format junit -d ./models mistralai/Mistral-7B-v0.1"},
+	{"plan", "[--json] [options] model_or_dataset_name", "Show what a download would do without changing anything",
+		"hfget plan --json TheBloke/Llama-2-7B-GGUF > plan.json"},
+	{"apply", "[options] plan.json", "Execute a plan written by 'plan --json' against the revision it was built for",
+		"hfget apply plan.json"},
+	{"cache", "list|du|rm|prune [options]", "Manage downloaded repositories: list them, show disk usage, delete or prune them",
+		"hfget cache list -d ./models"},
+	{"version", "", "Show version information", ""},
+	{"help", "[command]", "Show help for a command", ""},
+}
 
-		fmt.Fprintln(app.err, "----------------------------------------------------")
-		fmt.Fprintf(app.err, "Total download size: %s\n", formatBytes(plan.TotalDownloadSize))
-		fmt.Fprint(app.err, "Proceed with download? [y/N]: ")
+func (app *cliApp) run(ctx context.Context, args []string) error {
+	log.SetOutput(app.err)
+	log.SetFlags(0)
 
-		// --- FIX: Use the shared reader ---
-		input, _ := stdinReader.ReadString('\n')
-		if strings.TrimSpace(strings.ToLower(input)) != "y" {
-			log.Println("Download cancelled by user.")
+	g := newGlobalConfig()
+	var showVersion bool
+	fs := flag.NewFlagSet("hfget", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	g.register(fs)
+	fs.BoolVar(&showVersion, "version", false, "Show version information")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			app.usage()
 			return nil
 		}
+		// Download flags before the repository name, as in "hfget -f org/model".
+		return app.runDownload(ctx, newGlobalConfig(), args)
 	}
-
-	if !quiet {
-		progressChan = make(chan hfg.Progress, numConnections*2)
-		optsWithProgress := append(opts, hfg.WithProgressChannel(progressChan))
-		downloader = app.newDownloader(repoName, optsWithProgress...)
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			downloadDisplayProgress(app.err, progressChan, app.terminalFd, plan)
-		}()
+	if showVersion {
+		return app.runVersion(nil)
 	}
-
-	log.Println("Starting download...")
-	var lastErr error
-	for i := 0; i < maxRetries; i++ {
-		if i > 0 {
-			log.Printf("Retrying after transient error (attempt %d/%d)...", i+1, maxRetries)
-			time.Sleep(retryInterval)
+	if fs.NArg() < 1 {
+		app.usage()
+		return usageErrorf("a command or a model or dataset name argument is required")
+	}
+
+	rest := fs.Args()[1:]
+	switch fs.Arg(0) {
+	case "download":
+		return app.runDownload(ctx, g, rest)
+	case "ls":
+		return app.runLs(ctx, g, rest)
+	case "info":
+		return app.runInfo(ctx, g, rest)
+	case "inspect":
+		return app.runInspect(ctx, g, rest)
+	case "verify":
+		return app.runVerify(ctx, g, rest)
+	case "plan":
+		return app.runPlan(ctx, g, rest)
+	case "apply":
+		return app.runApply(ctx, g, rest)
+	case "cache":
+		return app.runCache(ctx, g, rest)
+	case "version":
+		return app.runVersion(rest)
+	case "help":
+		if len(rest) == 0 {
+			app.usage()
+			return nil
 		}
-		lastErr = downloader.ExecutePlan(context.Background(), plan)
-		if lastErr == nil || !isTransientError(lastErr) {
-			break
+		name := strings.Join(rest, " ")
+		if findCommand(name) == nil || name == "help" {
+			return usageErrorf("unknown command %q", name)
 		}
+		return app.run(ctx, append(rest, "-h"))
+	default:
+		// "hfget org/model" is short for "hfget download org/model".
+		return app.runDownload(ctx, g, fs.Args())
 	}
-
-	if !quiet {
-		close(progressChan)
-		wg.Wait()
-	}
-
-	if lastErr != nil {
-		return lastErr
-	}
-
-	log.Printf("\nDownload of %s completed.", repoName)
-	return nil
 }
 
-type fileProgressState struct {
-	processedBytes int64
-	totalSize      int64
-	state          hfg.ProgressState
+// usage prints the list of commands and the global flags.
+func (app *cliApp) usage() {
+	fmt.Fprintf(app.err, "Usage: %s [global options] <command> [options] [arguments]\n", os.Args[0])
+	fmt.Fprintf(app.err, "       %s [options] model_or_dataset_name (same as \"download\")\n", os.Args[0])
+	fmt.Fprintln(app.err, "\nCommands:")
+	w := tabwriter.NewWriter(app.err, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(app.err, "\nGlobal options:")
+	g := newGlobalConfig()
+	fs := flag.NewFlagSet("hfget", flag.ContinueOnError)
+	fs.SetOutput(app.err)
+	g.register(fs)
+	fs.PrintDefaults()
+	fmt.Fprintf(app.err, "\nRun '%s help <command>' for the options of a command.\n", os.Args[0])
 }
 
-func analysisDisplayProgress(out io.Writer, progressChan <-chan hfg.Progress, fd int, totalAnalysisSize int64) {
-	fileStates := make(map[string]*fileProgressState)
-	var lastActiveFile string
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case pr, ok := <-progressChan:
-			if !ok {
-				fmt.Fprint(out, clearLine)
-				fmt.Fprintln(out, "Analysis complete.")
-				return
+func findCommand(name string) *commandInfo {
+	for _, list := range [][]commandInfo{commands, cacheCommands} {
+		for i := range list {
+			if list[i].name == name {
+				return &list[i]
 			}
-			lastActiveFile = pr.Filepath
-
-			state, exists := fileStates[pr.Filepath]
-			if !exists {
-				state = &fileProgressState{totalSize: pr.TotalSize}
-				fileStates[pr.Filepath] = state
-			}
-
-			state.processedBytes = pr.CurrentSize
-
-		case <-ticker.C:
-			width, _, _ := term.GetSize(fd)
-			if width <= 0 {
-				width = 90
-			}
-
-			var totalVerifiedBytes int64
-			for _, state := range fileStates {
-				totalVerifiedBytes += state.processedBytes
-			}
-
-			percent := 0.0
-			if totalAnalysisSize > 0 {
-				percent = (float64(totalVerifiedBytes) * 100) / float64(totalAnalysisSize)
-			}
-
-			if percent > 100.0 {
-				percent = 100.0
-			}
-
-			fmt.Fprint(out, clearLine)
-			fmt.Fprintf(out, "Analyzing (%.1f%%): Verifying %s", percent, truncateString(lastActiveFile, width-30))
 		}
 	}
+	return nil
 }
 
-type speedSample struct {
-	t     time.Time
-	bytes int64
-}
-
-func downloadDisplayProgress(out io.Writer, progressChan <-chan hfg.Progress, fd int, plan *hfg.DownloadPlan) {
-	totalDownloadSize := plan.TotalDownloadSize
-	var totalDownloaded, recentBytes int64
-	fileStates := make(map[string]*fileProgressState)
-	for _, f := range plan.FilesToDownload {
-		fileStates[f.File.Path] = &fileProgressState{totalSize: f.File.Size}
+// newFlagSet returns an empty flag set for the named command whose usage
+// message shows the command's synopsis, summary and example.
+func (app *cliApp) newFlagSet(name string) *flag.FlagSet {
+	c := findCommand(name)
+	fs := flag.NewFlagSet("hfget "+name, flag.ContinueOnError)
+	fs.SetOutput(app.err)
+	fs.Usage = func() {
+		fmt.Fprintf(app.err, "Usage: %s %s %s\n", os.Args[0], c.name, c.args)
+		fmt.Fprintln(app.err, c.summary)
+		if c.example != "" {
+			fmt.Fprintln(app.err, "Example:", c.example)
+		}
+		fmt.Fprintln(app.err, "Options:")
+		fs.PrintDefaults()
 	}
+	return fs
+}
 
-	downloadStartTime := time.Now()
-	var speedSamples []speedSample
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	var linesPrinted int
-
-	for {
-		select {
-		case pr, ok := <-progressChan:
-			if !ok {
-				fmt.Fprint(out, clearLine)
-				if linesPrinted > 1 {
-					fmt.Fprint(out, moveUp+clearLine)
-				}
-				fmt.Fprint(out, "\r")
-				fmt.Printf("Overall: 100.0%% (%s/%s) | Complete.\n\n", formatBytes(totalDownloadSize), formatBytes(totalDownloadSize))
-				return
-			}
-			state, exists := fileStates[pr.Filepath]
-			if !exists {
-				continue
-			}
-			state.state = pr.State
-
-			switch pr.State {
-			case hfg.ProgressStateDownloading:
-				if pr.CurrentSize > state.processedBytes {
-					delta := pr.CurrentSize - state.processedBytes
-					totalDownloaded += delta
-					recentBytes += delta
-				}
-				state.processedBytes = pr.CurrentSize
-
-			case hfg.ProgressStateComplete, hfg.ProgressStateVerified:
-				if state.processedBytes < state.totalSize {
-					delta := state.totalSize - state.processedBytes
-					totalDownloaded += delta
-				}
-				state.processedBytes = state.totalSize
-			}
-
-		case <-ticker.C:
-			width, _, _ := term.GetSize(fd)
-			if width <= 0 {
-				width = 90
-			}
-
-			if linesPrinted > 0 {
-				fmt.Fprint(out, clearLine)
-				if linesPrinted > 1 {
-					fmt.Fprint(out, moveUp+clearLine)
-				}
-				fmt.Fprint(out, "\r")
-			}
-
-			now := time.Now()
-			if recentBytes > 0 {
-				speedSamples = append(speedSamples, speedSample{t: now, bytes: recentBytes})
-				recentBytes = 0
-			}
-			cutoff := now.Add(-5 * time.Second)
-			firstValidIndex := -1
-			for i, sample := range speedSamples {
-				if !sample.t.Before(cutoff) {
-					firstValidIndex = i
-					break
-				}
-			}
-			if firstValidIndex > 0 {
-				speedSamples = speedSamples[firstValidIndex:]
-			} else if firstValidIndex == -1 && len(speedSamples) > 0 && now.Sub(speedSamples[0].t) > 5*time.Second {
-				speedSamples = nil
-			}
-
-			var currentSpeedBytes int64
-			for _, sample := range speedSamples {
-				currentSpeedBytes += sample.bytes
-			}
-			currentSpeed := float64(currentSpeedBytes) / 5.0
-
-			elapsed := time.Since(downloadStartTime).Seconds()
-			if elapsed < 0.1 {
-				elapsed = 0.1
-			}
-			avgSpeed := float64(totalDownloaded) / elapsed
-
-			overallPercent := 0.0
-			if totalDownloadSize > 0 {
-				overallPercent = (float64(totalDownloaded) * 100) / float64(totalDownloadSize)
-			}
-			line1 := fmt.Sprintf("Overall: %.1f%% (%s/%s) | Avg: %s | Current: %s",
-				overallPercent, formatBytes(totalDownloaded), formatBytes(totalDownloadSize),
-				formatSpeed(avgSpeed), formatSpeed(currentSpeed))
-
-			var activeFile string
-			var activeState *fileProgressState
-			for _, f := range plan.FilesToDownload {
-				state := fileStates[f.File.Path]
-				if state != nil && state.state == hfg.ProgressStateDownloading {
-					activeFile = f.File.Path
-					activeState = state
-					break
-				}
-			}
-
-			var line2 string
-			if activeState != nil && activeFile != "" {
-				filePercent := 0.0
-				if activeState.totalSize > 0 {
-					filePercent = (float64(activeState.processedBytes) * 100) / float64(activeState.totalSize)
-				}
-				line2 = fmt.Sprintf("File: %s [%.1f%%]",
-					truncateString(activeFile, width-20), filePercent)
-			} else {
-				line2 = "Finalizing..."
-			}
-			if len(line1) > width {
-				line1 = line1[:width]
-			}
-			if len(line2) > width {
-				line2 = line2[:width]
-			}
-
-			fmt.Fprintln(out, line1)
-			fmt.Fprint(out, line2)
-			linesPrinted = 2
-		}
+// runVersion implements "hfget version".
+func (app *cliApp) runVersion(args []string) error {
+	fs := app.newFlagSet("version")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
 	}
+	fmt.Fprintf(app.out, "hfget version %s\n", VERSION)
+	return nil
 }
 
 func envOrDefault(key, defaultValue string) string {
@@ -522,6 +421,11 @@ func isTransientError(err error) bool {
 	if errors.Is(err, hfg.ErrAuthentication) || errors.Is(err, hfg.ErrForbidden) || errors.Is(err, hfg.ErrNotFound) {
 		return false
 	}
+	// The library has already given up on the failed files; running the
+	// plan again would download the files that succeeded a second time.
+	if errors.Is(err, hfg.ErrPartialDownload) {
+		return false
+	}
 	
 	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
 		return true
@@ -548,6 +452,124 @@ func formatBytes(b int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// splitPatterns splits a comma-separated --include or --exclude value.
+// Commas inside braces or brackets belong to the pattern, so "*.{json,txt}"
+// and "re:^a{1,2}" stay whole.
+func splitPatterns(s string) []string {
+	var patterns []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				if p := strings.TrimSpace(s[start:i]); p != "" {
+					patterns = append(patterns, p)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if p := strings.TrimSpace(s[start:]); p != "" {
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// parseSize parses a human-readable byte count such as "512K", "50M",
+// "1.5GB" or "2GiB". Suffixes use binary (1024-based) multiples, matching
+// formatBytes; a bare number is a count of bytes.
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I")
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		if i := strings.IndexByte("KMGTPE", str[n-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			str = str[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || math.IsNaN(value) || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits.
+	if value*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// parseRateSchedule parses a comma-separated list of "HH:MM-HH:MM=RATE"
+// windows. A rate of 0 means unlimited during that window.
+func parseRateSchedule(s string) ([]hfg.RateWindow, error) {
+	var windows []hfg.RateWindow
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		span, rateStr, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("window %q is missing '=RATE'", part)
+		}
+		startStr, endStr, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("window %q must look like HH:MM-HH:MM=RATE", part)
+		}
+		start, err := parseClock(startStr)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(endStr)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := parseSize(rateStr)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, hfg.RateWindow{Start: start, End: end, BytesPerSec: rate})
+	}
+	return windows, nil
+}
+
+// parseAge parses a duration that may also be given in days or weeks, such
+// as "30d" or "2w".
+func parseAge(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(str, suffix); ok {
+			value, err := strconv.ParseFloat(n, 64)
+			if err != nil || value < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(value * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. '30d', '2w' or '12h')", s)
+	}
+	return d, nil
+}
+
+// parseClock converts "HH:MM" into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (want HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 func formatSpeed(s float64) string {
 	if s < 1 {
 		return "0"
@@ -555,10 +577,29 @@ func formatSpeed(s float64) string {
 	return formatBytes(int64(s)) + "/s"
 }
 
+// truncateString shortens s to at most maxLen characters by replacing its
+// beginning with "...", which keeps the more telling end of a path.
 func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	r := []rune(s)
+	if len(r) <= maxLen {
 		return s
 	}
-	return "..." + s[len(s)-maxLen+3:]
+	if maxLen <= 3 {
+		return string(r[len(r)-max(maxLen, 0):])
+	}
+	return "..." + string(r[len(r)-maxLen+3:])
+}
+
+// truncateEnd is truncateString for text whose beginning matters most, such
+// as a commit title.
+func truncateEnd(s string, maxLen int) string {
+	r := []rune(s)
+	if len(r) <= maxLen {
+		return s
+	}
+	if maxLen <= 3 {
+		return string(r[:max(maxLen, 0)])
+	}
+	return string(r[:maxLen-3]) + "..."
 }
 
@@ -3,11 +3,19 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	hfg "github.com/drgo/hfget"
 	"github.com/drgo/hfget/testutils"
@@ -16,16 +24,31 @@ import (
 type mockDownloader struct {
 	repoInfoToReturn *hfg.RepoInfo
 	planToReturn     *hfg.DownloadPlan
+	treeToReturn     []hfg.HFFile
+	headersToReturn  []hfg.SafetensorsHeader
+	ggufToReturn     []hfg.GGUFHeader
+	structureReport  *hfg.StructureReport
+	verifyReport     *hfg.VerifyReport
+	cachedRepos      []hfg.CachedRepo
+	progress         chan<- hfg.Progress // Set by tests that capture WithProgressChannel
+	progressUpdates  []hfg.Progress      // Sent to progress by each ExecutePlan call
 
 	// Specific errors for each phase
 	fetchErr   error
 	buildErr   error
 	executeErr error
+	checkErr   error
+	inspectErr error
 
 	// Track calls
 	fetchRepoInfoCalls int
 	buildPlanCalls     int
 	executePlanCalls   int
+	checkPlanCalls     int
+	listTreeDir        string
+	listTreeOpts       hfg.TreeOptions
+	verifiedRepo       *hfg.RepoInfo
+	removed            []string
 
 	// For retry tests
 	executePlanFailures int
@@ -49,12 +72,64 @@ func (m *mockDownloader) BuildPlan(ctx context.Context, repoInfo *hfg.RepoInfo)
 
 func (m *mockDownloader) ExecutePlan(ctx context.Context, plan *hfg.DownloadPlan) error {
 	m.executePlanCalls++
+	if m.progress != nil {
+		for _, p := range m.progressUpdates {
+			m.progress <- p
+		}
+	}
 	if m.executePlanCalls <= m.executePlanFailures {
 		return m.executeErr
 	}
 	return nil
 }
 
+func (m *mockDownloader) CheckPlan(ctx context.Context, plan *hfg.DownloadPlan) error {
+	m.checkPlanCalls++
+	return m.checkErr
+}
+
+func (m *mockDownloader) ListTree(ctx context.Context, dir string, opts hfg.TreeOptions) ([]hfg.HFFile, error) {
+	m.listTreeDir, m.listTreeOpts = dir, opts
+	return slices.Clone(m.treeToReturn), m.fetchErr
+}
+
+func (m *mockDownloader) InspectSafetensors(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.SafetensorsHeader, error) {
+	return m.headersToReturn, m.inspectErr
+}
+
+func (m *mockDownloader) InspectGGUF(ctx context.Context, repoInfo *hfg.RepoInfo) ([]hfg.GGUFHeader, error) {
+	return m.ggufToReturn, nil
+}
+
+func (m *mockDownloader) Verify(ctx context.Context, repoInfo *hfg.RepoInfo) (*hfg.VerifyReport, error) {
+	m.verifiedRepo = repoInfo
+	if m.verifyReport == nil {
+		return &hfg.VerifyReport{Repo: repoInfo.ID}, nil
+	}
+	return m.verifyReport, nil
+}
+
+// NewLockfile has no side effects, so the mock uses the real one.
+func (m *mockDownloader) NewLockfile(repoInfo *hfg.RepoInfo) (*hfg.Lockfile, error) {
+	return hfg.New(repoInfo.ID).NewLockfile(repoInfo)
+}
+
+func (m *mockDownloader) ScanCache(ctx context.Context) ([]hfg.CachedRepo, error) {
+	return slices.Clone(m.cachedRepos), nil
+}
+
+func (m *mockDownloader) RemoveCached(ctx context.Context, repo hfg.CachedRepo) error {
+	m.removed = append(m.removed, repo.Repo)
+	return nil
+}
+
+func (m *mockDownloader) ValidateStructure(ctx context.Context) (*hfg.StructureReport, error) {
+	if m.structureReport == nil {
+		return &hfg.StructureReport{}, nil
+	}
+	return m.structureReport, nil
+}
+
 // mockStdin is a helper to simulate user input for interactive prompts.
 func mockStdin(t *testing.T, input string) (restore func()) {
 	t.Helper()
@@ -89,7 +164,7 @@ func TestCLI(t *testing.T) {
 	t.Run("Missing repository argument", func(t *testing.T) {
 		require := testutils.NewRequire(t)
 		app := &cliApp{out: &bytes.Buffer{}, err: &bytes.Buffer{}}
-		err := app.run([]string{})
+		err := app.run(context.Background(), []string{})
 		require.Error(err, "Expected an error for missing argument, but got none")
 		require.True(strings.Contains(err.Error(), "argument is required"), "Expected error message to contain 'argument is required', got: %v", err)
 	})
@@ -109,7 +184,7 @@ func TestCLI(t *testing.T) {
 		}
 
 		// Use -f for force
-		err := app.run([]string{"-f", "test/repo"})
+		err := app.run(context.Background(), []string{"-f", "test/repo"})
 		require.NoError(err, "Expected no error for forced download")
 		// There should be no interactive prompt in the output
 		assert.False(strings.Contains(out.String(), "Proceed with download? [y/N]:"), "Expected force flag to skip the confirmation prompt")
@@ -131,7 +206,7 @@ func TestCLI(t *testing.T) {
 			newDownloader: func(string, ...hfg.Option) downloader { return mock },
 		}
 
-		err := app.run([]string{"test/repo"})
+		err := app.run(context.Background(), []string{"test/repo"})
 		require.NoError(err, "Expected no error when no files need downloading, got: %v", err)
 		assert.True(strings.Contains(app.err.(*bytes.Buffer).String(), "Nothing to download."), "Expected to see the 'Nothing to download' message")
 		assert.True(mock.executePlanCalls == 0, "Expected ExecutePlan to not be called, but was called %d times", mock.executePlanCalls)
@@ -162,7 +237,7 @@ func TestCLI(t *testing.T) {
 			newDownloader: func(string, ...hfg.Option) downloader { return mock },
 		}
 
-		err := app.run([]string{"test/repo"})
+		err := app.run(context.Background(), []string{"test/repo"})
 		require.NoError(err, "Expected no error after re-download confirmation, got: %v", err)
 
 		assert.True(strings.Contains(errOut.String(), "Would you like to force a re-download anyway?"), "Expected the interactive re-download prompt to be shown")
@@ -187,13 +262,36 @@ func TestCLI(t *testing.T) {
 		}
 
 		// Use a very short retry interval for the test and force flag to skip prompts
-		err := app.run([]string{"--retry-interval", "1ms", "-f", "test/repo"})
+		err := app.run(context.Background(), []string{"--retry-interval", "1ms", "-f", "test/repo"})
 		require.NoError(err, "Expected no final error after retry, got: %v", err)
 
 		assert.True(mock.executePlanCalls == 2, "Expected ExecutePlan to be called 2 times, but was called %d times", mock.executePlanCalls)
 		assert.True(strings.Contains(app.err.(*bytes.Buffer).String(), "Retrying after transient error"), "Expected to see the retry attempt message in the logs")
 	})
 
+	t.Run("Cancelled context stops before executing", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{
+			repoInfoToReturn: defaultRepoInfo,
+			planToReturn:     defaultPlan,
+		}
+		errOut := &bytes.Buffer{}
+		app := &cliApp{
+			out:           &bytes.Buffer{},
+			err:           errOut,
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := app.run(ctx, []string{"-f", "test/repo"})
+		require.Error(err, "Expected an error for a cancelled run")
+		assert.True(errors.Is(err, context.Canceled), "Expected context.Canceled, got: %v", err)
+		assert.True(mock.executePlanCalls == 0, "Expected ExecutePlan not to be called, but was called %d times", mock.executePlanCalls)
+		assert.True(strings.Contains(errOut.String(), "run the same command again to resume"), "Expected a resume hint in the output")
+	})
+
 	t.Run("No retry on fatal error", func(t *testing.T) {
 		require := testutils.NewRequire(t)
 		assert := testutils.NewAssert(t)
@@ -210,9 +308,827 @@ func TestCLI(t *testing.T) {
 			newDownloader: func(string, ...hfg.Option) downloader { return mock },
 		}
 
-		err := app.run([]string{"-f", "test/repo"})
+		err := app.run(context.Background(), []string{"-f", "test/repo"})
 		require.Error(err, "Expected a fatal error, but got none")
 
 		assert.True(mock.executePlanCalls == 1, "Expected ExecutePlan to be called only once, but was called %d times", mock.executePlanCalls)
 	})
 }
+
+func TestProgressJSON(t *testing.T) {
+	plan := &hfg.DownloadPlan{
+		RepoName: "test/repo",
+		Revision: "main",
+		Repo:     &hfg.RepoInfo{ID: "test/repo", SHA: "abc123"},
+		FilesToDownload: []hfg.FileDownload{
+			{File: hfg.HFFile{Path: "a.bin", Size: 100}},
+			{File: hfg.HFFile{Path: "b.bin", Size: 50}},
+		},
+		TotalDownloadSize: 150,
+	}
+	run := func(t *testing.T, mock *mockDownloader, args ...string) ([]map[string]any, error) {
+		out := &bytes.Buffer{}
+		app := &cliApp{
+			out: out,
+			err: &bytes.Buffer{},
+			newDownloader: func(name string, opts ...hfg.Option) downloader {
+				if p := hfg.New(name, opts...).Progress; p != nil {
+					mock.progress = p
+				}
+				return mock
+			},
+		}
+		err := app.run(context.Background(), append([]string{"download", "--progress", "json"}, args...))
+		var events []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var e map[string]any
+			if jsonErr := json.Unmarshal([]byte(line), &e); jsonErr != nil {
+				t.Fatalf("Invalid event line %q: %v", line, jsonErr)
+			}
+			events = append(events, e)
+		}
+		return events, err
+	}
+	names := func(events []map[string]any) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e["event"].(string))
+		}
+		return out
+	}
+
+	t.Run("success", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{planToReturn: plan, progressUpdates: []hfg.Progress{
+			{Filepath: "a.bin", State: hfg.ProgressStateDownloading, CurrentSize: 40, TotalSize: 100},
+			{Filepath: "a.bin", State: hfg.ProgressStateComplete, CurrentSize: 100, TotalSize: 100},
+			{Filepath: "a.bin", State: hfg.ProgressStateVerified, CurrentSize: 100, TotalSize: 100, Message: "sha256"},
+			{Filepath: "b.bin", State: hfg.ProgressStateDownloading, CurrentSize: 0, TotalSize: 50},
+			{Filepath: "b.bin", State: hfg.ProgressStateFailed, TotalSize: 50, Message: "checksum mismatch"},
+		}}
+		events, err := run(t, mock, "test/repo")
+		require.NoError(err, "")
+		want := []string{"plan", "file_start", "file_verified", "file_start", "file_failed", "done"}
+		got := names(events)
+		assert.True(slices.Equal(got, want), "Events = %v, want %v", got, want)
+		if len(events) != len(want) {
+			return
+		}
+		assert.True(events[0]["commit"] == "abc123" && events[0]["files"] == 2.0 && events[0]["v"] == 1.0, "Unexpected plan event %v", events[0])
+		assert.True(events[1]["path"] == "a.bin" && events[1]["offset"] == 40.0, "Unexpected file_start %v", events[1])
+		assert.True(events[2]["method"] == "sha256", "Unexpected file_verified %v", events[2])
+		assert.True(events[4]["error"] == "checksum mismatch", "Unexpected file_failed %v", events[4])
+		done := events[5]
+		assert.True(done["status"] == "ok" && done["verifiedFiles"] == 1.0 && done["failedFiles"] == 1.0 && done["bytes"] == 100.0,
+			"Unexpected done event %v", done)
+	})
+
+	t.Run("retry and failure", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{planToReturn: plan, executeErr: os.ErrDeadlineExceeded, executePlanFailures: 5}
+		events, err := run(t, mock, "--retry-interval", "1ms", "--max-retries", "2", "test/repo")
+		assert.Error(err, "Expected the download to fail")
+		got := names(events)
+		assert.True(slices.Equal(got, []string{"plan", "retry", "done"}), "Events = %v", got)
+		if len(events) == 3 {
+			assert.True(events[1]["attempt"] == 2.0 && events[1]["maxAttempts"] == 2.0, "Unexpected retry event %v", events[1])
+			assert.True(events[2]["status"] == "failed" && events[2]["error"] != nil, "Unexpected done event %v", events[2])
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		app := &cliApp{out: &bytes.Buffer{}, err: &bytes.Buffer{}, newDownloader: func(string, ...hfg.Option) downloader { return &mockDownloader{} }}
+		err := app.run(context.Background(), []string{"download", "--progress", "fancy", "test/repo"})
+		testutils.NewAssert(t).Error(err, "Expected an error for an unknown --progress mode")
+	})
+}
+
+func TestSubcommands(t *testing.T) {
+	plan := &hfg.DownloadPlan{
+		Repo:              &hfg.RepoInfo{ID: "test/repo", LastModified: time.Now()},
+		FilesToDownload:   []hfg.FileDownload{{File: hfg.HFFile{Path: "file1.txt", Size: 1024}}},
+		TotalDownloadSize: 1024,
+	}
+	newApp := func(mock *mockDownloader, gotRepo *string) (*cliApp, *bytes.Buffer, *bytes.Buffer) {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		return &cliApp{
+			out:        out,
+			err:        errOut,
+			isTerminal: true,
+			newDownloader: func(repo string, opts ...hfg.Option) downloader {
+				*gotRepo = repo
+				return mock
+			},
+		}, out, errOut
+	}
+
+	for _, args := range [][]string{
+		{"-q", "test/repo"},
+		{"download", "-q", "test/repo"},
+		{"-q", "download", "test/repo"},
+		{"-q", "-b", "dev", "test/repo"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			require := testutils.NewRequire(t)
+			assert := testutils.NewAssert(t)
+			var gotRepo string
+			mock := &mockDownloader{planToReturn: plan}
+			app, _, errOut := newApp(mock, &gotRepo)
+			err := app.run(context.Background(), args)
+			require.NoError(err, "")
+			assert.True(gotRepo == "test/repo", "Expected test/repo to be downloaded, got %q", gotRepo)
+			assert.True(mock.executePlanCalls == 1, "Expected ExecutePlan to be called once, but was called %d times", mock.executePlanCalls)
+			assert.False(strings.Contains(errOut.String(), "Proceed with download?"), "Expected -q to skip the prompt")
+		})
+	}
+
+	t.Run("help lists commands", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		var gotRepo string
+		app, _, errOut := newApp(&mockDownloader{}, &gotRepo)
+		require.NoError(app.run(context.Background(), []string{"help"}), "")
+		for _, c := range commands {
+			assert.True(strings.Contains(errOut.String(), c.name), "Expected %q in the usage", c.name)
+		}
+
+		errOut.Reset()
+		require.NoError(app.run(context.Background(), []string{"help", "plan"}), "")
+		assert.True(strings.Contains(errOut.String(), "-json"), "Expected the plan flags, got: %s", errOut.String())
+		assert.Error(app.run(context.Background(), []string{"help", "nope"}), "Expected an error for an unknown command")
+		assert.True(gotRepo == "", "help must not download anything")
+	})
+
+	t.Run("version", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		var gotRepo string
+		for _, args := range [][]string{{"version"}, {"--version"}} {
+			app, out, _ := newApp(&mockDownloader{}, &gotRepo)
+			require.NoError(app.run(context.Background(), args), "")
+			assert.True(strings.HasPrefix(out.String(), "hfget version"), "Unexpected output for %v: %q", args, out.String())
+		}
+	})
+}
+
+func TestPlanAndApply(t *testing.T) {
+	dir := t.TempDir()
+	plan := &hfg.DownloadPlan{
+		Version:   1,
+		RepoName:  "test/repo",
+		Revision:  "main",
+		ModelPath: filepath.Join(dir, "repo"),
+		Repo:      &hfg.RepoInfo{ID: "test/repo", SHA: "abc123", LastModified: time.Now()},
+		FilesToDownload: []hfg.FileDownload{
+			{File: hfg.HFFile{Path: "file1.txt", Size: 1024}, Reason: hfg.ReasonMissing},
+		},
+		TotalDownloadSize: 1024,
+	}
+
+	t.Run("plan --json writes the plan to stdout", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		out := &bytes.Buffer{}
+		mock := &mockDownloader{planToReturn: plan}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), []string{"plan", "--json", "test/repo"})
+		require.NoError(err, "")
+		assert.True(mock.executePlanCalls == 0, "plan must not execute anything")
+
+		got, err := hfg.ReadPlan(out)
+		require.NoError(err, "Output should be a readable plan: %s", out.String())
+		assert.True(got.Repo.SHA == "abc123", "Expected the commit to round-trip, got %q", got.Repo.SHA)
+		require.Len(got.FilesToDownload, 1, "")
+	})
+
+	writePlan := func(t *testing.T) string {
+		var buf bytes.Buffer
+		if err := plan.WriteJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "plan.json")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("apply executes without prompting", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		path := writePlan(t)
+		mock := &mockDownloader{}
+		var gotRepo string
+		app := &cliApp{
+			out: &bytes.Buffer{},
+			err: &bytes.Buffer{},
+			newDownloader: func(repo string, opts ...hfg.Option) downloader {
+				gotRepo = repo
+				return mock
+			},
+		}
+		err := app.run(context.Background(), []string{"apply", path})
+		require.NoError(err, "")
+		assert.True(gotRepo == "test/repo", "Expected the repo from the plan, got %q", gotRepo)
+		assert.True(mock.checkPlanCalls == 1, "Expected CheckPlan to be called once")
+		assert.True(mock.executePlanCalls == 1, "Expected ExecutePlan to be called once")
+	})
+
+	t.Run("apply refuses a stale plan", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		path := writePlan(t)
+		mock := &mockDownloader{checkErr: &hfg.PlanMismatchError{Paths: []string{"file1.txt"}}}
+		app := &cliApp{
+			out:           &bytes.Buffer{},
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), []string{"apply", path})
+		require.Error(err, "Expected a stale plan to be refused")
+		assert.True(errors.Is(err, hfg.ErrPlanStale), "Expected ErrPlanStale, got %v", err)
+		assert.True(mock.executePlanCalls == 0, "A stale plan must not be executed")
+	})
+}
+
+func TestLs(t *testing.T) {
+	tree := []hfg.HFFile{
+		{Type: "file", Path: "config.json", Size: 700, Oid: "1111111111aaaa"},
+		{Type: "directory", Path: "onnx"},
+		{Type: "file", Path: "model.safetensors", Size: 5 << 20, Oid: "2222222222bbbb",
+			LFS:        hfg.HFLFS{IsLFS: true, Oid: "3333333333cccc", Size: 5 << 20},
+			LastCommit: &hfg.HFCommit{ID: "4444444444dddd", Title: "Upload weights", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	run := func(t *testing.T, args ...string) (*mockDownloader, string) {
+		t.Helper()
+		out := &bytes.Buffer{}
+		mock := &mockDownloader{treeToReturn: tree}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		if err := app.run(context.Background(), append([]string{"ls"}, args...)); err != nil {
+			t.Fatalf("ls %v: %v", args, err)
+		}
+		return mock, out.String()
+	}
+
+	t.Run("table", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		mock, out := run(t, "-r", "--sort", "size", "test/repo", "onnx")
+		assert.True(mock.listTreeDir == "onnx" && mock.listTreeOpts.Recursive && !mock.listTreeOpts.Expand, "Unexpected ListTree call: %q %+v", mock.listTreeDir, mock.listTreeOpts)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		assert.Len(lines, 5, "Expected a header, three entries and a total: %s", out)
+		assert.True(strings.HasSuffix(lines[1], "LFS  model.safetensors"), "Expected the largest file first with its LFS flag, got %q", lines[1])
+		assert.True(strings.HasSuffix(lines[3], "onnx/"), "Expected directories last with a trailing slash, got %q", lines[3])
+		assert.True(lines[4] == "2 files, 1 directories, 5.0 MB", "Unexpected total %q", lines[4])
+	})
+
+	t.Run("long", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		mock, out := run(t, "-l", "test/repo")
+		assert.True(mock.listTreeOpts.Expand, "Expected -l to ask for the last commits")
+		assert.True(strings.Contains(out, "3333333333  2024-05-01  4444444444 Upload weights"), "Expected the LFS oid and the last commit, got:\n%s", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		_, out := run(t, "--json", "test/repo")
+		var got []hfg.HFFile
+		require.NoError(json.Unmarshal([]byte(out), &got), "Expected JSON output: %s", out)
+		require.Len(got, 3, "")
+		require.True(got[0].Path == "config.json", "Expected name order, got %s first", got[0].Path)
+	})
+}
+
+func TestInfo(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	info := &hfg.RepoInfo{
+		ID:          "test/repo",
+		SHA:         "abc123",
+		PipelineTag: "text-generation",
+		License:     "mit",
+		Gated:       "auto",
+		CardData:    map[string]any{"language": []any{"en", "fr"}},
+		Siblings: []hfg.HFFile{
+			{Type: "file", Path: "config.json", Size: 100},
+			{Type: "directory", Path: "onnx"},
+			{Type: "file", Path: "onnx/model.onnx", Size: 3000},
+			{Type: "file", Path: "model-00001-of-00002.safetensors", Size: 4000},
+			{Type: "file", Path: "model-00002-of-00002.safetensors", Size: 2000},
+			{Type: "file", Path: "LICENSE", Size: 10},
+		},
+	}
+
+	summary := summarizeRepo(info)
+	assert.True(summary.Files == 5 && summary.TotalSize == 9110, "Unexpected totals: %d files, %d bytes", summary.Files, summary.TotalSize)
+	require.True(len(summary.ByExtension) == 4, "Expected 4 extensions, got %+v", summary.ByExtension)
+	assert.True(summary.ByExtension[0] == sizeGroup{Name: ".safetensors", Files: 2, Size: 6000}, "Expected safetensors first, got %+v", summary.ByExtension[0])
+	assert.True(summary.ByExtension[3].Name == "(none)", "Expected files without an extension last, got %+v", summary.ByExtension[3])
+	require.True(len(summary.ByFormat) == 3, "Expected safetensors, onnx and other, got %+v", summary.ByFormat)
+	assert.True(summary.ByFormat[2] == sizeGroup{Name: "other", Files: 2, Size: 110}, "Unexpected non-weight total %+v", summary.ByFormat[2])
+
+	out := &bytes.Buffer{}
+	app := &cliApp{
+		out:           out,
+		err:           &bytes.Buffer{},
+		newDownloader: func(string, ...hfg.Option) downloader { return &mockDownloader{repoInfoToReturn: info} },
+	}
+	require.NoError(app.run(context.Background(), []string{"info", "test/repo"}), "")
+	for _, want := range []string{"Commit:", "abc123", "License:", "mit", "yes (auto approval)", "Card language:", "en, fr", "5 (8.9 KB)", ".safetensors"} {
+		assert.True(strings.Contains(out.String(), want), "Expected %q in:\n%s", want, out.String())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	headers := []hfg.SafetensorsHeader{
+		{Path: "model-00001-of-00002.safetensors", Size: 3 << 30, Tensors: []hfg.SafetensorsTensor{
+			{Name: "embed", DType: "BF16", Shape: []int64{32000, 4096}},
+			{Name: "norm", DType: "F32", Shape: []int64{4096}},
+		}},
+		{Path: "model-00002-of-00002.safetensors", Size: 1 << 30, Tensors: []hfg.SafetensorsTensor{
+			{Name: "lm_head", DType: "BF16", Shape: []int64{32000, 4096}},
+		}},
+	}
+	run := func(t *testing.T, mock *mockDownloader, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), append([]string{"inspect"}, args...))
+		return out.String(), err
+	}
+
+	t.Run("table", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		out, err := run(t, &mockDownloader{headersToReturn: headers}, "--tensors", "test/repo")
+		require.NoError(err, "")
+		for _, want := range []string{"BF16,F32", "131.1M", "3.0 GB", "TOTAL", "262.1M", "4.0 GB", "lm_head", "[32000 4096]"} {
+			assert.True(strings.Contains(out, want), "Expected %q in:\n%s", want, out)
+		}
+	})
+
+	t.Run("gguf", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{ggufToReturn: []hfg.GGUFHeader{{
+			Path: "model-Q4_K_M.gguf",
+			Size: 4 << 30,
+			Metadata: map[string]any{
+				"general.architecture":  "llama",
+				"general.file_type":     uint32(15),
+				"llama.context_length":  uint32(8192),
+				"tokenizer.ggml.model":  "gpt2",
+				"tokenizer.ggml.tokens": hfg.GGUFArray{Type: "string", Len: 128256},
+			},
+			Tensors: []hfg.GGUFTensor{{Name: "token_embd.weight", Type: "Q4_K", Shape: []uint64{4096, 128256}}},
+		}}}
+		out, err := run(t, mock, "--metadata", "test/repo")
+		require.NoError(err, "")
+		for _, want := range []string{"Q4_K_M", "llama", "8192", "gpt2 (128256)", "4.0 GB", "[128256 × string]"} {
+			assert.True(strings.Contains(out, want), "Expected %q in:\n%s", want, out)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{headersToReturn: headers[:1], inspectErr: errors.New("model-00002-of-00002.safetensors: invalid header")}
+		out, err := run(t, mock, "--json", "test/repo")
+		require.Error(err, "Expected the unreadable header to fail the command")
+		var report inspectReport
+		require.NoError(json.Unmarshal([]byte(out), &report), "Expected JSON output: %s", out)
+		assert.Len(report.Safetensors, 1, "Expected the readable header in the output")
+	})
+}
+
+func TestVerifyStructure(t *testing.T) {
+	run := func(t *testing.T, mock *mockDownloader, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), append([]string{"verify"}, args...))
+		return out.String(), err
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{structureReport: &hfg.StructureReport{Dir: "models/repo", Checked: []string{"model.safetensors"}}}
+		out, err := run(t, mock, "--structure", "test/repo")
+		require.NoError(err, "")
+		assert.True(strings.Contains(out, "structure OK"), "Unexpected output:\n%s", out)
+	})
+
+	t.Run("issues", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{structureReport: &hfg.StructureReport{
+			Dir:     "models/repo",
+			Checked: []string{"model.safetensors.index.json"},
+			Issues:  []hfg.StructureIssue{{Path: "model.safetensors.index.json", Detail: "shard model-00002-of-00002.safetensors is missing"}},
+		}}
+		out, err := run(t, mock, "--structure", "--json", "test/repo")
+		require.Error(err, "Expected an error when issues are found")
+		var report hfg.StructureReport
+		require.NoError(json.Unmarshal([]byte(out), &report), "Invalid JSON:\n%s", out)
+		assert.Len(report.Issues, 1, "Issues: %+v", report.Issues)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	report := &hfg.VerifyReport{Repo: "test/repo", ModelPath: "models/test_repo", Files: []hfg.FileCheck{
+		{Path: "config.json", Size: 10, Status: hfg.FileOK, Verified: hfg.VerifySize},
+		{Path: "model.safetensors", Size: 100, Status: hfg.FileChecksumMismatch, Verified: hfg.VerifySHA256, Detail: "checksum mismatch"},
+		{Path: "notes.txt", Size: 5, Status: hfg.FileExtra},
+	}}
+	run := func(t *testing.T, mock *mockDownloader, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), append([]string{"verify"}, args...))
+		return out.String(), err
+	}
+
+	t.Run("table", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		out, err := run(t, &mockDownloader{verifyReport: report}, "test/repo")
+		assert.True(errors.Is(err, hfg.ErrVerification), "Expected ErrVerification, got %v", err)
+		for _, want := range []string{"checksum-mismatch", "model.safetensors", "extra", "1 ok, 1 checksum-mismatch, 1 extra"} {
+			assert.True(strings.Contains(out, want), "Expected %q in:\n%s", want, out)
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		out, err := run(t, &mockDownloader{verifyReport: report}, "--format", "junit", "--allow-extra", "test/repo")
+		require.Error(err, "A checksum mismatch should still fail")
+		var suites struct {
+			Suites []struct {
+				Tests    int `xml:"tests,attr"`
+				Failures int `xml:"failures,attr"`
+				Skipped  int `xml:"skipped,attr"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(xml.Unmarshal([]byte(out), &suites), "Invalid XML:\n%s", out)
+		require.Len(suites.Suites, 1, "")
+		s := suites.Suites[0]
+		assert.True(s.Tests == 3 && s.Failures == 1 && s.Skipped == 1, "Unexpected counts %+v", s)
+	})
+
+	t.Run("lockfile", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		lockPath := filepath.Join(t.TempDir(), "hfget.lock")
+		mock := &mockDownloader{repoInfoToReturn: &hfg.RepoInfo{ID: "test/repo", SHA: "abc123", Siblings: []hfg.HFFile{
+			{Type: "file", Path: "config.json", Size: 10},
+			{Type: "file", Path: "model.safetensors", Size: 100, LFS: hfg.HFLFS{IsLFS: true, Oid: "0123", Size: 100}},
+		}}}
+		_, err := run(t, mock, "--lock", lockPath, "test/repo")
+		require.NoError(err, "")
+		assert.True(mock.fetchRepoInfoCalls == 1, "Expected the remote to be read once, got %d", mock.fetchRepoInfoCalls)
+
+		offline := &mockDownloader{}
+		_, err = run(t, offline, "--offline", "--lock", lockPath, "test/repo")
+		require.NoError(err, "")
+		assert.True(offline.fetchRepoInfoCalls == 0, "Offline verify contacted the remote")
+		require.True(offline.verifiedRepo != nil, "Verify was not called")
+		assert.True(offline.verifiedRepo.SHA == "abc123", "Expected the locked revision, got %q", offline.verifiedRepo.SHA)
+		assert.Len(offline.verifiedRepo.Siblings, 2, "")
+		assert.True(offline.verifiedRepo.Siblings[1].LFS.IsLFS, "LFS metadata was lost in the lockfile")
+
+		_, err = run(t, &mockDownloader{}, "--lock", lockPath, "other/repo")
+		assert.Error(err, "Expected an error for a lockfile of another repository")
+	})
+
+	t.Run("offline needs lock", func(t *testing.T) {
+		_, err := run(t, &mockDownloader{}, "--offline", "test/repo")
+		testutils.NewAssert(t).Error(err, "Expected an error for --offline without --lock")
+	})
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	repos := []hfg.CachedRepo{
+		{Repo: "org/big", Layout: hfg.LayoutFlat, Path: "models/org_big", Revision: "main", Commit: "0123456789abcdef", Files: 3, Size: 3 << 30, LastSync: now.Add(-48 * time.Hour)},
+		{Repo: "org/old", Layout: hfg.LayoutTree, Path: "models/org/old", Files: 1, Size: 1 << 20, LastSync: now.Add(-60 * 24 * time.Hour)},
+		{Repo: "org/hub", Layout: hfg.LayoutHub, Path: "models/models--org--hub", Revision: "main", Files: 2, Size: 1 << 30, LastSync: now},
+	}
+	run := func(t *testing.T, mock *mockDownloader, args ...string) (string, error) {
+		out := &bytes.Buffer{}
+		app := &cliApp{
+			out:           out,
+			err:           &bytes.Buffer{},
+			newDownloader: func(string, ...hfg.Option) downloader { return mock },
+		}
+		err := app.run(context.Background(), append([]string{"cache"}, args...))
+		return out.String(), err
+	}
+
+	t.Run("list", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		out, err := run(t, &mockDownloader{cachedRepos: repos}, "list", "-d", "models", "-v")
+		require.NoError(err, "")
+		for _, want := range []string{"org/big", "flat", "0123456789", "3.0 GB", "tree", "hub", "3 repositories, 4.0 GB"} {
+			assert.True(strings.Contains(out, want), "Expected %q in:\n%s", want, out)
+		}
+	})
+
+	t.Run("du", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		out, err := run(t, &mockDownloader{cachedRepos: repos}, "du", "-d", "models")
+		require.NoError(err, "")
+		big, hub, old := strings.Index(out, "org/big"), strings.Index(out, "org/hub"), strings.Index(out, "org/old")
+		assert.True(big < hub && hub < old, "Expected largest first:\n%s", out)
+		assert.True(strings.Contains(out, "total"), "Expected a total in:\n%s", out)
+	})
+
+	t.Run("rm", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{cachedRepos: repos}
+		_, err := run(t, mock, "rm", "-d", "models", "org/hub", "org_big")
+		require.NoError(err, "")
+		assert.True(slices.Equal(mock.removed, []string{"org/hub", "org/big"}), "Removed %v", mock.removed)
+
+		_, err = run(t, mock, "rm", "-d", "models", "org/missing")
+		assert.Error(err, "Expected an error for a repository that is not cached")
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mock := &mockDownloader{cachedRepos: repos}
+		out, err := run(t, mock, "prune", "--older-than", "30d", "--max-size", "2GB", "--dry-run")
+		require.NoError(err, "")
+		assert.True(strings.Contains(out, "Would delete 2 repositories"), "Unexpected output:\n%s", out)
+		assert.Len(mock.removed, 0, "Dry run removed %v", mock.removed)
+
+		_, err = run(t, mock, "prune", "--older-than", "30d")
+		require.NoError(err, "")
+		assert.True(slices.Equal(mock.removed, []string{"org/old"}), "Removed %v", mock.removed)
+
+		_, err = run(t, mock, "prune")
+		assert.Error(err, "Expected an error without a prune criterion")
+	})
+}
+
+func TestParseSize(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	cases := map[string]int64{
+		"1024":  1024,
+		"512K":  512 * 1024,
+		"50M":   50 * 1024 * 1024,
+		"50mb":  50 * 1024 * 1024,
+		"1.5G":  3 * 512 * 1024 * 1024,
+		"2GiB":  2 * 1024 * 1024 * 1024,
+		" 10k ": 10 * 1024,
+	}
+	for in, want := range cases {
+		got, err := parseSize(in)
+		assert.NoError(err, "parseSize(%q)", in)
+		assert.True(got == want, "parseSize(%q) = %d, want %d", in, got, want)
+	}
+	for _, bad := range []string{"", "fast", "-5M", "M", "NaN", "nanK", "Inf", "+InfG", "1e30", "8E", "9223372036854775808"} {
+		_, err := parseSize(bad)
+		assert.Error(err, "Expected an error for %q", bad)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	cases := map[string]time.Duration{
+		"30d":   30 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"12h":   12 * time.Hour,
+		" 90m ": 90 * time.Minute,
+	}
+	for in, want := range cases {
+		got, err := parseAge(in)
+		assert.NoError(err, "parseAge(%q)", in)
+		assert.True(got == want, "parseAge(%q) = %v, want %v", in, got, want)
+	}
+	for _, bad := range []string{"", "old", "-3d", "d", "-1h"} {
+		_, err := parseAge(bad)
+		assert.Error(err, "Expected an error for %q", bad)
+	}
+}
+
+func TestParseRateSchedule(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	windows, err := parseRateSchedule("00:00-07:00=0, 09:00-18:30=20M")
+	require.NoError(err, "")
+	require.Len(windows, 2, "")
+	assert.True(windows[0].Start == 0 && windows[0].End == 7*time.Hour && windows[0].BytesPerSec == 0, "Unexpected first window: %+v", windows[0])
+	assert.True(windows[1].End == 18*time.Hour+30*time.Minute && windows[1].BytesPerSec == 20*1024*1024, "Unexpected second window: %+v", windows[1])
+
+	_, err = parseRateSchedule("09:00=20M")
+	assert.Error(err, "Expected an error for a window without an end time")
+	_, err = parseRateSchedule("25:00-07:00=1M")
+	assert.Error(err, "Expected an error for an invalid time of day")
+}
+
+func TestSplitPatterns(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	got := splitPatterns(`*.{json,txt}, re:^a{1,2}$,[,]x,,data/`)
+	want := []string{"*.{json,txt}", "re:^a{1,2}$", "[,]x", "data/"}
+	assert.True(slices.Equal(got, want), "splitPatterns = %q, want %q", got, want)
+}
+
+func TestTruncate(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	path := "daten/übersicht.json"
+	got := truncateString(path, 17)
+	assert.True(got == "...übersicht.json", "truncateString = %q", got)
+	assert.True(truncateString(path, 100) == path, "Expected a short string to be left alone")
+
+	title := "4444444444 Gewichte für die überarbeitete Version hochgeladen"
+	got = truncateEnd(title, 30)
+	assert.True(utf8.ValidString(got) && utf8.RuneCountInString(got) == 30, "truncateEnd = %q", got)
+	assert.True(got == "4444444444 Gewichte für die...", "truncateEnd = %q", got)
+}
+
+func TestExitCodes(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("could not fetch repository info: %w", err) }
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"other", errors.New("plan file is corrupt"), exitFailure},
+		{"usage", usageErrorf("a model or dataset name argument is required"), exitUsage},
+		{"bad flag", flagError(errors.New("flag provided but not defined: -bogus")), exitUsage},
+		{"unauthorized", wrap(hfg.ErrAuthentication), exitAuth},
+		{"gated", wrap(hfg.ErrForbidden), exitAuth},
+		{"not found", wrap(hfg.ErrNotFound), exitNotFound},
+		{"quant not found", hfg.ErrQuantNotFound, exitNotFound},
+		{"timeout", wrap(os.ErrDeadlineExceeded), exitNetwork},
+		{"connection refused", wrap(dialErr), exitNetwork},
+		{"server error", wrap(&hfg.StatusError{StatusCode: 503}), exitNetwork},
+		{"client error", wrap(&hfg.StatusError{StatusCode: 400}), exitFailure},
+		{"verify", &hfg.VerificationError{Failed: 1, Total: 2}, exitVerification},
+		{"preflight", fmt.Errorf("%w: need 2 GB", hfg.ErrInsufficientSpace), exitDiskFull},
+		{"cancelled", fmt.Errorf("download interrupted: %w", context.Canceled), exitInterrupted},
+		{"partial", &hfg.DownloadError{Errors: []error{wrap(os.ErrDeadlineExceeded)}, Downloaded: 2}, exitPartial},
+		{"all failed to connect", &hfg.DownloadError{Errors: []error{wrap(dialErr), wrap(dialErr)}}, exitNetwork},
+		{"all failed to verify", &hfg.DownloadError{Errors: []error{fmt.Errorf("validation failed for a.bin: %w", hfg.ErrChecksumMismatch)}}, exitVerification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exitCode(tt.err)
+			testutils.NewAssert(t).True(got == tt.want, "exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		})
+	}
+	for _, sysErr := range diskFullErrors {
+		diskFull := &os.PathError{Op: "write", Path: "model.bin", Err: sysErr}
+		for _, err := range []error{diskFull, &hfg.DownloadError{Errors: []error{diskFull}, Downloaded: 1}} {
+			got := exitCode(err)
+			testutils.NewAssert(t).True(got == exitDiskFull, "exitCode(%v) = %d, want %d", err, got, exitDiskFull)
+		}
+	}
+
+	// End to end through run, as main sees it.
+	runs := []struct {
+		name string
+		mock *mockDownloader
+		args []string
+		want int
+	}{
+		{"unknown flag", &mockDownloader{}, []string{"download", "--bogus", "test/repo"}, exitUsage},
+		{"missing argument", &mockDownloader{}, []string{"ls"}, exitUsage},
+		{"unknown command", &mockDownloader{}, []string{"help", "frobnicate"}, exitUsage},
+		{"help", &mockDownloader{}, []string{"download", "-h"}, 0},
+		{"not found", &mockDownloader{fetchErr: hfg.ErrNotFound}, []string{"-q", "test/repo"}, exitNotFound},
+		{"verification", &mockDownloader{verifyReport: &hfg.VerifyReport{Repo: "test/repo", Files: []hfg.FileCheck{
+			{Path: "a.bin", Status: hfg.FileMissing}}}}, []string{"verify", "test/repo"}, exitVerification},
+		{"partial", &mockDownloader{
+			planToReturn: &hfg.DownloadPlan{RepoName: "test/repo", FilesToDownload: []hfg.FileDownload{{File: hfg.HFFile{Path: "a.bin"}}}},
+			executeErr:   &hfg.DownloadError{Errors: []error{errors.New("failed to download b.bin")}, Downloaded: 1}, executePlanFailures: 1,
+		}, []string{"-q", "test/repo"}, exitPartial},
+	}
+	for _, tt := range runs {
+		t.Run("run "+tt.name, func(t *testing.T) {
+			app := &cliApp{
+				out:           &bytes.Buffer{},
+				err:           &bytes.Buffer{},
+				newDownloader: func(string, ...hfg.Option) downloader { return tt.mock },
+			}
+			err := app.run(context.Background(), tt.args)
+			got := exitCode(err)
+			testutils.NewAssert(t).True(got == tt.want, "exit code for %v = %d (error %v), want %d", tt.args, got, err, tt.want)
+		})
+	}
+}
+
+func TestDownloadView(t *testing.T) {
+	view := downloadView{
+		downloaded: 3 << 30, total: 8 << 30, speed: 50 << 20, avgSpeed: 40 << 20,
+		queued: 4, active: 3, finished: 2, failed: 1,
+		files: []activeFile{
+			{path: "model-00001-of-00004.safetensors", bytes: 1 << 30, size: 2 << 30, speed: 30 << 20, chunks: 5, chunksDone: 2},
+			{path: "model-00002-of-00004.safetensors", bytes: 512 << 20, size: 2 << 30, speed: 20 << 20, chunks: 5},
+			{path: "tokenizer.json", bytes: 1 << 20, size: 2 << 20, speed: 1 << 20, chunks: 1},
+		},
+	}
+
+	t.Run("full", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		lines := view.render(100, 24)
+		assert.Len(lines, 5, "Expected the overall line, the counts and three files: %q", lines)
+		for _, line := range lines {
+			assert.True(len([]rune(line)) < 100, "Line %q does not fit in 100 columns", line)
+		}
+		assert.True(strings.Contains(lines[0], "37.5%") && strings.Contains(lines[0], "ETA 1m42s"), "Unexpected overall line %q", lines[0])
+		assert.True(lines[1] == "Files: 3 active, 4 queued, 2 done, 1 failed", "Unexpected counts %q", lines[1])
+		assert.True(strings.Contains(lines[2], "[") && strings.Contains(lines[2], "50.0%") && strings.Contains(lines[2], "2/5 chunks"),
+			"Unexpected file row %q", lines[2])
+		assert.False(strings.Contains(lines[4], "chunks"), "A single stream should not show chunks: %q", lines[4])
+	})
+
+	t.Run("short terminal", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		lines := view.render(100, 4)
+		assert.Len(lines, 4, "Expected the display to fill but not exceed 4 rows: %q", lines)
+		assert.True(strings.HasSuffix(lines[3], "... and 2 more"), "Expected the hidden files to be counted: %q", lines)
+		assert.Len(view.render(100, 1), 1, "Expected only the overall line")
+	})
+
+	t.Run("narrow terminal", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		for _, line := range view.render(40, 24) {
+			assert.True(len([]rune(line)) < 40, "Line %q does not fit in 40 columns", line)
+		}
+		assert.False(strings.Contains(view.render(40, 24)[2], "["), "Expected no bar in 40 columns")
+	})
+
+	t.Run("eta", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		stalled := downloadView{downloaded: 1, total: 2}
+		_, ok := stalled.eta()
+		assert.False(ok, "Expected no ETA without a speed")
+		assert.True(formatETA(3723*time.Second) == "1h02m", "formatETA = %s", formatETA(3723*time.Second))
+		assert.True(formatETA(185*time.Second) == "3m05s", "formatETA = %s", formatETA(185*time.Second))
+		assert.True(formatETA(42*time.Second) == "42s", "formatETA = %s", formatETA(42*time.Second))
+	})
+
+	t.Run("smoothing", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		speed := smooth(0, 100, time.Second)
+		assert.True(speed == 100, "Expected the first measurement to be used, got %f", speed)
+		speed = smooth(speed, 0, speedHalfLife)
+		assert.True(speed == 50, "Expected the speed to halve over one half-life, got %f", speed)
+	})
+}
+
+func TestScreen(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	out := &bytes.Buffer{}
+	scr := &screen{out: out}
+	scr.draw([]string{strings.Repeat("a", 79), "b"}, 80)
+	assert.True(out.String() == strings.Repeat("a", 79)+"\nb", "Unexpected first draw %q", out.String())
+
+	// After narrowing to 40 columns the first line wraps onto two rows.
+	out.Reset()
+	scr.draw([]string{"c"}, 40)
+	assert.True(out.String() == "\033[2A\r"+clearDown+"c", "Expected the cursor to move up over 3 rows, got %q", out.String())
+}
+
+func TestDownloadDisplayDumbTerminal(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	t.Setenv("TERM", "dumb")
+	plan := &hfg.DownloadPlan{
+		FilesToDownload:   []hfg.FileDownload{{File: hfg.HFFile{Path: "a.bin", Size: 100}}},
+		TotalDownloadSize: 100,
+	}
+	progressChan := make(chan hfg.Progress, 4)
+	progressChan <- hfg.Progress{Filepath: "a.bin", State: hfg.ProgressStateDownloading, CurrentSize: 50, TotalSize: 100}
+	progressChan <- hfg.Progress{Filepath: "a.bin", State: hfg.ProgressStateVerified, CurrentSize: 100, TotalSize: 100}
+	close(progressChan)
+	out := &bytes.Buffer{}
+	downloadDisplayProgress(out, progressChan, -1, plan)
+	assert.False(strings.Contains(out.String(), "\033"), "Expected no escape sequences on a dumb terminal, got %q", out.String())
+	assert.True(strings.Contains(out.String(), "Overall: 100.0% (100 B/100 B) | Complete."), "Unexpected output %q", out.String())
+}
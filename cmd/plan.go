@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// runPlan implements "hfget plan": build a plan and print it, optionally as
+// JSON for review and a later "hfget apply".
+func (app *cliApp) runPlan(ctx context.Context, g globalConfig, args []string) error {
+	cfg := downloadConfig{repoConfig: repoConfig{globalConfig: g}}
+	var asJSON bool
+	fs := app.newFlagSet("plan")
+	cfg.register(fs)
+	fs.BoolVar(&asJSON, "json", false, "Write the plan as JSON to stdout")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	repoName := fs.Arg(0)
+	if !app.isTerminal || asJSON {
+		cfg.quiet = true
+	}
+
+	opts, err := cfg.options(app)
+	if err != nil {
+		return err
+	}
+	plan, err := app.buildPlan(ctx, &cfg, repoName, opts)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return plan.WriteJSON(app.out)
+	}
+	app.printPlanSummary(plan, &cfg)
+	return nil
+}
+
+// runApply implements "hfget apply": execute a plan written by
+// "hfget plan --json", refusing if the remote changed since it was built.
+func (app *cliApp) runApply(ctx context.Context, g globalConfig, args []string) (err error) {
+	cfg := downloadConfig{repoConfig: repoConfig{globalConfig: g}}
+	fs := app.newFlagSet("apply")
+	cfg.register(fs)
+	cfg.registerProgress(fs)
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a plan file argument is required")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not open plan: %w", err)
+	}
+	plan, err := hfg.ReadPlan(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !app.isTerminal {
+		cfg.quiet = true
+	}
+	if err := app.setupProgress(&cfg); err != nil {
+		return err
+	}
+	defer func() { cfg.events.done(err) }()
+	cfg.events.plan(plan)
+
+	// Pin the run to the reviewed commit when the plan recorded one.
+	cfg.branch = plan.Revision
+	if plan.Repo.SHA != "" {
+		cfg.branch = plan.Repo.SHA
+	}
+	cfg.isDataset = plan.IsDataset
+	opts, err := cfg.options(app)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.err, "Checking that %s still matches the plan...\n", plan.RepoName)
+	if err := app.newDownloader(plan.RepoName, opts...).CheckPlan(ctx, plan); err != nil {
+		return fmt.Errorf("refusing to apply plan: %w", err)
+	}
+	if err := plan.CheckConflicts(); err != nil {
+		return err
+	}
+	return app.executePlan(ctx, &cfg, plan.RepoName, opts, plan)
+}
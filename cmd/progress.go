@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	hfg "github.com/drgo/hfget"
+	"golang.org/x/term"
+)
+
+type fileProgressState struct {
+	processedBytes int64
+	totalSize      int64
+	state          hfg.ProgressState
+	started        bool // Any update received; queued until then
+	chunks         int
+	chunksDone     int
+	lastBytes      int64   // processedBytes at the previous tick
+	speed          float64 // Smoothed, in bytes per second
+}
+
+func analysisDisplayProgress(out io.Writer, progressChan <-chan hfg.Progress, fd int, totalAnalysisSize int64) {
+	dumb := isDumbTerminal()
+	fileStates := make(map[string]*fileProgressState)
+	var lastActiveFile string
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case pr, ok := <-progressChan:
+			if !ok {
+				if !dumb {
+					fmt.Fprint(out, clearLine)
+				}
+				fmt.Fprintln(out, "Analysis complete.")
+				return
+			}
+			lastActiveFile = pr.Filepath
+
+			state, exists := fileStates[pr.Filepath]
+			if !exists {
+				state = &fileProgressState{totalSize: pr.TotalSize}
+				fileStates[pr.Filepath] = state
+			}
+
+			state.processedBytes = pr.CurrentSize
+
+		case <-ticker.C:
+			if dumb {
+				continue // The line cannot be redrawn in place.
+			}
+			width, _, _ := term.GetSize(fd)
+			if width <= 0 {
+				width = 90
+			}
+
+			var totalVerifiedBytes int64
+			for _, state := range fileStates {
+				totalVerifiedBytes += state.processedBytes
+			}
+
+			percent := 0.0
+			if totalAnalysisSize > 0 {
+				percent = (float64(totalVerifiedBytes) * 100) / float64(totalAnalysisSize)
+			}
+
+			if percent > 100.0 {
+				percent = 100.0
+			}
+
+			fmt.Fprint(out, clearLine)
+			fmt.Fprintf(out, "Analyzing (%.1f%%): Verifying %s", percent, truncateString(lastActiveFile, width-30))
+		}
+	}
+}
+
+const (
+	// speedHalfLife is how quickly the displayed speeds follow changes; the
+	// ETA is computed from the smoothed overall speed.
+	speedHalfLife = 3 * time.Second
+	// dumbProgressInterval is how often a status line is printed on a
+	// terminal that cannot move the cursor.
+	dumbProgressInterval = 10 * time.Second
+)
+
+// isDumbTerminal reports whether the terminal cannot handle the escape
+// sequences used to redraw the progress display in place.
+func isDumbTerminal() bool {
+	return os.Getenv("TERM") == "dumb"
+}
+
+// smooth moves speed towards the rate measured over elapsed, by an amount
+// that depends on elapsed so that the result does not depend on how often
+// it is called. A zero speed is replaced by the measurement.
+func smooth(speed float64, delta int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return speed
+	}
+	rate := float64(delta) / elapsed.Seconds()
+	if speed == 0 {
+		return rate
+	}
+	alpha := 1 - math.Exp2(-elapsed.Seconds()/speedHalfLife.Seconds())
+	return speed + alpha*(rate-speed)
+}
+
+// activeFile is one row of the download display.
+type activeFile struct {
+	path        string
+	bytes, size int64
+	speed       float64
+	chunks      int
+	chunksDone  int
+}
+
+// downloadView is what the download display shows at one moment.
+type downloadView struct {
+	downloaded, total                int64
+	speed, avgSpeed                  float64
+	queued, active, finished, failed int
+	files                            []activeFile // Active files in plan order
+}
+
+// eta estimates the time left from the smoothed speed, or returns false.
+func (v *downloadView) eta() (time.Duration, bool) {
+	if v.speed < 1 || v.downloaded >= v.total {
+		return 0, false
+	}
+	return time.Duration(float64(v.total-v.downloaded) / v.speed * float64(time.Second)), true
+}
+
+func (v *downloadView) overall() string {
+	percent := 0.0
+	if v.total > 0 {
+		percent = (float64(v.downloaded) * 100) / float64(v.total)
+	}
+	eta := "--"
+	if d, ok := v.eta(); ok {
+		eta = formatETA(d)
+	}
+	return fmt.Sprintf("Overall: %.1f%% (%s/%s) | ETA %s | %s | Avg: %s",
+		percent, formatBytes(v.downloaded), formatBytes(v.total), eta, formatSpeed(v.speed), formatSpeed(v.avgSpeed))
+}
+
+func (v *downloadView) counts() string {
+	s := fmt.Sprintf("Files: %d active, %d queued, %d done", v.active, v.queued, v.finished)
+	if v.failed > 0 {
+		s += fmt.Sprintf(", %d failed", v.failed)
+	}
+	return s
+}
+
+// render lays out the view in at most height rows of fewer than width
+// columns: the overall line, the file counts, then a row per active file
+// for as many as fit.
+func (v *downloadView) render(width, height int) []string {
+	lines := []string{v.overall()}
+	if height >= 2 {
+		lines = append(lines, v.counts())
+	}
+	files := v.files
+	if rows := height - len(lines); len(files) > rows {
+		// Leave a row to say how many files are not shown.
+		files = files[:max(0, rows-1)]
+	}
+	for _, f := range files {
+		lines = append(lines, renderFileRow(f, width))
+	}
+	if hidden := len(v.files) - len(files); hidden > 0 && len(lines) < height {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", hidden))
+	}
+	for i := range lines {
+		lines[i] = fitLine(lines[i], width)
+	}
+	return lines
+}
+
+// renderFileRow shows a file's name, bar, percentage, speed and chunks. The
+// bar shrinks, then disappears, as the terminal narrows.
+func renderFileRow(f activeFile, width int) string {
+	percent := 0.0
+	if f.size > 0 {
+		percent = (float64(f.bytes) * 100) / float64(f.size)
+	}
+	var chunks string
+	if f.chunks > 1 {
+		chunks = fmt.Sprintf("%d/%d chunks", f.chunksDone, f.chunks)
+	}
+	// The columns have a fixed width so that the bars line up.
+	stats := fmt.Sprintf(" %5.1f%% %10s %-13s", percent, formatSpeed(f.speed), chunks)
+	nameWidth := min(40, max(10, width/3))
+	barWidth := width - 1 - 2 - nameWidth - 1 - len(stats) - 2
+	name := truncateString(f.path, nameWidth)
+	if barWidth < 10 {
+		return strings.TrimRight(fmt.Sprintf("  %-*s%s", nameWidth, name, stats), " ")
+	}
+	return strings.TrimRight(fmt.Sprintf("  %-*s [%s]%s", nameWidth, name, progressBar(percent, barWidth), stats), " ")
+}
+
+func progressBar(percent float64, width int) string {
+	filled := min(width, int(percent*float64(width)/100))
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	return bar
+}
+
+// fitLine cuts s to fewer than width runes, so that writing it never makes
+// the terminal wrap.
+func fitLine(s string, width int) string {
+	if r := []rune(s); len(r) >= width && width > 0 {
+		return string(r[:width-1])
+	}
+	return s
+}
+
+// formatETA formats d as "1h02m", "3m05s" or "42s".
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// screen redraws a block of lines in place at the bottom of a terminal.
+type screen struct {
+	out  io.Writer
+	prev []int // Rune lengths of the lines last drawn
+}
+
+// clear erases the lines last drawn, leaving the cursor where they began.
+// Lines are counted at the current width in case the terminal was narrowed
+// and they now wrap.
+func (s *screen) clear(width int) {
+	if len(s.prev) == 0 {
+		return
+	}
+	rows := 0
+	for _, n := range s.prev {
+		rows += max(1, (n+width-1)/width)
+	}
+	if rows > 1 {
+		fmt.Fprintf(s.out, "\033[%dA", rows-1)
+	}
+	fmt.Fprint(s.out, "\r"+clearDown)
+	s.prev = nil
+}
+
+func (s *screen) draw(lines []string, width int) {
+	s.clear(width)
+	fmt.Fprint(s.out, strings.Join(lines, "\n"))
+	for _, line := range lines {
+		s.prev = append(s.prev, len([]rune(line)))
+	}
+}
+
+// downloadDisplayProgress shows the overall progress, ETA and file counts
+// with a row per active file, redrawn in place and fitted to the terminal's
+// current size. On a dumb terminal it prints a status line now and then
+// instead.
+func downloadDisplayProgress(out io.Writer, progressChan <-chan hfg.Progress, fd int, plan *hfg.DownloadPlan) {
+	fileStates := make(map[string]*fileProgressState)
+	for _, f := range plan.FilesToDownload {
+		fileStates[f.File.Path] = &fileProgressState{totalSize: f.File.Size}
+	}
+	view := downloadView{total: plan.TotalDownloadSize}
+	dumb := isDumbTerminal()
+	scr := &screen{out: out}
+	start := time.Now()
+	lastTick, lastDownloaded, lastDumbLine := start, int64(0), start
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	size := func() (int, int) {
+		width, height, err := term.GetSize(fd)
+		if err != nil || width <= 0 || height <= 0 {
+			return 90, 24
+		}
+		return width, height
+	}
+
+	for {
+		select {
+		case pr, ok := <-progressChan:
+			if !ok {
+				if !dumb {
+					width, _ := size()
+					scr.clear(width)
+				}
+				status := "Complete."
+				if view.downloaded < view.total {
+					status = "Stopped."
+				}
+				if view.failed > 0 {
+					status = fmt.Sprintf("%d file(s) failed.", view.failed)
+				}
+				fmt.Fprintf(out, "Overall: %.1f%% (%s/%s) | %s\n\n", percentOf(view.downloaded, view.total),
+					formatBytes(view.downloaded), formatBytes(view.total), status)
+				return
+			}
+			state, exists := fileStates[pr.Filepath]
+			if !exists {
+				continue
+			}
+			switch pr.State {
+			case hfg.ProgressStateDownloading:
+				if pr.CurrentSize > state.processedBytes {
+					view.downloaded += pr.CurrentSize - state.processedBytes
+					state.processedBytes = pr.CurrentSize
+				}
+				state.chunks, state.chunksDone = pr.Chunks, pr.ChunksDone
+			case hfg.ProgressStateComplete, hfg.ProgressStateVerified:
+				if state.processedBytes < state.totalSize {
+					view.downloaded += state.totalSize - state.processedBytes
+				}
+				state.processedBytes = state.totalSize
+			}
+			state.state, state.started = pr.State, true
+
+		case now := <-ticker.C:
+			elapsed := now.Sub(lastTick)
+			view.speed = smooth(view.speed, view.downloaded-lastDownloaded, elapsed)
+			view.avgSpeed = float64(view.downloaded) / max(now.Sub(start).Seconds(), 0.1)
+			lastTick, lastDownloaded = now, view.downloaded
+
+			view.queued, view.active, view.finished, view.failed = 0, 0, 0, 0
+			view.files = view.files[:0]
+			for _, f := range plan.FilesToDownload {
+				state := fileStates[f.File.Path]
+				state.speed = smooth(state.speed, state.processedBytes-state.lastBytes, elapsed)
+				state.lastBytes = state.processedBytes
+				switch {
+				case !state.started:
+					view.queued++
+				case state.state == hfg.ProgressStateVerified:
+					view.finished++
+				case state.state == hfg.ProgressStateFailed:
+					view.failed++
+				default:
+					view.active++
+					view.files = append(view.files, activeFile{path: f.File.Path, bytes: state.processedBytes, size: state.totalSize,
+						speed: state.speed, chunks: state.chunks, chunksDone: state.chunksDone})
+				}
+			}
+
+			if dumb {
+				if now.Sub(lastDumbLine) >= dumbProgressInterval {
+					fmt.Fprintf(out, "%s | %s\n", view.overall(), view.counts())
+					lastDumbLine = now
+				}
+				continue
+			}
+			width, height := size()
+			scr.draw(view.render(width, height), width)
+		}
+	}
+}
+
+func percentOf(n, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return min(100, (float64(n)*100)/float64(total))
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	hfg "github.com/drgo/hfget"
+)
+
+// verifyFormats are the output formats of "hfget verify".
+var verifyFormats = []string{"table", "json", "junit"}
+
+// runVerify implements "hfget verify": check a local copy against the Hub
+// or a lockfile, or with --structure check its safetensors structure.
+func (app *cliApp) runVerify(ctx context.Context, g globalConfig, args []string) error {
+	var (
+		cfg                                    = repoConfig{globalConfig: g}
+		dest                                   destConfig
+		filters                                filterConfig
+		lockPath, format                       string
+		structure, offline, allowExtra, asJSON bool
+	)
+	fs := app.newFlagSet("verify")
+	cfg.register(fs)
+	dest.register(fs)
+	filters.register(fs)
+	fs.StringVar(&lockPath, "lock", "", "Verify against this lockfile; if it does not exist, write it from the remote first")
+	fs.BoolVar(&offline, "offline", false, "Never contact the Hub; requires an existing --lock file")
+	fs.BoolVar(&allowExtra, "allow-extra", false, "Do not fail on local files that are not in the repository")
+	fs.StringVar(&format, "format", "table", "Output format: table, json or junit")
+	fs.BoolVar(&asJSON, "json", false, "Same as --format json")
+	fs.BoolVar(&structure, "structure", false, "Instead check that safetensors headers parse, tensors fit their files and every indexed shard exists")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() < 1 {
+		return usageErrorf("a model or dataset name argument is required")
+	}
+	if asJSON {
+		format = "json"
+	}
+	if !slices.Contains(verifyFormats, format) {
+		return usageErrorf("invalid --format %q: must be one of table, json, junit", format)
+	}
+	if offline && lockPath == "" {
+		return usageErrorf("--offline requires --lock")
+	}
+	repoName := fs.Arg(0)
+	opts := append(append(cfg.options(app), dest.options()...), filters.options()...)
+
+	if structure {
+		report, err := app.newDownloader(repoName, opts...).ValidateStructure(ctx)
+		if err != nil {
+			return fmt.Errorf("could not validate %s: %w", repoName, err)
+		}
+		if err := app.writeStructureReport(report, format); err != nil {
+			return err
+		}
+		if !report.OK() {
+			return &exitError{code: exitVerification, err: fmt.Errorf("%d structural issue(s) found in %s", len(report.Issues), report.Dir)}
+		}
+		return nil
+	}
+
+	repoInfo, err := app.expectedFiles(ctx, repoName, lockPath, offline, opts)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var progressChan chan hfg.Progress
+	if !cfg.quiet && app.isTerminal {
+		var total int64
+		for _, f := range repoInfo.Siblings {
+			total += f.Size
+		}
+		progressChan = make(chan hfg.Progress, 16)
+		opts = append(opts, hfg.WithProgressChannel(progressChan))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			analysisDisplayProgress(app.err, progressChan, app.terminalFd, total)
+		}()
+	}
+	report, err := app.newDownloader(repoName, opts...).Verify(ctx, repoInfo)
+	if progressChan != nil {
+		close(progressChan)
+		wg.Wait()
+	}
+	if err != nil {
+		return fmt.Errorf("could not verify %s: %w", repoName, err)
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "junit":
+		err = app.writeJUnit(verifyJUnit(report, allowExtra))
+	default:
+		err = app.printVerifyReport(report)
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err(allowExtra)
+}
+
+// expectedFiles returns what the local copy should contain: the lockfile at
+// lockPath if there is one, or else the remote file list, which is written
+// to lockPath when that is set.
+func (app *cliApp) expectedFiles(ctx context.Context, repoName, lockPath string, offline bool, opts []hfg.Option) (*hfg.RepoInfo, error) {
+	if lockPath != "" {
+		lock, err := readLockfile(lockPath)
+		switch {
+		case err == nil:
+			if lock.Repo != repoName {
+				return nil, fmt.Errorf("lockfile %s is for %s, not %s", lockPath, lock.Repo, repoName)
+			}
+			return lock.RepoInfo(), nil
+		case !errors.Is(err, os.ErrNotExist) || offline:
+			return nil, fmt.Errorf("could not read lockfile: %w", err)
+		}
+	}
+
+	downloader := app.newDownloader(repoName, opts...)
+	repoInfo, err := downloader.FetchRepoInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch repository info: %w", err)
+	}
+	if lockPath != "" {
+		lock, err := downloader.NewLockfile(repoInfo)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeLockfile(lockPath, lock); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(app.err, "Wrote %s pinning %d file(s) of %s at %s.\n", lockPath, len(lock.Files), repoName, orDash(lock.Revision))
+	}
+	return repoInfo, nil
+}
+
+func readLockfile(path string) (*hfg.Lockfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return hfg.ReadLockfile(f)
+}
+
+func writeLockfile(path string, lock *hfg.Lockfile) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not write lockfile: %w", err)
+	}
+	if err := lock.WriteJSON(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write lockfile: %w", err)
+	}
+	return f.Close()
+}
+
+// printVerifyReport writes one row per file and a count of each status.
+func (app *cliApp) printVerifyReport(report *hfg.VerifyReport) error {
+	if len(report.Files) == 0 {
+		fmt.Fprintf(app.out, "No files to verify in %s.\n", report.ModelPath)
+		return nil
+	}
+	w := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tSIZE\tVERIFIED\tPATH\tDETAIL")
+	for _, f := range report.Files {
+		verified := "-"
+		if f.Verified != hfg.VerifyNone {
+			verified = f.Verified.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Status, formatBytes(f.Size), verified, f.Path, f.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	counts := report.Counts()
+	summary := fmt.Sprintf("%d file(s) in %s:", len(report.Files), report.ModelPath)
+	for status := hfg.FileOK; status <= hfg.FileExtra; status++ {
+		if counts[status] > 0 {
+			summary += fmt.Sprintf(" %d %s,", counts[status], status)
+		}
+	}
+	fmt.Fprintln(app.out, summary[:len(summary)-1])
+	return nil
+}
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// add appends c to the suite and counts it.
+func (s *junitTestSuite) add(c junitTestCase) {
+	c.ClassName = s.Name
+	s.Tests++
+	if c.Failure != nil {
+		s.Failures++
+	}
+	if c.Skipped != nil {
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+// verifyJUnit has a test case per file; allowed extra files are skipped.
+func verifyJUnit(report *hfg.VerifyReport, allowExtra bool) *junitTestSuites {
+	suite := junitTestSuite{Name: report.Repo}
+	for _, f := range report.Files {
+		c := junitTestCase{Name: f.Path}
+		switch {
+		case f.Status == hfg.FileOK:
+		case f.Status == hfg.FileExtra && allowExtra:
+			c.Skipped = &junitMessage{Message: f.Status.String()}
+		default:
+			c.Failure = &junitMessage{Message: f.Status.String(), Text: f.Detail}
+		}
+		suite.add(c)
+	}
+	return &junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+// structureJUnit has a test case per checked file, failed by its issues.
+func structureJUnit(report *hfg.StructureReport) *junitTestSuites {
+	suite := junitTestSuite{Name: report.Dir}
+	issues := make(map[string][]string)
+	for _, issue := range report.Issues {
+		issues[issue.Path] = append(issues[issue.Path], issue.Detail)
+	}
+	for _, path := range report.Checked {
+		c := junitTestCase{Name: path}
+		if details := issues[path]; len(details) > 0 {
+			c.Failure = &junitMessage{Message: details[0], Text: strings.Join(details, "\n")}
+		}
+		suite.add(c)
+	}
+	return &junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+func (app *cliApp) writeJUnit(suites *junitTestSuites) error {
+	fmt.Fprint(app.out, xml.Header)
+	enc := xml.NewEncoder(app.out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(app.out)
+	return err
+}
+
+// writeStructureReport writes report in format.
+func (app *cliApp) writeStructureReport(report *hfg.StructureReport, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "junit":
+		return app.writeJUnit(structureJUnit(report))
+	}
+	app.printStructureReport(report)
+	return nil
+}
+
+// printStructureReport lists the issues in report, or confirms there were
+// none.
+func (app *cliApp) printStructureReport(report *hfg.StructureReport) {
+	if len(report.Checked) == 0 {
+		fmt.Fprintf(app.out, "No safetensors files or shard indexes found in %s.\n", report.Dir)
+		return
+	}
+	for _, issue := range report.Issues {
+		fmt.Fprintf(app.out, "FAIL  %s: %s\n", issue.Path, issue.Detail)
+	}
+	if report.OK() {
+		fmt.Fprintf(app.out, "Checked %d file(s) in %s: structure OK.\n", len(report.Checked), report.Dir)
+	} else {
+		fmt.Fprintf(app.out, "Checked %d file(s) in %s: %d issue(s).\n", len(report.Checked), report.Dir, len(report.Issues))
+	}
+}
@@ -0,0 +1,137 @@
+package hfget
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrConflict is matched by errors.Is for a *ConflictError.
+var ErrConflict = errors.New("locally modified files conflict with the repository")
+
+// backupSuffix is appended to a locally modified file when it is set aside
+// under ConflictBackup.
+const backupSuffix = ".orig"
+
+// ConflictPolicy decides what happens to a local file that was modified
+// since hfget last synced it and no longer matches the repository.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite replaces the local file with the remote version.
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictKeep leaves the local file untouched and skips the download.
+	ConflictKeep
+	// ConflictBackup renames the local file to <name>.orig before downloading.
+	ConflictBackup
+	// ConflictFail refuses to execute the plan.
+	ConflictFail
+)
+
+var conflictPolicyNames = map[ConflictPolicy]string{
+	ConflictOverwrite: "overwrite",
+	ConflictKeep:      "keep",
+	ConflictBackup:    "backup",
+	ConflictFail:      "fail",
+}
+
+func (p ConflictPolicy) String() string {
+	if name, ok := conflictPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+}
+
+// MarshalText encodes the policy by name.
+func (p ConflictPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a policy name written by MarshalText.
+func (p *ConflictPolicy) UnmarshalText(text []byte) error {
+	parsed, err := ParseConflictPolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// ParseConflictPolicy converts "overwrite", "keep", "backup" or "fail" into a ConflictPolicy.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for p, name := range conflictPolicyNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown conflict policy %q: want overwrite, keep, backup or fail", s)
+}
+
+// FileConflict represents a local file modified since the last sync and the
+// action the plan will take for it.
+type FileConflict struct {
+	File         HFFile         `json:"file"`
+	LocalSize    int64          `json:"localSize"`
+	LocalModTime time.Time      `json:"localModTime"`
+	Action       ConflictPolicy `json:"action"`
+}
+
+// ConflictError lists the locally modified files that stopped a plan from
+// executing under ConflictFail.
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d locally modified file(s) would be overwritten: %s", len(e.Paths), strings.Join(e.Paths, ", "))
+}
+
+// Is lets errors.Is(err, ErrConflict) match.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// CheckConflicts returns a *ConflictError if any conflict in the plan is
+// governed by ConflictFail. ExecutePlan calls it before writing anything.
+func (p *DownloadPlan) CheckConflicts() error {
+	var paths []string
+	for _, c := range p.FilesConflicted {
+		if c.Action == ConflictFail {
+			paths = append(paths, c.File.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return &ConflictError{Paths: paths}
+}
+
+// isBackupName reports whether name was produced by backupFile.
+func isBackupName(name string) bool {
+	i := strings.LastIndex(name, backupSuffix)
+	if i < 0 {
+		return false
+	}
+	rest := name[i+len(backupSuffix):]
+	if rest == "" {
+		return true
+	}
+	if rest[0] != '.' || len(rest) == 1 {
+		return false
+	}
+	return strings.Trim(rest[1:], "0123456789") == ""
+}
+
+// backupFile renames fullPath to the first free "<name>.orig", "<name>.orig.1", ... path.
+func backupFile(fullPath string) (string, error) {
+	target := fullPath + backupSuffix
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s%s.%d", fullPath, backupSuffix, i)
+	}
+	return target, os.Rename(fullPath, target)
+}
@@ -0,0 +1,93 @@
+package hfget
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientSpace is matched by errors.Is for an *InsufficientSpaceError.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+var errDiskSpaceUnsupported = errors.New("free space check is not supported on this platform")
+
+// diskFree reports the bytes available to an unprivileged user on the
+// filesystem holding path. It is a variable so tests can replace it.
+var diskFree = freeDiskSpace
+
+// InsufficientSpaceError reports that a plan needs more space than the
+// destination filesystem has available.
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient disk space in %s: %s required (including staging), %s available",
+		e.Path, formatBytes(e.Required), formatBytes(e.Available))
+}
+
+// Is lets errors.Is(err, ErrInsufficientSpace) match.
+func (e *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+// availableSpace returns the free space for path, walking up to the nearest
+// existing ancestor since the destination may not have been created yet.
+func availableSpace(path string) (int64, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
+
+// requiredSpace estimates the peak bytes ExecutePlan needs. Every file needs
+// its own size; multi-threaded files are also staged as chunks in .tmp
+// before being merged, and since files are processed one at a time only the
+// largest staged file counts twice.
+func (d *Downloader) requiredSpace(files []FileDownload) int64 {
+	var total, staging int64
+	for _, f := range files {
+		total += f.File.Size
+		if d.isMultiThreaded(f.File) && f.File.Size > staging {
+			staging = f.File.Size
+		}
+	}
+	return total + staging
+}
+
+// checkDiskSpace fails with an *InsufficientSpaceError when the destination
+// cannot hold the plan. Platforms without a free-space query are not checked.
+func (d *Downloader) checkDiskSpace(modelPath string, plan *DownloadPlan) error {
+	if d.skipDiskCheck {
+		return nil
+	}
+	required := d.requiredSpace(plan.FilesToDownload)
+	available, err := availableSpace(modelPath)
+	if err != nil {
+		d.logger.Printf("Skipping disk space check for %s: %v", modelPath, err)
+		return nil
+	}
+	d.logger.Printf("Disk space check for %s: %s required, %s available", modelPath, formatBytes(required), formatBytes(available))
+	if required > available {
+		return &InsufficientSpaceError{Path: modelPath, Required: required, Available: available}
+	}
+	return nil
+}
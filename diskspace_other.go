@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd || dragonfly || windows)
+
+package hfget
+
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errDiskSpaceUnsupported
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -72,26 +73,48 @@ func (r *IdleTimeoutReader) Close() error {
 	return r.r.Close()
 }
 
-// DownloadPlan holds a detailed summary of actions to be taken.
+// DownloadPlan holds a detailed summary of actions to be taken. It can be
+// written with WriteJSON and read back with ReadPlan to be executed later.
 type DownloadPlan struct {
-	Repo              *RepoInfo
-	FilesToDownload   []FileDownload
-	TotalDownloadSize int64
-	FilesToSkip       []FileSkip
-	TotalSkipSize     int64
+	Version           int            `json:"version"`
+	RepoName          string         `json:"repoName"`
+	Revision          string         `json:"revision"`
+	IsDataset         bool           `json:"isDataset,omitempty"`
+	ModelPath         string         `json:"modelPath"` // Absolute destination directory
+	CreatedAt         time.Time      `json:"createdAt"`
+	Repo              *RepoInfo      `json:"repo"`
+	FilesToDownload   []FileDownload `json:"filesToDownload"`
+	TotalDownloadSize int64          `json:"totalDownloadSize"`
+	FilesToSkip       []FileSkip     `json:"filesToSkip"`
+	TotalSkipSize     int64          `json:"totalSkipSize"`
+	FilesToDelete     []FileDelete   `json:"filesToDelete,omitempty"` // Only populated in prune mode
+	TotalDeleteSize   int64          `json:"totalDeleteSize,omitempty"`
+	FilesConflicted   []FileConflict `json:"filesConflicted,omitempty"` // Local files modified since the last sync
+	FilesFiltered     []FileSkip     `json:"filesFiltered,omitempty"`   // Left out by patterns, size limits or the budget
+	FilesRejected     []FileReject   `json:"filesRejected,omitempty"`   // Paths that would escape the destination
+	// RequiredBytes is the peak disk space ExecutePlan needs, including
+	// chunk staging; AvailableBytes is the free space found on the
+	// destination filesystem, or zero if it could not be determined.
+	RequiredBytes  int64 `json:"requiredBytes"`
+	AvailableBytes int64 `json:"availableBytes"`
+	// PickleScans is filled in by ExecutePlan when pickle scanning is on.
+	PickleScans []PickleReport `json:"pickleScans,omitempty"`
 }
 
 // FileDownload represents a file to be downloaded and the reason.
 type FileDownload struct {
-	File   HFFile
-	Reason string
+	File   HFFile     `json:"file"`
+	Reason PlanReason `json:"reason"`
 }
 
-// FileSkip represents a file to be skipped and the reason.
+// FileSkip represents a file to be skipped, the reason, and how the local
+// copy was verified (VerifyNone for filtered files).
 type FileSkip struct {
-	File   HFFile
-	Reason string
+	File     HFFile             `json:"file"`
+	Reason   PlanReason         `json:"reason"`
+	Verified VerificationMethod `json:"verified,omitempty"`
 }
+
 type progressState struct {
 	lastUpdated time.Time
 }
@@ -105,7 +128,12 @@ type Downloader struct {
 	numConnections      int
 	authToken           string
 	skipSHA             bool
+	skipDiskCheck       bool
+	lockWait            bool
+	lockTimeout         time.Duration
 	forceRedownload     bool
+	prune               bool
+	conflictPolicy      ConflictPolicy
 	useTreeStructure    bool
 	branch              string
 	destinationBasePath string
@@ -113,6 +141,23 @@ type Downloader struct {
 	isDataset           bool
 	includePatterns     []string
 	excludePatterns     []string
+	includeFilter       filterSet // Compiled by BuildPlan
+	excludeFilter       filterSet
+	minFileSize         int64
+	maxFileSize         int64
+	budget              int64
+	budgetPriority      BudgetPriority
+	quant               string
+	withMMProj          bool
+	quantSelection      map[string]bool // Computed by BuildPlan when quant is set
+	preferFormats       bool
+	formatPreference    []WeightFormat
+	duplicateWeights    map[string]bool // Computed by BuildPlan when preferFormats is set
+	pickleScan          PickleScanPolicy
+	rateLimit           int64
+	connRateLimit       int64
+	rateSchedule        []RateWindow
+	limiter             *rateLimiter // Shared by every connection of this Downloader
 	Progress            chan<- Progress
 	progressState       map[string]*progressState // Tracks update times per file
 	progressMutex       sync.Mutex                // Protects the progressState map
@@ -149,6 +194,9 @@ func New(repoName string, opts ...Option) *Downloader {
 	for _, opt := range opts {
 		opt(d)
 	}
+	if d.rateLimit > 0 || len(d.rateSchedule) > 0 {
+		d.limiter = newRateLimiter(d.rateLimit, d.rateSchedule)
+	}
 	return d
 }
 
@@ -175,14 +223,45 @@ func (d *Downloader) FetchRepoInfo(ctx context.Context) (*RepoInfo, error) {
 // BuildPlan compares the remote repo info with local files to create a download plan.
 func (d *Downloader) BuildPlan(ctx context.Context, repoInfo *RepoInfo) (*DownloadPlan, error) {
 	d.logger.Printf("Building download plan by checking local files.")
-	plan := &DownloadPlan{
-		Repo: repoInfo,
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	d.quantSelection = nil
+	if d.quant != "" {
+		selection, err := d.selectQuant(repoInfo.Siblings)
+		if err != nil {
+			return nil, err
+		}
+		d.quantSelection = selection
+	}
+	d.duplicateWeights = nil
+	if d.preferFormats {
+		var candidates []HFFile
+		for _, f := range d.flattenTree(repoInfo.Siblings) {
+			if d.shouldDownload(f.Path) {
+				candidates = append(candidates, f)
+			}
+		}
+		d.duplicateWeights = d.duplicateFormats(candidates)
 	}
-
 	modelPath := d.getModelPath(repoInfo.ID)
+	if abs, err := filepath.Abs(modelPath); err == nil {
+		modelPath = abs
+	}
 	d.logger.Printf("Target local path set to: %s", modelPath)
 
+	plan := &DownloadPlan{
+		Version:   planVersion,
+		RepoName:  d.repoName,
+		Revision:  d.branch,
+		IsDataset: d.isDataset,
+		ModelPath: modelPath,
+		CreatedAt: time.Now().UTC(),
+		Repo:      repoInfo,
+	}
+
 	allFiles := d.flattenTree(repoInfo.Siblings)
+	state := loadSyncState(modelPath)
 
 	for _, file := range allFiles {
 		select {
@@ -190,7 +269,15 @@ func (d *Downloader) BuildPlan(ctx context.Context, repoInfo *RepoInfo) (*Downlo
 			return nil, ctx.Err()
 		default:
 		}
-		d.processFileForPlan(ctx, modelPath, file, plan)
+		d.processFileForPlan(ctx, modelPath, file, plan, state)
+	}
+
+	d.applyBudget(plan)
+
+	if d.prune {
+		if err := d.findStaleFiles(ctx, modelPath, repoInfo.Siblings, plan); err != nil {
+			return nil, err
+		}
 	}
 
 	for _, f := range plan.FilesToDownload {
@@ -199,9 +286,20 @@ func (d *Downloader) BuildPlan(ctx context.Context, repoInfo *RepoInfo) (*Downlo
 	for _, f := range plan.FilesToSkip {
 		plan.TotalSkipSize += f.File.Size
 	}
+	plan.RequiredBytes = d.requiredSpace(plan.FilesToDownload)
+	if available, err := availableSpace(modelPath); err == nil {
+		plan.AvailableBytes = available
+	} else {
+		d.logger.Printf("Could not determine free space for %s: %v", modelPath, err)
+	}
 
-	d.logger.Printf("Plan complete. Found %d files to download (%s) and %d valid files to skip (%s).",
-		len(plan.FilesToDownload), formatBytes(plan.TotalDownloadSize), len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize))
+	for _, f := range plan.FilesToDelete {
+		plan.TotalDeleteSize += f.Size
+	}
+
+	d.logger.Printf("Plan complete. Found %d files to download (%s), %d valid files to skip (%s) and %d stale files to delete (%s).",
+		len(plan.FilesToDownload), formatBytes(plan.TotalDownloadSize), len(plan.FilesToSkip), formatBytes(plan.TotalSkipSize),
+		len(plan.FilesToDelete), formatBytes(plan.TotalDeleteSize))
 	return plan, nil
 }
 
@@ -218,101 +316,260 @@ func (d *Downloader) flattenTree(files []HFFile) []HFFile {
 	return flatList // Correctly returns the filtered list of files
 }
 
-func (d *Downloader) processFileForPlan(ctx context.Context, modelPath string, file HFFile, plan *DownloadPlan) {
+func (d *Downloader) processFileForPlan(ctx context.Context, modelPath string, file HFFile, plan *DownloadPlan, state *syncState) {
 	if !d.shouldDownload(file.Path) {
 		d.logger.Printf("Skipping file '%s' due to include/exclude filters.", file.Path)
-		d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, "filtered")
+		plan.FilesFiltered = append(plan.FilesFiltered, FileSkip{File: file, Reason: ReasonFiltered})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonFiltered.String())
 		return
 	}
-
-	fullPath := filepath.Join(modelPath, file.Path)
-
-	// First, get the absolute path of our intended destination root.
-	absModelPath, err := filepath.Abs(modelPath)
-	if err != nil {
-		d.logger.Printf("Security check failed: could not determine absolute path for destination '%s': %v", modelPath, err)
+	if d.duplicateWeights[file.Path] {
+		d.logger.Printf("Skipping file '%s': the same weights are available in a preferred format.", file.Path)
+		plan.FilesFiltered = append(plan.FilesFiltered, FileSkip{File: file, Reason: ReasonDuplicateFormat})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonDuplicateFormat.String())
 		return
 	}
-	// Then, get the absolute path of the file we are about to write.
-	absFullPath, err := filepath.Abs(fullPath)
+	if d.outsideSizeLimits(file) {
+		d.logger.Printf("Skipping file '%s' (%s) due to size limits.", file.Path, formatBytes(file.Size))
+		plan.FilesFiltered = append(plan.FilesFiltered, FileSkip{File: file, Reason: ReasonSizeLimit})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonSizeLimit.String())
+		return
+	}
+
+	fullPath, err := confinedPath(modelPath, file.Path)
 	if err != nil {
-		d.logger.Printf("Security check failed: could not determine absolute path for file '%s': %v", fullPath, err)
+		d.logger.Printf("Security check failed: rejecting '%s': %v", file.Path, err)
+		plan.FilesRejected = append(plan.FilesRejected, FileReject{File: file, Detail: err.Error()})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonRejected.String())
 		return
 	}
-	// Finally, ensure the file's path is truly a child of the destination path.
-	rel, err := filepath.Rel(absModelPath, absFullPath)
-	if err != nil || strings.HasPrefix(rel, "..") {
-		d.logger.Printf("Security check failed: file '%s' attempts to write outside of destination directory. Skipping.", file.Path)
+	// A file edited since hfget last wrote it is a conflict, not a corrupt
+	// download, unless the edit happens to match the remote content.
+	if info, modified := state.modifiedSinceSync(file, fullPath); modified {
+		if reason, method := d.checkLocalFile(ctx, fullPath, file); reason == ReasonUpToDate && !d.forceRedownload {
+			plan.FilesToSkip = append(plan.FilesToSkip, FileSkip{File: file, Reason: reason, Verified: method})
+			d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, method.String())
+			return
+		}
+		d.logger.Printf("File was modified locally since the last sync (policy: %s): %s", d.conflictPolicy, file.Path)
+		plan.FilesConflicted = append(plan.FilesConflicted, FileConflict{
+			File: file, LocalSize: info.Size(), LocalModTime: info.ModTime(), Action: d.conflictPolicy,
+		})
+		if d.conflictPolicy == ConflictOverwrite || d.conflictPolicy == ConflictBackup {
+			plan.FilesToDownload = append(plan.FilesToDownload, FileDownload{File: file, Reason: ReasonLocallyModified})
+		}
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonLocallyModified.String())
 		return
 	}
+
 	if d.forceRedownload {
 		d.logger.Printf("Forcing re-download for: %s", file.Path)
-		plan.FilesToDownload = append(plan.FilesToDownload, FileDownload{File: file, Reason: "forced re-download"})
-		d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, "forced")
+		plan.FilesToDownload = append(plan.FilesToDownload, FileDownload{File: file, Reason: ReasonForced})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, ReasonForced.String())
 		return
 	}
 
-	isValid, reason := d.isLocalFileValid(ctx, fullPath, file)
-	if isValid {
+	reason, method := d.checkLocalFile(ctx, fullPath, file)
+	if reason == ReasonUpToDate {
 		d.logger.Printf("File is already present and valid, skipping: %s", file.Path)
-		plan.FilesToSkip = append(plan.FilesToSkip, FileSkip{File: file, Reason: reason})
-		d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, reason)
+		plan.FilesToSkip = append(plan.FilesToSkip, FileSkip{File: file, Reason: reason, Verified: method})
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, method.String())
 	} else {
 		d.logger.Printf("File is missing or invalid (%s), planning download for: %s", reason, file.Path)
 		plan.FilesToDownload = append(plan.FilesToDownload, FileDownload{File: file, Reason: reason})
-		d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, reason)
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, reason.String())
 	}
 }
 
 func (d *Downloader) ExecutePlan(ctx context.Context, plan *DownloadPlan) error {
-	modelPath := d.getModelPath(plan.Repo.ID)
+	modelPath := plan.ModelPath
+	if modelPath == "" {
+		modelPath = d.getModelPath(plan.Repo.ID)
+	}
+	if err := plan.CheckConflicts(); err != nil {
+		return err
+	}
+	if err := d.checkDiskSpace(modelPath, plan); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(modelPath, 0o755); err != nil {
 		return fmt.Errorf("failed to create root model directory %s: %w", modelPath, err)
 	}
+	lock, err := d.acquireLock(ctx, modelPath)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	// Record what this run leaves on disk, even if it is interrupted, so the
+	// next plan can recognise later local edits.
+	state := loadSyncState(modelPath)
+	defer func() {
+		state.Repo = plan.Repo.ID
+		state.Revision = d.branch
+		state.Commit = plan.Repo.SHA
+		state.LastSync = time.Now().UTC()
+		if err := state.save(modelPath); err != nil {
+			d.logger.Printf("Failed to save sync state for %s: %v", modelPath, err)
+		}
+	}()
+	// Skipped files match the remote, so a missing or outdated record, e.g.
+	// after a touch that left the content alone, is refreshed to spare the
+	// next plan a full hash.
+	for _, skipped := range plan.FilesToSkip {
+		fullPath := filepath.Join(modelPath, skipped.File.Path)
+		if !state.current(skipped.File, fullPath) {
+			state.record(skipped.File, fullPath)
+		}
+	}
+	backups := make(map[string]bool)
+	for _, c := range plan.FilesConflicted {
+		if c.Action == ConflictBackup {
+			backups[c.File.Path] = true
+		}
+	}
 
-	var downloadErrors []string
+	var downloadErrors []error
+	var downloaded int
+	plan.PickleScans = nil
+	for _, skipped := range plan.FilesToSkip {
+		if err := d.scanForPickles(modelPath, skipped.File, plan); err != nil {
+			downloadErrors = append(downloadErrors, err)
+		}
+	}
 
-	for _, fileToDownload := range plan.FilesToDownload {
+	// fail records the failure of file and reports it as a progress event.
+	fail := func(file HFFile, err error) {
+		downloadErrors = append(downloadErrors, err)
+		d.sendProgress(ctx, file.Path, ProgressStateFailed, 0, file.Size, err.Error())
+	}
+	for i, fileToDownload := range plan.FilesToDownload {
+		if err := ctx.Err(); err != nil {
+			return interruptedError(i, len(plan.FilesToDownload), err)
+		}
 		file := fileToDownload.File
+		// Checked again because the plan may have been built earlier and the
+		// destination changed since.
+		fullPath, err := confinedPath(modelPath, file.Path)
+		if err != nil {
+			fail(file, fmt.Errorf("refusing to write %s: %w", file.Path, err))
+			continue
+		}
+		if backups[file.Path] {
+			backupPath, err := backupFile(fullPath)
+			if err != nil {
+				fail(file, fmt.Errorf("failed to back up locally modified %s: %w", file.Path, err))
+				continue
+			}
+			d.logger.Printf("Backed up locally modified %s to %s", file.Path, backupPath)
+		}
+		if err := removeSymlink(fullPath); err != nil {
+			fail(file, fmt.Errorf("failed to replace symlink %s: %w", file.Path, err))
+			continue
+		}
+		// Forget the file until the new copy is verified, so that a failed or
+		// interrupted write is planned as a re-download next time rather than
+		// reported as a local modification.
+		if _, ok := state.Files[file.Path]; ok {
+			delete(state.Files, file.Path)
+			if err := state.save(modelPath); err != nil {
+				fail(file, fmt.Errorf("failed to update sync state before writing %s: %w", file.Path, err))
+				continue
+			}
+		}
 		d.logger.Printf("Starting download of: %s", file.Path)
 
 		calculatedChecksum, err := d.downloadFile(ctx, modelPath, file)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				d.logger.Printf("Download of %s interrupted: %v", file.Path, err)
+				return interruptedError(i, len(plan.FilesToDownload), ctxErr)
+			}
 			d.logger.Printf("failed to download %s: %v", file.Path, err)
-			downloadErrors = append(downloadErrors, fmt.Sprintf("failed to download %s: %v", file.Path, err))
+			fail(file, fmt.Errorf("failed to download %s: %w", file.Path, err))
 			continue
 		}
 
-		d.sendProgress(file.Path, ProgressStateComplete, file.Size, file.Size, "Verifying...")
+		d.sendProgress(ctx, file.Path, ProgressStateComplete, file.Size, file.Size, "Verifying...")
 
 		if calculatedChecksum != "" {
 			if !d.skipSHA && file.LFS.IsLFS && calculatedChecksum != file.LFS.Oid {
-				errStr := fmt.Sprintf("validation failed for %s: checksum mismatch: expected %s, got %s", file.Path, file.LFS.Oid, calculatedChecksum)
-				d.logger.Print(errStr)
-				downloadErrors = append(downloadErrors, errStr)
+				err := fmt.Errorf("validation failed for %s: %w: expected %s, got %s", file.Path, ErrChecksumMismatch, file.LFS.Oid, calculatedChecksum)
+				d.logger.Print(err)
+				fail(file, err)
 				continue
 			}
 			d.logger.Printf("Successfully verified '%s' via on-the-fly SHA256", file.Path)
-			d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, "On-the-fly SHA256")
+			d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, VerifyStreamedSHA256.String())
 		} else {
-			fullPath := filepath.Join(modelPath, file.Path)
-			verificationMethod, err := d.verifyLocalFile(ctx, fullPath, file, true)
+			_, verificationMethod, err := d.verifyLocalFile(ctx, fullPath, file, true)
 			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return interruptedError(i, len(plan.FilesToDownload), ctxErr)
+				}
 				d.logger.Printf("validation failed for %s: %v", file.Path, err)
-				downloadErrors = append(downloadErrors, fmt.Sprintf("validation failed for %s: %v", file.Path, err))
+				fail(file, fmt.Errorf("validation failed for %s: %w", file.Path, err))
 				continue
 			}
 			d.logger.Printf("Successfully verified '%s' via %s", verificationMethod, file.Path)
-			d.sendProgress(file.Path, ProgressStateVerified, file.Size, file.Size, verificationMethod)
+			d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, verificationMethod.String())
+		}
+		if err := d.scanForPickles(modelPath, file, plan); err != nil {
+			fail(file, err)
+			continue
 		}
+		state.record(file, fullPath)
+		downloaded++
+	}
+
+	// Stale files are only pruned once every download has succeeded, so a
+	// failed sync never leaves the directory with less than it started with.
+	if len(downloadErrors) == 0 && len(plan.FilesToDelete) > 0 {
+		downloadErrors = append(downloadErrors, d.deleteStaleFiles(modelPath, plan.FilesToDelete)...)
 	}
 
 	if len(downloadErrors) > 0 {
-		return fmt.Errorf("%d file(s) failed to download or verify:\n- %s", len(downloadErrors), strings.Join(downloadErrors, "\n- "))
+		return &DownloadError{Errors: downloadErrors, Downloaded: downloaded}
 	}
 
 	return nil
 }
+
+// interruptedError reports how far ExecutePlan got before its context was
+// cancelled. The returned error wraps cause so callers can match it with
+// errors.Is(err, context.Canceled).
+func interruptedError(processed, total int, cause error) error {
+	return fmt.Errorf("download interrupted after %d of %d file(s); partial data was kept and will be resumed on the next run: %w", processed, total, cause)
+}
+
+// ErrPartialDownload is matched by errors.Is for a *DownloadError.
+var ErrPartialDownload = errors.New("some files failed to download or verify")
+
+// DownloadError reports the files ExecutePlan could not download, verify,
+// scan or prune; the rest of the plan was still carried out. It unwraps to
+// each failure, so errors.Is and errors.As can find their causes.
+type DownloadError struct {
+	Errors     []error
+	Downloaded int // Files downloaded and verified despite the failures
+}
+
+func (e *DownloadError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d file(s) failed to download or verify:\n- %s", len(e.Errors), strings.Join(msgs, "\n- "))
+}
+
+// Is lets errors.Is(err, ErrPartialDownload) match.
+func (e *DownloadError) Is(target error) bool {
+	return target == ErrPartialDownload
+}
+
+func (e *DownloadError) Unwrap() []error {
+	return e.Errors
+}
+
 type contextReader struct {
 	ctx context.Context
 	r   io.Reader
@@ -324,18 +581,21 @@ func (cr *contextReader) Read(p []byte) (n int, err error) {
 	}
 	return cr.r.Read(p)
 }
-func (d *Downloader) verifyLocalFile(ctx context.Context,localPath string, remoteFile HFFile, disableProgress bool) (string, error) {
+// verifyLocalFile checks localPath against remoteFile. It returns
+// ReasonUpToDate and the method used when the file matches, or the reason it
+// does not along with an error.
+func (d *Downloader) verifyLocalFile(ctx context.Context, localPath string, remoteFile HFFile, disableProgress bool) (PlanReason, VerificationMethod, error) {
 	d.logger.Printf("Verifying local file: %s", localPath)
 	info, err := os.Stat(localPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "missing", err
+			return ReasonMissing, VerifyNone, err
 		}
-		return "stat error", err
+		return ReasonUnreadable, VerifyNone, err
 	}
 	if info.Size() != remoteFile.Size {
 		d.logger.Printf("Size mismatch for %s: expected %d, got %d", localPath, remoteFile.Size, info.Size())
-		return "size mismatch", fmt.Errorf("size mismatch: expected %d, got %d", remoteFile.Size, info.Size())
+		return ReasonSizeMismatch, VerifySize, fmt.Errorf("%w: expected %d, got %d", ErrSizeMismatch, remoteFile.Size, info.Size())
 	}
 
 	if remoteFile.LFS.IsLFS && !d.skipSHA {
@@ -345,14 +605,15 @@ func (d *Downloader) verifyLocalFile(ctx context.Context,localPath string, remot
 		var reader io.Reader
 		file, err := os.Open(localPath)
 		if err != nil {
-			return "read error", err
+			return ReasonUnreadable, VerifyNone, err
 		}
 		defer file.Close()
 		reader = file
 
 		if !disableProgress {
-			d.sendProgress(remoteFile.Path, ProgressStateVerifying, 0, remoteFile.Size, "")
+			d.sendProgress(ctx, remoteFile.Path, ProgressStateVerifying, 0, remoteFile.Size, "")
 			progressReader := &progressReader{
+				ctx:       ctx,
 				r:         file,
 				filepath:  remoteFile.Path,
 				totalSize: remoteFile.Size,
@@ -360,54 +621,39 @@ func (d *Downloader) verifyLocalFile(ctx context.Context,localPath string, remot
 			}
 			reader = progressReader
 		}
-// Wrap the chosen reader with context awareness
+		// Wrap the chosen reader with context awareness
 		reader = &contextReader{ctx: ctx, r: reader}
 		hasher := sha256.New()
 		if _, err := io.Copy(hasher, reader); err != nil {
-			return "hashing error", fmt.Errorf("failed during hashing: %w", err)
+			return ReasonUnreadable, VerifySHA256, fmt.Errorf("failed during hashing: %w", err)
 		}
 		actualChecksum := hex.EncodeToString(hasher.Sum(nil))
 		if actualChecksum != expectedChecksum {
 			d.logger.Printf("Checksum mismatch for %s", localPath)
-			return "checksum mismatch", fmt.Errorf("checksum mismatch: expected %s, got %s", expectedChecksum, actualChecksum)
+			return ReasonChecksumMismatch, VerifySHA256, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, actualChecksum)
 		}
-		return "SHA256 Checksum", nil
+		return ReasonUpToDate, VerifySHA256, nil
 	}
-	return "File Size", nil
-}
-
-func (d *Downloader) isLocalFileValid(ctx context.Context, localPath string, remoteFile HFFile) (bool, string) {
-	reason, err := d.verifyLocalFile(ctx, localPath, remoteFile, false)
-	return err == nil, reason
+	return ReasonUpToDate, VerifySize, nil
 }
 
-func (d *Downloader) shouldDownload(path string) bool {
-	for _, pattern := range d.excludePatterns {
-		if matched, _ := filepath.Match(pattern, path); matched {
-			return false
-		}
-	}
-	if len(d.includePatterns) == 0 {
-		return true
-	}
-	for _, pattern := range d.includePatterns {
-		if matched, _ := filepath.Match(pattern, path); matched {
-			return true
-		}
-	}
-	return false
+// checkLocalFile is verifyLocalFile with progress reporting; the file is
+// valid when the returned reason is ReasonUpToDate.
+func (d *Downloader) checkLocalFile(ctx context.Context, localPath string, remoteFile HFFile) (PlanReason, VerificationMethod) {
+	reason, method, _ := d.verifyLocalFile(ctx, localPath, remoteFile, false)
+	return reason, method
 }
 
 func (d *Downloader) downloadMultiThreaded(ctx context.Context, url, fullPath, tmpDir string, file HFFile) error {
 	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpDir)
 
-	var downloadedBytes atomic.Int64
+	counter := &transferCounter{chunks: d.numConnections}
 	chunkSize := file.Size / int64(d.numConnections)
 	var wg sync.WaitGroup
 	errChan := make(chan error, d.numConnections)
+	chunkNames := make([]string, d.numConnections)
 
 	for i := range d.numConnections {
 		start := int64(i) * chunkSize
@@ -415,18 +661,25 @@ func (d *Downloader) downloadMultiThreaded(ctx context.Context, url, fullPath, t
 		if i == d.numConnections-1 {
 			end = file.Size - 1
 		}
+		chunkNames[i] = chunkFileName(tmpDir, file, i, d.numConnections)
 		wg.Add(1)
 		go func(chunkIndex int, start, end int64) {
 			defer wg.Done()
-			tmpFileName := filepath.Join(tmpDir, fmt.Sprintf("%s_%d.tmp", filepath.Base(file.Path), chunkIndex))
-			if err := d.downloadChunk(ctx, url, tmpFileName, start, end, file, &downloadedBytes); err != nil {
+			if err := d.downloadChunk(ctx, url, chunkNames[chunkIndex], start, end, file, counter); err != nil {
 				errChan <- fmt.Errorf("chunk %d for %s failed: %w", chunkIndex, file.Path, err)
+				return
 			}
+			counter.chunksDone.Add(1)
+			// The last byte was reported before this chunk counted as done,
+			// so report the chunk count again.
+			d.sendTransferProgress(ctx, file.Path, counter.bytes.Load(), file.Size, counter)
 		}(i, start, end)
 	}
 	wg.Wait()
 	close(errChan)
 
+	// Chunk files are deliberately left in place on error so that the next
+	// run can resume from where this one stopped.
 	for err := range errChan {
 		if err != nil {
 			return err // Return on first chunk error
@@ -434,7 +687,26 @@ func (d *Downloader) downloadMultiThreaded(ctx context.Context, url, fullPath, t
 	}
 
 	d.logger.Printf("All chunks downloaded for %s, merging files...", file.Path)
-	return mergeFiles(fullPath, tmpDir, filepath.Base(file.Path), d.numConnections)
+	if err := mergeFiles(ctx, fullPath, chunkNames); err != nil {
+		return err
+	}
+	// Only succeeds once no other file has chunks staged in the directory.
+	_ = os.Remove(tmpDir)
+	return nil
+}
+
+// chunkFileName returns the staging path for one chunk of file. The name
+// embeds the file's oid and the chunk layout so that partial data is only
+// resumed when it belongs to the same remote content and chunk boundaries.
+func chunkFileName(tmpDir string, file HFFile, index, total int) string {
+	oid := file.LFS.Oid
+	if oid == "" {
+		oid = file.Oid
+	}
+	if len(oid) > 12 {
+		oid = oid[:12]
+	}
+	return filepath.Join(tmpDir, fmt.Sprintf("%s_%s_%d_of_%d.tmp", filepath.Base(file.Path), oid, index, total))
 }
 
 // downloadFile returns a calculated checksum (if available) and an error.
@@ -451,24 +723,51 @@ func (d *Downloader) downloadFile(ctx context.Context, modelPath string, file HF
 	}
 
 	// High-level branching logic is now much clearer.
-	if !file.LFS.IsLFS || file.Size < int64(d.numConnections*1024*1024) {
+	if !d.isMultiThreaded(file) {
 		d.logger.Printf("Using single-threaded download for %s", file.Path)
 		return d.downloadSingleThreaded(ctx, downloadURL, fullPath, file)
 	}
 
 	d.logger.Printf("Using multi-threaded download for %s (%d connections)", file.Path, d.numConnections)
-	tmpDir := filepath.Join(modelPath, ".tmp")
+	tmpDir := filepath.Join(modelPath, stagingDirName)
 	err = d.downloadMultiThreaded(ctx, downloadURL, fullPath, tmpDir, file)
 	// Return empty checksum, signaling that post-download verification is needed.
 	return "", err
 }
 
-func (d *Downloader) downloadChunk(ctx context.Context, url, tmpFileName string, start, end int64, file HFFile, progressCounter *atomic.Int64) error {
+// isMultiThreaded reports whether file is large enough to be fetched in
+// parallel chunks staged under the model's .tmp directory.
+func (d *Downloader) isMultiThreaded(file HFFile) bool {
+	return file.LFS.IsLFS && file.Size >= int64(d.numConnections*1024*1024)
+}
+
+func (d *Downloader) downloadChunk(ctx context.Context, url, tmpFileName string, start, end int64, file HFFile, counter *transferCounter) error {
+	// Resume from any bytes already staged by an earlier, interrupted run.
+	expected := end - start + 1
+	var have int64
+	if info, err := os.Stat(tmpFileName); err == nil {
+		have = info.Size()
+	}
+	if have > expected {
+		d.logger.Printf("Discarding oversized chunk file %s", tmpFileName)
+		have = 0
+	}
+	if have > 0 {
+		d.sendTransferProgress(ctx, file.Path, counter.bytes.Add(have), file.Size, counter)
+	}
+	if have == expected {
+		d.logger.Printf("Chunk %s already complete, skipping", tmpFileName)
+		return nil
+	}
+	if have > 0 {
+		d.logger.Printf("Resuming chunk %s at byte %d of %d", tmpFileName, have, expected)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start+have, end))
 	if d.authToken != "" {
 		req.Header.Add("Authorization", "Bearer "+d.authToken)
 	}
@@ -478,10 +777,14 @@ func (d *Downloader) downloadChunk(ctx context.Context, url, tmpFileName string,
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, url)
+	if resp.StatusCode != http.StatusPartialContent {
+		return &StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
-	out, err := os.Create(tmpFileName)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if have > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	out, err := os.OpenFile(tmpFileName, flags, 0o644)
 	if err != nil {
 		return err
 	}
@@ -489,15 +792,19 @@ func (d *Downloader) downloadChunk(ctx context.Context, url, tmpFileName string,
 
 	idleReader := NewIdleTimeoutReader(ctx, resp.Body, 60*time.Second)
 	progressWriter := &progressWriter{
-		filepath:     file.Path,
-		totalSize:    file.Size,
-		w:            out,
-		d:            d,
-		bytesWritten: progressCounter, // Use the passed-in shared counter
+		ctx:       ctx,
+		filepath:  file.Path,
+		totalSize: file.Size,
+		w:         out,
+		d:         d,
+		counter:   counter, // Shared with the file's other chunks
 	}
 
-	_, err = io.Copy(progressWriter, idleReader)
-	return err
+	if _, err = io.Copy(progressWriter, d.throttle(ctx, idleReader)); err != nil {
+		return err
+	}
+	// Make sure the staged bytes survive an abrupt exit after this point.
+	return out.Sync()
 }
 
 // downloadSingleThreaded now returns the calculated SHA256 checksum as a hex string.
@@ -516,7 +823,7 @@ func (d *Downloader) downloadSingleThreaded(ctx context.Context, url, fullPath s
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		return "", &StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 	out, err := os.Create(fullPath)
 	if err != nil {
@@ -524,7 +831,6 @@ func (d *Downloader) downloadSingleThreaded(ctx context.Context, url, fullPath s
 	}
 	defer out.Close()
 
-	var downloadedBytes atomic.Int64
 	idleReader := NewIdleTimeoutReader(ctx, resp.Body, 60*time.Second)
 
 	// Create a new hasher
@@ -533,14 +839,15 @@ func (d *Downloader) downloadSingleThreaded(ctx context.Context, url, fullPath s
 	writer := io.MultiWriter(out, hasher)
 
 	progressWriter := &progressWriter{
-		filepath:     file.Path,
-		totalSize:    file.Size,
-		w:            writer, // Use the MultiWriter as the destination
-		d:            d,
-		bytesWritten: &downloadedBytes,
+		ctx:       ctx,
+		filepath:  file.Path,
+		totalSize: file.Size,
+		w:         writer, // Use the MultiWriter as the destination
+		d:         d,
+		counter:   &transferCounter{chunks: 1},
 	}
 
-	if _, err = io.Copy(progressWriter, idleReader); err != nil {
+	if _, err = io.Copy(progressWriter, d.throttle(ctx, idleReader)); err != nil {
 		return "", err
 	}
 
@@ -549,11 +856,30 @@ func (d *Downloader) downloadSingleThreaded(ctx context.Context, url, fullPath s
 	return actualChecksum, nil
 }
 
-func (d *Downloader) sendProgress(filepath string, state ProgressState, current, total int64, msg string) {
+func (d *Downloader) sendProgress(ctx context.Context, filepath string, state ProgressState, current, total int64, msg string) {
+	d.send(ctx, Progress{Filepath: filepath, State: state, CurrentSize: current, TotalSize: total, Message: msg})
+}
+
+// sendTransferProgress reports that current bytes of a file being downloaded
+// through counter have arrived.
+func (d *Downloader) sendTransferProgress(ctx context.Context, filepath string, current, total int64, counter *transferCounter) {
+	d.send(ctx, Progress{
+		Filepath:    filepath,
+		State:       ProgressStateDownloading,
+		CurrentSize: current,
+		TotalSize:   total,
+		Chunks:      counter.chunks,
+		ChunksDone:  int(counter.chunksDone.Load()),
+	})
+}
+
+// send delivers update to the progress channel, throttling intermediate
+// updates for each file. Final states wait for the reader until ctx is done;
+// other updates are dropped if the channel is full.
+func (d *Downloader) send(ctx context.Context, update Progress) {
 	if d.Progress == nil {
 		return
 	}
-
 	throttleInterval := 100 * time.Millisecond
 
 	d.progressMutex.Lock()
@@ -562,14 +888,14 @@ func (d *Downloader) sendProgress(filepath string, state ProgressState, current,
 		d.progressState = make(map[string]*progressState)
 	}
 	// Get or create a state tracker for this specific file.
-	if _, ok := d.progressState[filepath]; !ok {
-		d.progressState[filepath] = &progressState{}
+	if _, ok := d.progressState[update.Filepath]; !ok {
+		d.progressState[update.Filepath] = &progressState{}
 	}
-	fileState := d.progressState[filepath]
+	fileState := d.progressState[update.Filepath]
 
-	isFinalState := (state == ProgressStateComplete || state == ProgressStateVerified)
+	isFinalState := (update.State == ProgressStateComplete || update.State == ProgressStateVerified || update.State == ProgressStateFailed)
 	// Also consider a download 100% complete as a final, non-throttled state.
-	isDownloadComplete := (state == ProgressStateDownloading && current == total)
+	isDownloadComplete := (update.State == ProgressStateDownloading && update.CurrentSize == update.TotalSize)
 
 	// Throttle the update if it's not a final state, not a 100% download update,
 	// not the first update, AND not enough time has passed.
@@ -582,40 +908,54 @@ func (d *Downloader) sendProgress(filepath string, state ProgressState, current,
 	fileState.lastUpdated = time.Now()
 	d.progressMutex.Unlock()
 
-	progressUpdate := Progress{
-		Filepath:    filepath,
-		State:       state,
-		CurrentSize: current,
-		TotalSize:   total,
-		Message:     msg,
+	// Final states are delivered unless ctx is cancelled so that consumers
+	// can account for every file.
+	if isFinalState {
+		select {
+		case d.Progress <- update:
+		case <-ctx.Done():
+		}
+		return
 	}
-
-	// Use the non-blocking send.
 	select {
-	case d.Progress <- progressUpdate:
+	case d.Progress <- update:
 		// The update was sent successfully.
 	default:
 		// The channel was blocked. Drop the update to prevent hanging.
 	}
 }
 
-func mergeFiles(outputFileName, tempDir, baseName string, numChunks int) error {
+// mergeFiles concatenates the chunk files into outputFileName. The chunks
+// are removed only after the merge succeeds; if it fails or ctx is cancelled
+// the partial output is deleted and the chunks are kept for a later resume.
+func mergeFiles(ctx context.Context, outputFileName string, chunkNames []string) (err error) {
 	outputFile, err := os.Create(outputFileName)
 	if err != nil {
 		return err
 	}
-	defer outputFile.Close()
-	for i := range numChunks {
-		tmpFileName := filepath.Join(tempDir, fmt.Sprintf("%s_%d.tmp", baseName, i))
-		tmpFile, err := os.Open(tmpFileName)
+	defer func() {
+		if cerr := outputFile.Close(); err == nil {
+			err = cerr
+		}
 		if err != nil {
+			_ = os.Remove(outputFileName)
+		}
+	}()
+	for _, tmpFileName := range chunkNames {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if _, err := io.Copy(outputFile, tmpFile); err != nil {
-			tmpFile.Close()
+		tmpFile, err := os.Open(tmpFileName)
+		if err != nil {
 			return err
 		}
+		_, err = io.Copy(outputFile, &contextReader{ctx: ctx, r: tmpFile})
 		tmpFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, tmpFileName := range chunkNames {
 		_ = os.Remove(tmpFileName)
 	}
 	return nil
@@ -635,6 +975,7 @@ func formatBytes(b int64) string {
 }
 
 type progressReader struct {
+	ctx       context.Context
 	r         io.Reader
 	filepath  string
 	totalSize int64
@@ -646,26 +987,34 @@ func (pr *progressReader) Read(p []byte) (n int, err error) {
 	n, err = pr.r.Read(p)
 	if n > 0 && pr.d != nil {
 		pr.readBytes += int64(n)
-		pr.d.sendProgress(pr.filepath, ProgressStateVerifying, pr.readBytes, pr.totalSize, "")
+		pr.d.sendProgress(pr.ctx, pr.filepath, ProgressStateVerifying, pr.readBytes, pr.totalSize, "")
 	}
 	return
 }
 
+// transferCounter is shared by the connections downloading one file.
+type transferCounter struct {
+	bytes      atomic.Int64
+	chunks     int // 1 for a single stream
+	chunksDone atomic.Int32
+}
+
 type progressWriter struct {
-	w            io.Writer
-	filepath     string
-	totalSize    int64
-	d            *Downloader
-	bytesWritten *atomic.Int64 // Pointer to a shared counter
+	ctx       context.Context
+	w         io.Writer
+	filepath  string
+	totalSize int64
+	d         *Downloader
+	counter   *transferCounter
 }
 
 func (pw *progressWriter) Write(p []byte) (n int, err error) {
 	n, err = pw.w.Write(p)
 	if n > 0 && pw.d != nil {
 		// Add the number of bytes from this write to the shared counter.
-		newTotal := pw.bytesWritten.Add(int64(n))
+		newTotal := pw.counter.bytes.Add(int64(n))
 		// Send a progress update with the new CUMULATIVE total for the file.
-		pw.d.sendProgress(pw.filepath, ProgressStateDownloading, newTotal, pw.totalSize, "")
+		pw.d.sendTransferProgress(pw.ctx, pw.filepath, newTotal, pw.totalSize, pw.counter)
 	}
 	return
 }
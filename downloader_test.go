@@ -1,12 +1,22 @@
 package hfget
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -126,6 +136,89 @@ func TestFetchRepoInfo(t *testing.T) {
 	assert.Len(info.Siblings, 2, "Expected 2 files in repo info")
 }
 
+func TestRepoInfoMetadata(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	const apiResponse = `{
+		"id": "org/model", "sha": "abc123", "lastModified": "2024-05-01T10:00:00.000Z",
+		"tags": ["transformers", "safetensors", "license:mit"],
+		"pipeline_tag": "text-generation", "library_name": "transformers",
+		"gated": "manual", "downloads": 1200, "likes": 34,
+		"cardData": {"license": "other", "license_name": "llama3", "base_model": "org/base", "language": ["en", "fr"]},
+		"siblings": [{"rfilename": "config.json"}]}`
+
+	var info RepoInfo
+	require.NoError(json.Unmarshal([]byte(apiResponse), &info), "")
+	assert.True(info.SHA == "abc123" && info.PipelineTag == "text-generation" && info.LibraryName == "transformers", "Unexpected metadata: %+v", info)
+	assert.True(info.Gated == "manual" && info.Downloads == 1200 && info.Likes == 34, "Unexpected metadata: %+v", info)
+	assert.True(info.License == "llama3", "Expected the card's license_name for license 'other', got %q", info.License)
+	assert.True(info.CardData["base_model"] == "org/base", "Expected the card data, got %v", info.CardData)
+
+	data, err := json.Marshal(&info)
+	require.NoError(err, "")
+	var again RepoInfo
+	require.NoError(json.Unmarshal(data, &again), "")
+	assert.True(again.License == info.License && again.Gated == info.Gated && slices.Equal(again.Tags, info.Tags), "Metadata did not round-trip: %+v", again)
+
+	require.NoError(json.Unmarshal([]byte(`{"id": "org/public", "gated": false, "tags": ["license:apache-2.0"]}`), &info), "")
+	assert.True(info.Gated == "", "Expected gated=false to mean not gated, got %q", info.Gated)
+	assert.True(info.License == "apache-2.0", "Expected the license from the tags, got %q", info.License)
+}
+
+func TestFetchTreePagination(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") != "true" {
+			http.Error(w, "expected a recursive listing", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("cursor") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?recursive=true&cursor=abc>; rel="next"`, server.URL, r.URL.Path))
+			_, _ = w.Write([]byte(`[{"type":"directory","path":"sub"},{"type":"file","path":"a.txt","size":1}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"type":"file","path":"sub/b.txt","size":2}]`))
+	}))
+	defer server.Close()
+	baseURL = server.URL
+
+	files, err := New(mockRepoID).ListTree(context.Background(), "", TreeOptions{Recursive: true})
+	require.NoError(err, "")
+	require.Len(files, 3, "Expected both pages to be fetched")
+	assert.True(files[2].Path == "sub/b.txt", "Expected the nested file from the second page, got %s", files[2].Path)
+}
+
+func TestListTree(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	var gotPath string
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.Query()
+		_, _ = w.Write([]byte(`[
+			{"type":"directory","oid":"d1","size":0,"path":"onnx/sub"},
+			{"type":"file","oid":"f1","size":10,"path":"onnx/model.onnx","lfs":{"oid":"abc","size":4096,"pointerSize":130},
+			 "lastCommit":{"id":"c0ffee","title":"Add ONNX export","date":"2024-05-01T10:00:00.000Z"}},
+			{"type":"file","oid":"f2","size":20,"path":"onnx/config.json"}]`))
+	}))
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID, WithExcludePatterns([]string{"*.json"}))
+	files, err := d.ListTree(context.Background(), "onnx/", TreeOptions{Expand: true})
+	require.NoError(err, "")
+	assert.True(strings.HasSuffix(gotPath, "/tree/main/onnx"), "Expected the folder in the URL path, got %s", gotPath)
+	assert.True(gotQuery.Get("expand") == "true" && gotQuery.Get("recursive") == "", "Unexpected query: %v", gotQuery)
+	require.Len(files, 2, "Expected the directory and the ONNX file, excluding config.json")
+	assert.True(files[0].Type == "directory", "Directories must be listed regardless of filters")
+	f := files[1]
+	assert.True(f.LFS.IsLFS && f.Size == 4096, "Expected LFS metadata, got %+v", f)
+	require.True(f.LastCommit != nil, "Expected the last commit to be decoded")
+	assert.True(f.LastCommit.ID == "c0ffee" && f.LastCommit.Date.Year() == 2024, "Unexpected last commit %+v", f.LastCommit)
+}
+
 func TestBuildPlan(t *testing.T) {
 	repoInfo := &RepoInfo{
 		ID:           mockRepoID,
@@ -169,6 +262,13 @@ func TestBuildPlan(t *testing.T) {
 			assert.True(plan.FilesToDownload[0].File.Path == "regular.txt", "Expected regular.txt to be in download plan, got %s", plan.FilesToDownload[0].File.Path)
 		}
 		assert.Len(plan.FilesToSkip, 1, "Expected 1 file to be skipped")
+		if len(plan.FilesToSkip) == 1 {
+			skip := plan.FilesToSkip[0]
+			assert.True(skip.Reason == ReasonUpToDate && skip.Verified == VerifySHA256, "Expected an up-to-date, SHA256-verified skip, got %s/%s", skip.Reason, skip.Verified)
+		}
+		if len(plan.FilesToDownload) == 1 {
+			assert.True(plan.FilesToDownload[0].Reason == ReasonMissing, "Expected reason missing, got %s", plan.FilesToDownload[0].Reason)
+		}
 	})
 
 	t.Run("Plan to re-download invalid file", func(t *testing.T) {
@@ -186,9 +286,91 @@ func TestBuildPlan(t *testing.T) {
 		require.NoError(err, "")
 
 		assert.Len(plan.FilesToDownload, 2, "Expected 2 files to be in the plan for re-download")
+		for _, f := range plan.FilesToDownload {
+			if f.File.Path == "lfs.bin" {
+				assert.True(f.Reason == ReasonSizeMismatch, "Expected reason size-mismatch, got %s", f.Reason)
+			}
+		}
 	})
 }
 
+func TestRejectedPaths(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	tmpDir := t.TempDir()
+	d := New(mockRepoID, WithDestination(tmpDir))
+	modelPath := d.getModelPath(mockRepoID)
+	outside := t.TempDir()
+	require.NoError(os.MkdirAll(modelPath, 0o755), "")
+	if err := os.Symlink(outside, filepath.Join(modelPath, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	repoInfo := &RepoInfo{
+		ID: mockRepoID,
+		Siblings: []HFFile{
+			{Path: "../escape.txt", Type: "file", Size: 1},
+			{Path: "linked/redirected.txt", Type: "file", Size: 1},
+			{Path: "..notes.txt", Type: "file", Size: 1},
+		},
+	}
+	plan, err := d.BuildPlan(context.Background(), repoInfo)
+	require.NoError(err, "")
+	require.Len(plan.FilesRejected, 2, "Expected the traversal and the symlinked path to be rejected")
+	assert.True(plan.FilesRejected[0].File.Path == "../escape.txt", "Unexpected rejection: %+v", plan.FilesRejected[0])
+	assert.True(plan.FilesRejected[1].File.Path == "linked/redirected.txt", "Unexpected rejection: %+v", plan.FilesRejected[1])
+	require.Len(plan.FilesToDownload, 1, "A name merely starting with '..' is not a traversal")
+	assert.True(plan.TotalDownloadSize == 1, "Rejected files must not count toward the download size")
+
+	// A plan built before the symlink appeared is still refused at execution.
+	stale := &DownloadPlan{
+		Repo:            repoInfo,
+		ModelPath:       modelPath,
+		FilesToDownload: []FileDownload{{File: repoInfo.Siblings[1], Reason: ReasonMissing}},
+	}
+	err = d.ExecutePlan(context.Background(), stale)
+	assert.Error(err, "Expected ExecutePlan to refuse a path through a symlink")
+	_, statErr := os.Stat(filepath.Join(outside, "redirected.txt"))
+	assert.True(os.IsNotExist(statErr), "Nothing should have been written outside the destination")
+}
+
+func TestSymlinkedFiles(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	server := setupMockServer(t, map[string]mockFile{
+		"regular.txt": {Path: "regular.txt", Content: nonLFSFileContent},
+	})
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID, WithDestination(t.TempDir()), WithPrune())
+	modelPath := d.getModelPath(mockRepoID)
+	target := filepath.Join(t.TempDir(), "target.txt")
+	require.NoError(os.MkdirAll(modelPath, 0o755), "")
+	require.NoError(os.WriteFile(target, []byte("kept outside"), 0o644), "")
+	if err := os.Symlink(target, filepath.Join(modelPath, "regular.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	require.NoError(os.Symlink(target, filepath.Join(modelPath, "stale.txt")), "")
+
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	plan, err := d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+	require.Len(plan.FilesRejected, 0, "A symlink at a file's own path is not a traversal: %+v", plan.FilesRejected)
+	require.Len(plan.FilesToDownload, 1, "Expected the mismatched link to be replaced")
+	require.Len(plan.FilesToDelete, 1, "Expected the stale link to be pruned")
+	require.NoError(d.ExecutePlan(context.Background(), plan), "")
+
+	verifyFileContent(t, filepath.Join(modelPath, "regular.txt"), nonLFSFileContent)
+	linkInfo, err := os.Lstat(filepath.Join(modelPath, "regular.txt"))
+	require.NoError(err, "")
+	assert.True(linkInfo.Mode().IsRegular(), "Expected the link to be replaced by a regular file")
+	_, err = os.Lstat(filepath.Join(modelPath, "stale.txt"))
+	assert.True(os.IsNotExist(err), "Expected the stale link to be deleted: %v", err)
+	verifyFileContent(t, target, "kept outside")
+}
+
 func TestExecutePlan(t *testing.T) {
 	require := testutils.NewRequire(t)
 	mockFiles := map[string]mockFile{
@@ -214,6 +396,77 @@ func TestExecutePlan(t *testing.T) {
 	verifyFileContent(t, filepath.Join(repoPath, "regular.txt"), nonLFSFileContent)
 }
 
+func TestDiskSpacePreflight(t *testing.T) {
+	largeFile := HFFile{Path: "big.bin", Type: "file", Size: 20 * 1024 * 1024, LFS: HFLFS{IsLFS: true, Oid: "abc", Size: 20 * 1024 * 1024}}
+	smallFile := HFFile{Path: "config.json", Type: "file", Size: 1024}
+	repoInfo := &RepoInfo{ID: mockRepoID, Siblings: []HFFile{largeFile, smallFile}}
+
+	origDiskFree := diskFree
+	defer func() { diskFree = origDiskFree }()
+
+	t.Run("Plan accounts for chunk staging", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		diskFree = func(string) (uint64, error) { return 1 << 40, nil }
+		d := New(mockRepoID, WithDestination(t.TempDir()))
+		plan, err := d.BuildPlan(context.Background(), repoInfo)
+		require.NoError(err, "")
+		expected := 2*largeFile.Size + smallFile.Size
+		assert.True(plan.RequiredBytes == expected, "Expected %d required bytes, got %d", expected, plan.RequiredBytes)
+		assert.True(plan.AvailableBytes == 1<<40, "Expected available bytes to come from the filesystem, got %d", plan.AvailableBytes)
+	})
+
+	t.Run("ExecutePlan fails early without enough space", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		diskFree = func(string) (uint64, error) { return 1024, nil }
+		tmpDir := t.TempDir()
+		d := New(mockRepoID, WithDestination(tmpDir))
+		plan, err := d.BuildPlan(context.Background(), repoInfo)
+		require.NoError(err, "")
+
+		err = d.ExecutePlan(context.Background(), plan)
+		require.Error(err, "Expected ExecutePlan to refuse to start")
+		assert.True(errors.Is(err, ErrInsufficientSpace), "Expected ErrInsufficientSpace, got: %v", err)
+		var spaceErr *InsufficientSpaceError
+		assert.True(errors.As(err, &spaceErr) && spaceErr.Available == 1024, "Expected an *InsufficientSpaceError with the available space")
+		_, statErr := os.Stat(d.getModelPath(mockRepoID))
+		assert.True(os.IsNotExist(statErr), "Expected nothing to be written before the check")
+	})
+}
+
+func TestDestinationLock(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	tmpDir := t.TempDir()
+	plan := &DownloadPlan{Repo: &RepoInfo{ID: mockRepoID}}
+
+	holder := New(mockRepoID, WithDestination(tmpDir))
+	modelPath := holder.getModelPath(mockRepoID)
+	require.NoError(os.MkdirAll(modelPath, 0o755), "")
+	lock, err := holder.acquireLock(context.Background(), modelPath)
+	require.NoError(err, "")
+
+	err = New(mockRepoID, WithDestination(tmpDir)).ExecutePlan(context.Background(), plan)
+	assert.True(errors.Is(err, ErrLocked), "Expected fail-fast ErrLocked, got: %v", err)
+	var lockErr *LockError
+	assert.True(errors.As(err, &lockErr) && lockErr.PID == os.Getpid(), "Expected the lock error to name the holder's PID, got: %v", err)
+
+	start := time.Now()
+	err = New(mockRepoID, WithDestination(tmpDir), WithLockWait(200*time.Millisecond)).ExecutePlan(context.Background(), plan)
+	assert.True(errors.Is(err, ErrLocked), "Expected a timeout wrapping ErrLocked, got: %v", err)
+	assert.True(time.Since(start) >= 200*time.Millisecond, "Expected ExecutePlan to wait for the timeout")
+
+	lock.release()
+	assert.NoError(New(mockRepoID, WithDestination(tmpDir)).ExecutePlan(context.Background(), plan), "Expected the lock to be free after release")
+
+	// A lock file left behind by a dead process must not block new runs.
+	host, _ := os.Hostname()
+	lockPath := filepath.Join(modelPath, metaDirName, lockFileName)
+	require.NoError(os.WriteFile(lockPath, []byte(fmt.Sprintf("%d %s\n", 1<<22+7, host)), 0o644), "")
+	assert.NoError(New(mockRepoID, WithDestination(tmpDir)).ExecutePlan(context.Background(), plan), "Expected a stale lock to be reclaimed")
+}
+
 func TestExecutePlan_ContinueOnError(t *testing.T) {
 	require := testutils.NewRequire(t)
 	assert := testutils.NewAssert(t)
@@ -229,15 +482,34 @@ func TestExecutePlan_ContinueOnError(t *testing.T) {
 	baseURL = server.URL
 
 	tmpDir := t.TempDir()
-	d := New(mockRepoID, WithDestination(tmpDir))
+	progressChan := make(chan Progress, 100)
+	d := New(mockRepoID, WithDestination(tmpDir), WithProgress(progressChan))
 	info, err := d.FetchRepoInfo(context.Background())
 	require.NoError(err, "")
 	plan, err := d.BuildPlan(context.Background(), info) // All files will be planned for download
 	require.NoError(err, "")
+	for len(progressChan) > 0 {
+		<-progressChan // Analysis updates
+	}
 
 	err = d.ExecutePlan(context.Background(), plan)
 	require.Error(err, "Expected ExecutePlan to return an error for checksum mismatch, but it didn't")
 	assert.True(strings.Contains(err.Error(), "validation failed for bad.bin"), "Expected error message to contain 'validation failed for bad.bin', but got: %v", err)
+	var downloadErr *DownloadError
+	assert.True(errors.As(err, &downloadErr) && downloadErr.Downloaded == 1, "Expected a *DownloadError with one downloaded file, got %#v", err)
+	assert.True(errors.Is(err, ErrChecksumMismatch), "Expected the error to wrap ErrChecksumMismatch, got %v", err)
+
+	// The failure is reported as a final progress state with the error.
+	close(progressChan)
+	final := make(map[string]Progress)
+	for p := range progressChan {
+		if p.State == ProgressStateVerified || p.State == ProgressStateFailed {
+			final[p.Filepath] = p
+		}
+	}
+	assert.True(final["bad.bin"].State == ProgressStateFailed && strings.Contains(final["bad.bin"].Message, "validation failed"),
+		"Expected a failed progress update for bad.bin, got %+v", final["bad.bin"])
+	assert.True(final["good.txt"].State == ProgressStateVerified, "Expected good.txt to be verified, got %+v", final["good.txt"])
 
 	// But the good file should still have been downloaded correctly
 	repoPath := d.getModelPath(mockRepoID)
@@ -286,6 +558,8 @@ func TestFiltering(t *testing.T) {
 
 		assert.Len(plan.FilesToDownload, 3, "Should exclude files in the data directory")
 		assert.False(findInPlan(plan.FilesToDownload, "data/train.parquet"), "")
+		require.Len(plan.FilesFiltered, 1, "Expected the excluded file to be listed as filtered")
+		assert.True(plan.FilesFiltered[0].File.Path == "data/train.parquet" && plan.FilesFiltered[0].Reason == ReasonFiltered, "Unexpected filtered entry: %+v", plan.FilesFiltered[0])
 	})
 
 	t.Run("Include and Exclude", func(t *testing.T) {
@@ -297,6 +571,1016 @@ func TestFiltering(t *testing.T) {
 		assert.True(findInPlan(plan.FilesToDownload, "model.safetensors"), "")
 		assert.True(findInPlan(plan.FilesToDownload, "tokenizer.json"), "")
 	})
+
+	t.Run("Pattern Syntax", func(t *testing.T) {
+		cases := []struct {
+			patterns []string
+			path     string
+			want     bool
+		}{
+			{[]string{"*.json"}, "tokenizer/vocab.json", true},    // No slash: matches the name at any depth
+			{[]string{"data/*"}, "data/train.parquet", true},      // Slash: anchored at the root
+			{[]string{"data/*"}, "sub/data/train.parquet", false}, //
+			{[]string{"data/*"}, "data/a/train.parquet", false},   // '*' does not cross '/'
+			{[]string{"**/*.json"}, "config.json", true},          // '**/' matches zero directories
+			{[]string{"**/*.json"}, "a/b/c.json", true},           // ...or several
+			{[]string{"onnx/**"}, "onnx/a/model.onnx", true},      //
+			{[]string{"a/**/b.txt"}, "a/b.txt", true},             //
+			{[]string{"a/**/b.txt"}, "a/x/y/b.txt", true},         //
+			{[]string{"*.{json,txt}"}, "notes.txt", true},         // Brace expansion
+			{[]string{"*.{json,txt}"}, "model.bin", false},        //
+			{[]string{"model-0000[1-2]-*.bin"}, "model-00002-of-00003.bin", true},
+			{[]string{"model-0000[!1-2]-*.bin"}, "model-00002-of-00003.bin", false},
+			{[]string{"[]]x"}, "]x", true},                       // A leading ']' is literal
+			{[]string{"[!]]x"}, "ax", true},                      //
+			{[]string{"[!]]x"}, "]x", false},                     //
+			{[]string{"[!]]x"}, "a]x", false},                    //
+			{[]string{"?.md"}, "a.md", true},                     //
+			{[]string{"onnx/"}, "onnx/model.onnx", true},         // Trailing '/': directory contents
+			{[]string{"onnx/"}, "sub/onnx/model.onnx", true},     //
+			{[]string{"onnx/"}, "onnx", false},                   //
+			{[]string{"/config.json"}, "sub/config.json", false}, // Leading '/' anchors
+			{[]string{`re:Q4_K_M\.gguf$`}, "m/model-Q4_K_M.gguf", true},
+			{[]string{"*.bin", "!*-fp32.bin"}, "model-fp32.bin", false},
+			{[]string{"*.bin", "!*-fp32.bin"}, "model-fp16.bin", true},
+			{[]string{"!*-fp32.bin", "*.bin"}, "model-fp32.bin", true}, // Last match wins
+			{[]string{`\!x.txt`}, "!x.txt", true},                      // Escaped '!'
+		}
+		for _, c := range cases {
+			d := New(mockRepoID, WithInclude(c.patterns...))
+			require.NoError(d.compileFilters(), "%v", c.patterns)
+			assert.True(d.shouldDownload(c.path) == c.want, "include %v on %q: got %v, want %v", c.patterns, c.path, !c.want, c.want)
+		}
+	})
+
+	t.Run("Invalid Patterns", func(t *testing.T) {
+		for _, bad := range []string{"[abc", "*.{json,txt", "re:(", `foo\`, "!"} {
+			d := New(mockRepoID, WithDestination(tmpDir), WithExclude(bad))
+			_, err := d.BuildPlan(context.Background(), repoInfo)
+			assert.Error(err, "Expected BuildPlan to reject the pattern %q", bad)
+		}
+	})
+}
+
+func TestSizeLimitsAndBudget(t *testing.T) {
+	repoInfo := &RepoInfo{
+		ID: mockRepoID,
+		Siblings: []HFFile{
+			{Path: "config.json", Type: "file", Size: 1 << 10},
+			{Path: "model-Q4_K_M.gguf", Type: "file", Size: 4 << 30},
+			{Path: "model-Q8_0.gguf", Type: "file", Size: 8 << 30},
+			{Path: "model-F16.gguf", Type: "file", Size: 16 << 30},
+		},
+	}
+	paths := func(files []FileDownload) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.File.Path)
+		}
+		return out
+	}
+
+	t.Run("Min and Max Size", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithMinFileSize(1<<20), WithMaxFileSize(10<<30))
+		plan, err := d.BuildPlan(context.Background(), repoInfo)
+		require.NoError(err, "")
+		assert.True(slices.Equal(paths(plan.FilesToDownload), []string{"model-Q4_K_M.gguf", "model-Q8_0.gguf"}), "Unexpected downloads: %v", paths(plan.FilesToDownload))
+		require.Len(plan.FilesFiltered, 2, "")
+		assert.True(plan.FilesFiltered[0].Reason == ReasonSizeLimit, "Expected size-limit, got %s", plan.FilesFiltered[0].Reason)
+	})
+
+	budgetCases := []struct {
+		priority BudgetPriority
+		want     []string
+	}{
+		{BudgetLargestFirst, []string{"config.json", "model-F16.gguf"}},
+		{BudgetSmallestFirst, []string{"config.json", "model-Q4_K_M.gguf", "model-Q8_0.gguf"}},
+		{BudgetRepoOrder, []string{"config.json", "model-Q4_K_M.gguf", "model-Q8_0.gguf"}},
+	}
+	for _, c := range budgetCases {
+		t.Run("Budget "+c.priority.String(), func(t *testing.T) {
+			require := testutils.NewRequire(t)
+			assert := testutils.NewAssert(t)
+			d := New(mockRepoID, WithDestination(t.TempDir()), WithDownloadBudget(19<<30, c.priority))
+			plan, err := d.BuildPlan(context.Background(), repoInfo)
+			require.NoError(err, "")
+			assert.True(slices.Equal(paths(plan.FilesToDownload), c.want), "Expected %v, got %v", c.want, paths(plan.FilesToDownload))
+			assert.True(plan.TotalDownloadSize <= 19<<30, "Plan exceeds the budget: %d", plan.TotalDownloadSize)
+			for _, f := range plan.FilesFiltered {
+				assert.True(f.Reason == ReasonOverBudget, "Expected over-budget, got %s", f.Reason)
+			}
+			assert.Len(plan.FilesFiltered, len(repoInfo.Siblings)-len(c.want), "Expected the files left out to be reported")
+		})
+	}
+
+	t.Run("Budget keeps split files whole", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		split := &RepoInfo{
+			ID: mockRepoID,
+			Siblings: []HFFile{
+				{Path: "Q8_0/model-Q8_0-00001-of-00002.gguf", Type: "file", Size: 20 << 30},
+				{Path: "Q8_0/model-Q8_0-00002-of-00002.gguf", Type: "file", Size: 10 << 30},
+				{Path: "model-Q4_K_M.gguf", Type: "file", Size: 12 << 30},
+				{Path: "model-00001-of-00002.safetensors", Type: "file", Size: 1 << 30},
+				{Path: "model-00002-of-00002.safetensors", Type: "file", Size: 1 << 30},
+			},
+		}
+		// Only the first Q8_0 part would fit on its own.
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithDownloadBudget(24<<30, BudgetLargestFirst))
+		plan, err := d.BuildPlan(context.Background(), split)
+		require.NoError(err, "")
+		want := []string{"model-Q4_K_M.gguf", "model-00001-of-00002.safetensors", "model-00002-of-00002.safetensors"}
+		assert.True(slices.Equal(paths(plan.FilesToDownload), want), "Expected %v, got %v", want, paths(plan.FilesToDownload))
+		assert.Len(plan.FilesFiltered, 2, "Expected both Q8_0 parts to be left out")
+	})
+}
+
+func TestGGUFQuant(t *testing.T) {
+	const gb = 1 << 30
+	siblings := []HFFile{
+		{Path: ".gitattributes", Type: "file", Size: 2000},
+		{Path: "README.md", Type: "file", Size: 9000},
+		{Path: "imatrix.dat", Type: "file", Size: 50 << 20},
+		{Path: "model.Q4_K_M.gguf", Type: "file", Size: 4 * gb},
+		{Path: "model.IQ3_XXS.gguf", Type: "file", Size: 3 * gb},
+		{Path: "Q8_0", Type: "directory"},
+		{Path: "Q8_0/model-Q8_0-00002-of-00002.gguf", Type: "file", Size: 3 * gb},
+		{Path: "Q8_0/model-Q8_0-00001-of-00002.gguf", Type: "file", Size: 5 * gb},
+		{Path: "UD-Q2_K_XL/model-00001-of-00003.gguf", Type: "file", Size: 1 * gb},
+		{Path: "UD-Q2_K_XL/model-00002-of-00003.gguf", Type: "file", Size: 1 * gb},
+		{Path: "mmproj-model-f16.gguf", Type: "file", Size: 600 << 20},
+		{Path: "mmproj-model-f32.gguf", Type: "file", Size: 1200 << 20},
+	}
+
+	t.Run("List Quantizations", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		quants := GGUFQuants(siblings)
+		require.Len(quants, 4, "Expected mmproj files to be ignored: %+v", quants)
+		var names []string
+		for _, q := range quants {
+			names = append(names, q.Name)
+		}
+		assert.True(slices.Equal(names, []string{"Q2_K_XL", "IQ3_XXS", "Q4_K_M", "Q8_0"}), "Expected quants sorted by size, got %v", names)
+
+		q8 := quants[3]
+		assert.True(q8.Size == 8*gb && q8.Parts == 2 && q8.Complete, "Unexpected Q8_0: %+v", q8)
+		assert.True(q8.Files[0].Path == "Q8_0/model-Q8_0-00001-of-00002.gguf", "Expected parts in order, got %s first", q8.Files[0].Path)
+		assert.False(quants[0].Complete, "Q2_K_XL is missing its third part")
+	})
+
+	t.Run("Select Quantization", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithQuant("q8_0"), WithMMProj())
+		plan, err := d.BuildPlan(context.Background(), &RepoInfo{ID: mockRepoID, Siblings: siblings})
+		require.NoError(err, "")
+		var got []string
+		for _, f := range plan.FilesToDownload {
+			got = append(got, f.File.Path)
+		}
+		want := []string{".gitattributes", "README.md", "Q8_0/model-Q8_0-00002-of-00002.gguf", "Q8_0/model-Q8_0-00001-of-00002.gguf", "mmproj-model-f16.gguf"}
+		assert.True(slices.Equal(got, want), "Expected %v, got %v", want, got)
+	})
+
+	t.Run("Unknown Quantization", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithQuant("Q5_K_S"))
+		_, err := d.BuildPlan(context.Background(), &RepoInfo{ID: mockRepoID, Siblings: siblings})
+		assert.True(errors.Is(err, ErrQuantNotFound), "Expected ErrQuantNotFound, got: %v", err)
+		assert.True(err != nil && strings.Contains(err.Error(), "Q4_K_M"), "Expected the error to list the available quants: %v", err)
+	})
+}
+
+func TestFormatPreference(t *testing.T) {
+	siblings := []HFFile{
+		{Path: "config.json", Type: "file"},
+		{Path: "model.safetensors", Type: "file"},
+		{Path: "pytorch_model.bin", Type: "file"},
+		{Path: "tf_model.h5", Type: "file"},
+		{Path: "flax_model.msgpack", Type: "file"},
+		{Path: "onnx/model.onnx", Type: "file"},
+		{Path: "training_args.bin", Type: "file"},
+		{Path: "text_encoder/pytorch_model.bin", Type: "file"}, // Only format in its directory
+	}
+	plan := func(t *testing.T, opts ...Option) (kept, dropped []string) {
+		t.Helper()
+		opts = append([]Option{WithDestination(t.TempDir())}, opts...)
+		p, err := New(mockRepoID, opts...).BuildPlan(context.Background(), &RepoInfo{ID: mockRepoID, Siblings: siblings})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range p.FilesToDownload {
+			kept = append(kept, f.File.Path)
+		}
+		for _, f := range p.FilesFiltered {
+			if f.Reason == ReasonDuplicateFormat {
+				dropped = append(dropped, f.File.Path)
+			}
+		}
+		return kept, dropped
+	}
+
+	t.Run("Default Prefers Safetensors", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		kept, dropped := plan(t, WithFormatPreference())
+		assert.True(slices.Equal(kept, []string{"config.json", "model.safetensors", "training_args.bin", "text_encoder/pytorch_model.bin"}), "Unexpected downloads: %v", kept)
+		assert.Len(dropped, 4, "Expected the .bin, .h5, .msgpack and .onnx duplicates to be filtered: %v", dropped)
+	})
+
+	t.Run("Custom Order", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		kept, _ := plan(t, WithFormatPreference(FormatONNX))
+		assert.True(slices.Contains(kept, "onnx/model.onnx") && !slices.Contains(kept, "model.safetensors"), "Expected ONNX to win: %v", kept)
+	})
+
+	t.Run("Respects Include Patterns", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		kept, dropped := plan(t, WithFormatPreference(), WithInclude("*.bin"))
+		assert.True(slices.Contains(kept, "pytorch_model.bin"), "An explicitly included format must not be dropped: %v", kept)
+		assert.Len(dropped, 0, "Nothing should be filtered as a duplicate: %v", dropped)
+	})
+
+	t.Run("Off By Default", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		kept, _ := plan(t)
+		assert.Len(kept, len(siblings), "Expected every file without WithFormatPreference")
+	})
+
+	t.Run("Adapter Beside Base Weights", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		adapter := []HFFile{
+			{Path: "model-00001-of-00002.safetensors", Type: "file"},
+			{Path: "model-00002-of-00002.safetensors", Type: "file"},
+			{Path: "model.safetensors.index.json", Type: "file"},
+			{Path: "pytorch_model.bin", Type: "file"},
+			{Path: "adapter_model.bin", Type: "file"},
+			{Path: "lora/adapter_model.bin", Type: "file"},
+			{Path: "lora/adapter_model.safetensors", Type: "file"},
+		}
+		p, err := New(mockRepoID, WithDestination(t.TempDir()), WithFormatPreference(FormatSafetensors)).
+			BuildPlan(context.Background(), &RepoInfo{ID: mockRepoID, Siblings: adapter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kept []string
+		for _, f := range p.FilesToDownload {
+			kept = append(kept, f.File.Path)
+		}
+		want := []string{"model-00001-of-00002.safetensors", "model-00002-of-00002.safetensors", "model.safetensors.index.json", "adapter_model.bin", "lora/adapter_model.safetensors"}
+		assert.True(slices.Equal(kept, want), "Expected %v, got %v", want, kept)
+	})
+}
+
+// Pickles as written by Python: an OrderedDict (protocol 2) and an object
+// whose __reduce__ calls os.system (protocol 4, resolved via STACK_GLOBAL).
+const (
+	safePickle = "\x80\x02ccollections\nOrderedDict\nq\x00)Rq\x01X\x01\x00\x00\x00wq\x02G?\xf8\x00\x00\x00\x00\x00\x00s."
+	evilPickle = "\x80\x04\x95\"\x00\x00\x00\x00\x00\x00\x00\x8c\x05posix\x94\x8c\x06system\x94\x93\x94\x8c\x07echo hi\x94\x85\x94R\x94."
+)
+
+func TestPickleScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	torchZip := func(pickle string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("archive/data.pkl")
+		_, _ = w.Write([]byte(pickle))
+		w, _ = zw.Create("archive/data/0")
+		_, _ = w.Write(make([]byte, 64))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("Scan Files", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+
+		report, err := ScanPickleFile(write("safe.pkl", []byte(safePickle)))
+		require.NoError(err, "")
+		require.True(report != nil, "Expected a report for a pickle")
+		assert.False(report.Unsafe(), "Expected an OrderedDict to be safe: %+v", report)
+
+		report, err = ScanPickleFile(write("evil.pkl", []byte(evilPickle)))
+		require.NoError(err, "")
+		assert.True(report.Safety == PickleDangerous, "Expected posix.system to be dangerous: %+v", report)
+		require.Len(report.Globals, 1, "")
+		assert.True(report.Globals[0].String() == "posix.system", "Expected STACK_GLOBAL to be resolved, got %s", report.Globals[0])
+
+		// The safe pair is popped, so STACK_GLOBAL really takes posix.system.
+		report, err = ScanPickleFile(write("evasion.pkl", []byte("\x80\x04\x8c\x05posix\x8c\x06system\x8c\x0bcollections\x8c\x0bOrderedDict00\x93\x8c\x0aecho pwned\x85R.")))
+		require.NoError(err, "")
+		assert.True(report.Unsafe(), "Expected a STACK_GLOBAL on popped strings not to pass as safe: %+v", report)
+
+		report, err = ScanPickleFile(write("pytorch_model.bin", torchZip(evilPickle)))
+		require.NoError(err, "")
+		assert.True(report.Safety == PickleDangerous, "Expected the zip entry to be scanned: %+v", report)
+
+		report, err = ScanPickleFile(write("ggml-model.bin", []byte("GGUF\x03\x00\x00\x00")))
+		require.NoError(err, "")
+		assert.True(report == nil, "Expected no report for a file that is not a pickle")
+
+		report, err = ScanPickleFile(write("truncated.pkl", []byte(evilPickle[:20])))
+		require.NoError(err, "")
+		assert.True(report.Unsafe() && report.Error != "", "Expected a truncated pickle to be reported: %+v", report)
+	})
+
+	t.Run("Refuse Quarantines", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		mockFiles := map[string]mockFile{
+			"pytorch_model.bin": {Path: "pytorch_model.bin", Content: string(torchZip(evilPickle))},
+			"optimizer.pt":      {Path: "optimizer.pt", Content: safePickle},
+		}
+		server := setupMockServer(t, mockFiles)
+		defer server.Close()
+		baseURL = server.URL
+
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithPickleScan(PickleScanRefuse))
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		err = d.ExecutePlan(context.Background(), plan)
+		require.Error(err, "Expected the unsafe file to fail the run")
+		assert.True(strings.Contains(err.Error(), "posix.system"), "Expected the error to name the global: %v", err)
+		assert.Len(plan.PickleScans, 2, "Expected both pickle files in the report")
+
+		_, statErr := os.Stat(filepath.Join(plan.ModelPath, "pytorch_model.bin"))
+		assert.True(os.IsNotExist(statErr), "The unsafe file must not be left in place")
+		_, statErr = os.Stat(filepath.Join(plan.ModelPath, metaDirName, quarantineDirName, "pytorch_model.bin"))
+		assert.NoError(statErr, "Expected the unsafe file in quarantine")
+		verifyFileContent(t, filepath.Join(plan.ModelPath, "optimizer.pt"), safePickle)
+	})
+}
+
+// makeSafetensors builds a safetensors file from a JSON header and dataSize
+// bytes of tensor data.
+func makeSafetensors(header string, dataSize int) string {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(header)))
+	buf.WriteString(header)
+	buf.Write(make([]byte, dataSize))
+	return buf.String()
+}
+
+func TestInspectSafetensors(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	shard1 := makeSafetensors(`{"__metadata__":{"format":"pt"},"b":{"dtype":"F32","shape":[2,3],"data_offsets":[8,32]},"a":{"dtype":"BF16","shape":[4],"data_offsets":[0,8]}}`, 32)
+	shard2 := makeSafetensors(`{"c":{"dtype":"BF16","shape":[],"data_offsets":[0,2]}}`, 2)
+	// A header bigger than the prefetch needs a second Range request.
+	big := makeSafetensors(fmt.Sprintf(`{"__metadata__":{"pad":"%s"},"w":{"dtype":"F16","shape":[3],"data_offsets":[0,6]}}`, strings.Repeat("x", safetensorsPrefetch)), 6)
+	index := `{"metadata":{"total_size":42},"weight_map":{"a":"model-00001-of-00003.safetensors","b":"model-00001-of-00003.safetensors",
+		"c":"model-00002-of-00003.safetensors","d":"model-00003-of-00003.safetensors"}}`
+	mockFiles := map[string]mockFile{
+		"model-00001-of-00003.safetensors": {Path: "model-00001-of-00003.safetensors", Content: shard1, SHA256: "1111", IsLFS: true},
+		"model-00002-of-00003.safetensors": {Path: "model-00002-of-00003.safetensors", Content: shard2, SHA256: "2222", IsLFS: true},
+		"model.safetensors.index.json":     {Path: "model.safetensors.index.json", Content: index},
+		"big.safetensors":                  {Path: "big.safetensors", Content: big, SHA256: "3333", IsLFS: true},
+		"bogus.safetensors":                {Path: "bogus.safetensors", Content: "not a safetensors file at all"},
+		"README.md":                        {Path: "README.md", Content: "# readme"},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID)
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	headers, err := d.InspectSafetensors(context.Background(), info)
+	require.Error(err, "Expected the missing shard and the bogus file to be reported")
+	assert.True(strings.Contains(err.Error(), "model-00003-of-00003.safetensors is not in the repository"), "Expected the missing shard, got: %v", err)
+	assert.True(strings.Contains(err.Error(), "bogus.safetensors"), "Expected the unparseable file, got: %v", err)
+	require.Len(headers, 3, "Expected the readable headers despite the errors")
+
+	byPath := make(map[string]SafetensorsHeader)
+	for _, h := range headers {
+		byPath[h.Path] = h
+	}
+	h := byPath["model-00001-of-00003.safetensors"]
+	require.Len(h.Tensors, 2, "")
+	assert.True(h.Tensors[0].Name == "a" && h.Tensors[1].Name == "b", "Expected tensors in data order, got %+v", h.Tensors)
+	assert.True(h.Params() == 10 && h.TensorBytes() == 32, "Expected 10 params in 32 bytes, got %d in %d", h.Params(), h.TensorBytes())
+	assert.True(h.DTypes()["F32"] == 6 && h.DTypes()["BF16"] == 4, "Unexpected dtypes %v", h.DTypes())
+	assert.True(h.Metadata["format"] == "pt" && h.Size == int64(len(shard1)), "Unexpected header %+v", h)
+	assert.True(byPath["model-00002-of-00003.safetensors"].Params() == 1, "A scalar has one parameter")
+	assert.True(byPath["big.safetensors"].Tensors[0].Name == "w", "Expected the large header to be read in full")
+
+	local, err := ReadSafetensorsHeader(strings.NewReader(shard1))
+	require.NoError(err, "")
+	assert.True(local.Params() == 10, "Expected the same header from a local read")
+}
+
+// ggufKV is a metadata entry for encodeGGUF: a string, uint32, float32,
+// or []string value.
+type ggufKV struct {
+	key   string
+	value any
+}
+
+// encodeGGUF builds a version 3 GGUF header. Each tensor is a name, a ggml
+// type id and a shape.
+func encodeGGUF(kvs []ggufKV, tensors []GGUFTensor, types []uint32) string {
+	var buf bytes.Buffer
+	le := func(v any) { _ = binary.Write(&buf, binary.LittleEndian, v) }
+	str := func(s string) { le(uint64(len(s))); buf.WriteString(s) }
+	buf.WriteString("GGUF")
+	le(uint32(3))
+	le(uint64(len(tensors)))
+	le(uint64(len(kvs)))
+	for _, kv := range kvs {
+		str(kv.key)
+		switch v := kv.value.(type) {
+		case string:
+			le(ggufString)
+			str(v)
+		case uint32:
+			le(ggufUint32)
+			le(v)
+		case float32:
+			le(ggufFloat32)
+			le(v)
+		case []string:
+			le(ggufArray)
+			le(ggufString)
+			le(uint64(len(v)))
+			for _, s := range v {
+				str(s)
+			}
+		}
+	}
+	for i, t := range tensors {
+		str(t.Name)
+		le(uint32(len(t.Shape)))
+		for _, dim := range t.Shape {
+			le(dim)
+		}
+		le(types[i])
+		le(t.Offset)
+	}
+	return buf.String()
+}
+
+func TestInspectGGUF(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	// A vocabulary larger than the first Range request, so the header is
+	// read in several steps.
+	vocab := make([]string, 100)
+	for i := range vocab {
+		vocab[i] = strings.Repeat(string(rune('a'+i%26)), 4000)
+	}
+	part1 := encodeGGUF([]ggufKV{
+		{"general.architecture", "llama"},
+		{"general.file_type", uint32(15)},
+		{"llama.context_length", uint32(8192)},
+		{"llama.rope.freq_base", float32(500000)},
+		{"tokenizer.ggml.model", "gpt2"},
+		{"tokenizer.ggml.tokens", vocab},
+		{"general.tags", []string{"text-generation"}},
+		{"split.tensors.count", uint32(3)},
+	}, []GGUFTensor{
+		{Name: "token_embd.weight", Shape: []uint64{4096, 128}},
+		{Name: "output_norm.weight", Shape: []uint64{4096}, Offset: 1 << 20},
+	}, []uint32{12, 0}) + strings.Repeat("\x00", 1024)
+	mockFiles := map[string]mockFile{
+		"model-Q4_K_M-00001-of-00002.gguf": {Path: "model-Q4_K_M-00001-of-00002.gguf", Content: part1, SHA256: "1111", IsLFS: true},
+		"model-Q4_K_M-00002-of-00002.gguf": {Path: "model-Q4_K_M-00002-of-00002.gguf", Content: "GGUF part two", SHA256: "2222", IsLFS: true},
+		"model-Q8_0.gguf":                  {Path: "model-Q8_0.gguf", Content: "GGUF\x01\x00\x00\x00", SHA256: "3333", IsLFS: true},
+		"README.md":                        {Path: "README.md", Content: "# readme"},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID)
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	headers, err := d.InspectGGUF(context.Background(), info)
+	require.Error(err, "Expected the version 1 file to be reported")
+	assert.True(strings.Contains(err.Error(), "model-Q8_0.gguf: unsupported GGUF version 1"), "Unexpected error: %v", err)
+	require.Len(headers, 1, "Expected only the first part of the split model to be read")
+
+	h := headers[0]
+	assert.True(h.Quant == "Q4_K_M" && h.FileType() == "Q4_K_M", "Expected Q4_K_M from the name and the metadata, got %q and %q", h.Quant, h.FileType())
+	assert.True(h.Size == int64(len(part1)+len("GGUF part two")), "Expected the size of both parts, got %d", h.Size)
+	assert.True(h.Architecture() == "llama" && h.ContextLength() == 8192, "Unexpected architecture %q or context %d", h.Architecture(), h.ContextLength())
+	tokenizer, vocabSize := h.Tokenizer()
+	assert.True(tokenizer == "gpt2" && vocabSize == 100, "Unexpected tokenizer %q with %d tokens", tokenizer, vocabSize)
+	assert.True(h.Metadata["llama.rope.freq_base"] == float32(500000), "Unexpected float %v", h.Metadata["llama.rope.freq_base"])
+	assert.True(slices.Equal(h.Metadata["general.tags"].([]any), []any{"text-generation"}), "Expected a short array to be kept, got %v", h.Metadata["general.tags"])
+	assert.True(h.TensorCount() == 3 && len(h.Tensors) == 2, "Expected 3 tensors in the model, 2 in this part")
+	assert.True(h.Tensors[0].Type == "Q4_K" && h.Tensors[1].Type == "F32", "Unexpected tensor types %+v", h.Tensors)
+	assert.True(h.Params() == 4096*129, "Unexpected parameter count %d", h.Params())
+	assert.True(h.HeaderSize == int64(len(part1)-1024), "Expected the header to end at the tensor index, got %d", h.HeaderSize)
+
+	_, err = ReadGGUFHeader(strings.NewReader(part1[:5000]))
+	assert.True(errors.Is(err, io.ErrUnexpectedEOF), "Expected a truncated header to fail, got %v", err)
+}
+
+func TestValidateStructure(t *testing.T) {
+	write := func(t *testing.T, dir string, files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	shard1 := makeSafetensors(`{"a":{"dtype":"BF16","shape":[4],"data_offsets":[0,8]},"b":{"dtype":"F32","shape":[2,3],"data_offsets":[8,32]}}`, 32)
+	shard2 := makeSafetensors(`{"c":{"dtype":"BF16","shape":[],"data_offsets":[0,2]}}`, 2)
+	index := `{"weight_map":{"a":"model-00001-of-00002.safetensors","b":"model-00001-of-00002.safetensors","c":"model-00002-of-00002.safetensors"}}`
+
+	t.Run("complete", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		dir := t.TempDir()
+		write(t, dir, map[string]string{
+			"model-00001-of-00002.safetensors": shard1,
+			"model-00002-of-00002.safetensors": shard2,
+			"model.safetensors.index.json":     index,
+			metaDirName + "/junk.safetensors":  "ignored",
+		})
+		report, err := ValidateStructure(context.Background(), dir)
+		require.NoError(err, "")
+		assert.True(report.OK(), "Expected no issues, got %+v", report.Issues)
+		assert.Len(report.Checked, 3, "Checked %v", report.Checked)
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		dir := t.TempDir()
+		write(t, dir, map[string]string{
+			// Shard 2 was filtered out and shard 1 lost tensor b.
+			"model-00001-of-00002.safetensors": makeSafetensors(`{"a":{"dtype":"BF16","shape":[4],"data_offsets":[0,8]}}`, 8),
+			"model.safetensors.index.json":     index,
+			"truncated.safetensors":            shard1[:len(shard1)-4],
+			"overlap.safetensors":              makeSafetensors(`{"x":{"dtype":"F16","shape":[2],"data_offsets":[0,4]},"y":{"dtype":"F16","shape":[2],"data_offsets":[2,6]}}`, 6),
+			"wrongsize.safetensors":            makeSafetensors(`{"w":{"dtype":"F32","shape":[3],"data_offsets":[0,8]}}`, 8),
+			"sub/bogus.safetensors":            "not a safetensors file",
+		})
+		report, err := ValidateStructure(context.Background(), dir)
+		require.NoError(err, "")
+		issues := make(map[string]string)
+		for _, issue := range report.Issues {
+			issues[issue.Path] += issue.Detail + "; "
+		}
+		wants := map[string]string{
+			"model.safetensors.index.json": "shard model-00002-of-00002.safetensors is missing",
+			"truncated.safetensors":        "tensor b ends at byte 32 of a 28-byte data section",
+			"overlap.safetensors":          "tensor y overlaps x",
+			"wrongsize.safetensors":        "needs 12",
+			"sub/bogus.safetensors":        "",
+		}
+		for path, want := range wants {
+			got, ok := issues[path]
+			assert.True(ok && strings.Contains(got, want), "Issue for %s = %q, want %q", path, got, want)
+		}
+		assert.True(strings.Contains(issues["model.safetensors.index.json"], "b (in model-00001-of-00002.safetensors)"),
+			"Expected the missing tensor to be reported: %q", issues["model.safetensors.index.json"])
+		assert.Len(issues, len(wants), "Issues: %+v", report.Issues)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := ValidateStructure(context.Background(), filepath.Join(t.TempDir(), "nope"))
+		testutils.NewAssert(t).True(errors.Is(err, os.ErrNotExist), "Expected ErrNotExist, got %v", err)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	lfs := func(path string) HFFile {
+		size := int64(len(lfsFileContent))
+		return HFFile{Type: "file", Path: path, Size: size, LFS: HFLFS{IsLFS: true, Oid: lfsFileSHA256, Size: size}}
+	}
+	repoInfo := &RepoInfo{ID: mockRepoID, SHA: "abc123", Siblings: []HFFile{
+		{Type: "directory", Path: "sub"},
+		lfs("ok.bin"),
+		lfs("sub/corrupt.bin"),
+		lfs("short.bin"),
+		lfs("missing.bin"),
+		{Type: "file", Path: "config.json", Size: 2},
+		{Type: "file", Path: "skipped.md", Size: 4},
+	}}
+	d := New(mockRepoID, WithDestination(t.TempDir()), WithExcludePatterns([]string{"*.md", "*.log"}))
+	modelPath := d.getModelPath(mockRepoID)
+	corrupt := strings.Repeat("x", len(lfsFileContent))
+	for path, content := range map[string]string{
+		"ok.bin":          lfsFileContent,
+		"sub/corrupt.bin": corrupt,
+		"short.bin":       lfsFileContent[:10],
+		"config.json":     "{}",
+		"stray.txt":       "not in the repo",
+		"ignored.log":     "outside the filters",
+	} {
+		full := filepath.Join(modelPath, filepath.FromSlash(path))
+		require.NoError(os.MkdirAll(filepath.Dir(full), 0o755), "")
+		require.NoError(os.WriteFile(full, []byte(content), 0o644), "")
+	}
+
+	report, err := d.Verify(context.Background(), repoInfo)
+	require.NoError(err, "")
+	got := make(map[string]FileStatus)
+	for _, f := range report.Files {
+		got[f.Path] = f.Status
+	}
+	want := map[string]FileStatus{
+		"ok.bin":          FileOK,
+		"sub/corrupt.bin": FileChecksumMismatch,
+		"short.bin":       FileSizeMismatch,
+		"missing.bin":     FileMissing,
+		"config.json":     FileOK,
+		"stray.txt":       FileExtra,
+	}
+	assert.True(maps.Equal(got, want), "Statuses = %v, want %v", got, want)
+	assert.True(report.Revision == "abc123", "Revision = %q", report.Revision)
+	err = report.Err(false)
+	var verr *VerificationError
+	assert.True(errors.As(err, &verr) && verr.Failed == 4 && verr.Total == 6, "Unexpected error %v", err)
+	assert.True(errors.Is(report.Err(true), ErrVerification), "Mismatches must fail even with allowExtra")
+
+	// A lockfile round-trips the selected files and verifies the same way.
+	lock, err := d.NewLockfile(repoInfo)
+	require.NoError(err, "")
+	assert.Len(lock.Files, 5, "Expected the filtered files only: %v", lock.Files)
+	var buf bytes.Buffer
+	require.NoError(lock.WriteJSON(&buf), "")
+	read, err := ReadLockfile(&buf)
+	require.NoError(err, "")
+	fromLock, err := d.Verify(context.Background(), read.RepoInfo())
+	require.NoError(err, "")
+	assert.True(slices.Equal(fromLock.Files, report.Files), "Lockfile verify = %+v, want %+v", fromLock.Files, report.Files)
+
+	_, err = ReadLockfile(strings.NewReader(`{"version":99,"repo":"x"}`))
+	assert.Error(err, "Expected an error for an unknown lockfile version")
+}
+
+func TestScanCache(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	root := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(root, filepath.FromSlash(path))
+		require.NoError(os.MkdirAll(filepath.Dir(full), 0o755), "")
+		require.NoError(os.WriteFile(full, []byte(content), 0o644), "")
+	}
+	synced := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	state, err := json.Marshal(syncState{Repo: "org/flat_model", Revision: "main", Commit: "abc123", LastSync: synced, Files: map[string]fileRecord{}})
+	require.NoError(err, "")
+	write("org_flat_model/.hfget/state.json", string(state))
+	write("org_flat_model/weights.bin", "0123456789")
+	write("org_flat_model/.tmp/chunk", "xx")
+	write("org/tree-model/.hfget/lock", "")
+	write("org/tree-model/config.json", "{}")
+	write("notes/todo.txt", "not a repository")
+	// A huggingface_hub cache entry with an older snapshot.
+	write("models--org--hub-model/blobs/1111", strings.Repeat("a", 20))
+	write("models--org--hub-model/blobs/2222", strings.Repeat("b", 30))
+	write("models--org--hub-model/refs/main", "new\n")
+	for snapshot, blob := range map[string]string{"old": "1111", "new": "2222"} {
+		dir := filepath.Join(root, "models--org--hub-model", "snapshots", snapshot)
+		require.NoError(os.MkdirAll(dir, 0o755), "")
+		require.NoError(os.Symlink(filepath.Join("..", "..", "blobs", blob), filepath.Join(dir, "model.bin")), "")
+	}
+	write("datasets--org--data/snapshots/only/train.csv", "a,b")
+
+	d := New("", WithDestination(root))
+	repos, err := d.ScanCache(context.Background())
+	require.NoError(err, "")
+	byRepo := make(map[string]CachedRepo)
+	for _, r := range repos {
+		byRepo[r.Repo] = r
+	}
+	assert.Len(repos, 4, "Repos: %+v", repos)
+
+	flat := byRepo["org/flat_model"]
+	assert.True(flat.Layout == LayoutFlat && flat.Commit == "abc123" && flat.LastSync.Equal(synced), "Unexpected flat repo %+v", flat)
+	assert.True(flat.Files == 1 && flat.Size == int64(10+2+len(state)), "Unexpected flat counts %+v", flat)
+
+	tree := byRepo["org/tree-model"]
+	assert.True(tree.Layout == LayoutTree && tree.Files == 1 && !tree.LastSync.IsZero(), "Unexpected tree repo %+v", tree)
+
+	hub := byRepo["org/hub-model"]
+	assert.True(hub.Layout == LayoutHub && hub.Commit == "new" && hub.Revision == "main", "Unexpected hub repo %+v", hub)
+	assert.True(hub.Files == 1 && hub.Size == 20+30+4, "Unexpected hub counts %+v", hub)
+
+	data := byRepo["org/data"]
+	assert.True(data.IsDataset && data.Commit == "only" && data.Files == 1, "Unexpected dataset %+v", data)
+
+	require.NoError(d.RemoveCached(context.Background(), tree), "")
+	_, err = os.Stat(filepath.Join(root, "org"))
+	assert.True(os.IsNotExist(err), "Expected the emptied organisation directory to be removed: %v", err)
+}
+
+func TestSelectPrune(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	repos := []CachedRepo{
+		{Repo: "recent", Size: 100, LastSync: now.Add(-1 * day)},
+		{Repo: "oldest", Size: 50, LastSync: now.Add(-90 * day)},
+		{Repo: "middle", Size: 200, LastSync: now.Add(-10 * day)},
+	}
+	names := func(repos []CachedRepo) []string {
+		var out []string
+		for _, r := range repos {
+			out = append(out, r.Repo)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		opts PruneOptions
+		want []string
+	}{
+		{PruneOptions{OlderThan: 30 * day, Now: now}, []string{"oldest"}},
+		{PruneOptions{MaxSize: 250, Now: now}, []string{"oldest", "middle"}},
+		{PruneOptions{MaxSize: 300, Now: now}, []string{"oldest"}},
+		{PruneOptions{OlderThan: 5 * day, MaxSize: 1000, Now: now}, []string{"oldest", "middle"}},
+		{PruneOptions{MaxSize: 1000, Now: now}, nil},
+	} {
+		got := names(SelectPrune(repos, tc.opts))
+		assert.True(slices.Equal(got, tc.want), "SelectPrune(%+v) = %v, want %v", tc.opts, got, tc.want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	mockFiles := map[string]mockFile{
+		"config.json": {Path: "config.json", Content: nonLFSFileContent},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	tmpDir := t.TempDir()
+	d := New(mockRepoID, WithDestination(tmpDir), WithPrune(), WithExclude("notes.txt"))
+	modelPath := d.getModelPath(mockRepoID)
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	// A directory listed without its contents must be left untouched.
+	info.Siblings = append(info.Siblings, HFFile{Type: "directory", Path: "onnx"})
+	for _, name := range []string{"model-00001-of-00002.json", "old/shard.json", "notes.txt", "onnx/model.json"} {
+		path := filepath.Join(modelPath, filepath.FromSlash(name))
+		require.NoError(os.MkdirAll(filepath.Dir(path), 0o755), "")
+		require.NoError(os.WriteFile(path, []byte("stale"), 0o644), "")
+	}
+	// hfget's own bookkeeping must never be pruned.
+	require.NoError(os.MkdirAll(filepath.Join(modelPath, stagingDirName), 0o755), "")
+	require.NoError(os.WriteFile(filepath.Join(modelPath, stagingDirName, "chunk.tmp"), []byte("x"), 0o644), "")
+
+	plan, err := d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+
+	require.Len(plan.FilesToDelete, 2, "Expected the two in-scope stale files, got %v", plan.FilesToDelete)
+	assert.True(plan.TotalDeleteSize == 10, "Expected 10 bytes to delete, got %d", plan.TotalDeleteSize)
+
+	require.NoError(d.ExecutePlan(context.Background(), plan), "")
+	_, err = os.Stat(filepath.Join(modelPath, "model-00001-of-00002.json"))
+	assert.True(os.IsNotExist(err), "Expected stale file to be deleted")
+	_, err = os.Stat(filepath.Join(modelPath, "old"))
+	assert.True(os.IsNotExist(err), "Expected emptied directory to be removed")
+	_, err = os.Stat(filepath.Join(modelPath, "notes.txt"))
+	assert.NoError(err, "Expected excluded file to be kept")
+	_, err = os.Stat(filepath.Join(modelPath, stagingDirName, "chunk.tmp"))
+	assert.NoError(err, "Expected staging files to be kept")
+	verifyFileContent(t, filepath.Join(modelPath, "config.json"), nonLFSFileContent)
+}
+
+func TestPlanDeleteConfinement(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	mockFiles := map[string]mockFile{
+		"config.json": {Path: "config.json", Content: nonLFSFileContent},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	tmpDir := t.TempDir()
+	outside := filepath.Join(tmpDir, "authorized_keys")
+	require.NoError(os.WriteFile(outside, []byte("keep me"), 0o644), "")
+	d := New(mockRepoID, WithDestination(filepath.Join(tmpDir, "models")), WithPrune())
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	plan, err := d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+
+	for _, path := range []string{"../../authorized_keys", "/etc/passwd"} {
+		tampered := *plan
+		tampered.FilesToDelete = []FileDelete{{Path: path}}
+		var buf strings.Builder
+		require.NoError(tampered.WriteJSON(&buf), "")
+		_, err = ReadPlan(strings.NewReader(buf.String()))
+		assert.Error(err, "Expected ReadPlan to reject a plan deleting %s", path)
+	}
+
+	// ExecutePlan refuses too, for plans that did not come from ReadPlan.
+	plan.FilesToDelete = []FileDelete{{Path: "../../authorized_keys"}}
+	err = d.ExecutePlan(context.Background(), plan)
+	assert.True(err != nil && strings.Contains(err.Error(), "refusing to delete"), "Expected the delete to be refused, got: %v", err)
+	verifyFileContent(t, outside, "keep me")
+
+	// A stale file that is back in the repository makes the plan stale.
+	plan.FilesToDelete = []FileDelete{{Path: "config.json"}}
+	err = d.CheckPlan(context.Background(), plan)
+	assert.True(errors.Is(err, ErrPlanStale), "Expected ErrPlanStale for a delete now in the remote, got: %v", err)
+}
+
+func TestConflictPolicy(t *testing.T) {
+	mockFiles := map[string]mockFile{
+		"generation_config.json": {Path: "generation_config.json", Content: nonLFSFileContent},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+	const edited = "a hand-edited generation config"
+
+	// syncAndEdit downloads the repo once, then edits the file locally.
+	syncAndEdit := func(t *testing.T, opts ...Option) (*Downloader, *DownloadPlan, string) {
+		require := testutils.NewRequire(t)
+		opts = append([]Option{WithDestination(t.TempDir())}, opts...)
+		d := New(mockRepoID, opts...)
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+
+		path := filepath.Join(d.getModelPath(mockRepoID), "generation_config.json")
+		require.NoError(os.WriteFile(path, []byte(edited), 0o644), "")
+		plan, err = d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		require.Len(plan.FilesConflicted, 1, "Expected the edited file to be reported as a conflict")
+		return d, plan, path
+	}
+
+	t.Run("Overwrite", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		d, plan, path := syncAndEdit(t)
+		require.Len(plan.FilesToDownload, 1, "Expected the conflict to be downloaded")
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+		verifyFileContent(t, path, nonLFSFileContent)
+	})
+
+	t.Run("Keep", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		d, plan, path := syncAndEdit(t, WithConflictPolicy(ConflictKeep))
+		require.Len(plan.FilesToDownload, 0, "Expected the conflict not to be downloaded")
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+		verifyFileContent(t, path, edited)
+	})
+
+	t.Run("Backup", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		d, plan, path := syncAndEdit(t, WithConflictPolicy(ConflictBackup))
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+		verifyFileContent(t, path, nonLFSFileContent)
+		verifyFileContent(t, path+backupSuffix, edited)
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		d, plan, path := syncAndEdit(t, WithConflictPolicy(ConflictFail))
+		err := d.ExecutePlan(context.Background(), plan)
+		assert.True(errors.Is(err, ErrConflict), "Expected ErrConflict, got: %v", err)
+		verifyFileContent(t, path, edited)
+	})
+
+	t.Run("Touched file is recorded again", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()))
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+
+		modelPath := d.getModelPath(mockRepoID)
+		touched := time.Now().Add(-time.Hour).Truncate(time.Second)
+		require.NoError(os.Chtimes(filepath.Join(modelPath, "generation_config.json"), touched, touched), "")
+		plan, err = d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		require.Len(plan.FilesToSkip, 1, "Expected the unchanged content to be skipped")
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+		rec := loadSyncState(modelPath).Files["generation_config.json"]
+		assert.True(rec.ModTime.Equal(touched), "Expected the new modification time to be recorded, got %v", rec.ModTime)
+	})
+
+	t.Run("Partial download is not a conflict", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithConflictPolicy(ConflictFail))
+		path := filepath.Join(d.getModelPath(mockRepoID), "generation_config.json")
+		require.NoError(os.MkdirAll(filepath.Dir(path), 0o755), "")
+		require.NoError(os.WriteFile(path, []byte("trunc"), 0o644), "")
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		assert.Len(plan.FilesConflicted, 0, "Expected no conflict without a sync record")
+		assert.Len(plan.FilesToDownload, 1, "Expected the partial file to be re-downloaded")
+	})
+}
+
+func TestFailedRedownloadIsNotAConflict(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	server := setupMockServer(t, map[string]mockFile{
+		"lfs.bin": {Path: "lfs.bin", Content: lfsFileContent, SHA256: lfsFileSHA256, IsLFS: true},
+	})
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID, WithDestination(t.TempDir()), WithConflictPolicy(ConflictKeep))
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	plan, err := d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+	require.NoError(d.ExecutePlan(context.Background(), plan), "")
+
+	// The file changes on the remote, but the new copy fails its checksum
+	// after overwriting the synced one.
+	updated := setupMockServer(t, map[string]mockFile{
+		"lfs.bin": {Path: "lfs.bin", Content: "a corrupted update", SHA256: strings.Repeat("ab", 32), IsLFS: true},
+	})
+	defer updated.Close()
+	baseURL = updated.URL
+	info, err = d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	plan, err = d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+	require.Len(plan.FilesToDownload, 1, "Expected the changed file to be downloaded")
+	require.Error(d.ExecutePlan(context.Background(), plan), "Expected the checksum to fail")
+
+	plan, err = d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+	assert.Len(plan.FilesConflicted, 0, "A failed download must not look like a local edit: %+v", plan.FilesConflicted)
+	assert.Len(plan.FilesToDownload, 1, "Expected the file to be downloaded again")
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	require := testutils.NewRequire(t)
+	assert := testutils.NewAssert(t)
+	mockFiles := map[string]mockFile{
+		"lfs.bin":     {Path: "lfs.bin", Content: lfsFileContent, SHA256: lfsFileSHA256, IsLFS: true},
+		"regular.txt": {Path: "regular.txt", Content: nonLFSFileContent},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	d := New(mockRepoID, WithDestination(t.TempDir()))
+	info, err := d.FetchRepoInfo(context.Background())
+	require.NoError(err, "")
+	plan, err := d.BuildPlan(context.Background(), info)
+	require.NoError(err, "")
+
+	var buf strings.Builder
+	require.NoError(plan.WriteJSON(&buf), "")
+	read, err := ReadPlan(strings.NewReader(buf.String()))
+	require.NoError(err, "")
+	assert.True(read.ModelPath == plan.ModelPath, "Expected model path %q, got %q", plan.ModelPath, read.ModelPath)
+	assert.Len(read.FilesToDownload, 2, "Expected both downloads to round-trip")
+	require.NoError(d.CheckPlan(context.Background(), read), "An unchanged remote should match the plan")
+
+	// A different applier executes the plan without rebuilding it.
+	require.NoError(New(mockRepoID).ExecutePlan(context.Background(), read), "")
+	verifyFileContent(t, filepath.Join(plan.ModelPath, "lfs.bin"), lfsFileContent)
+
+	read.FilesToDownload[0].File.Oid = "stale"
+	read.FilesToDownload[0].File.LFS = HFLFS{}
+	err = d.CheckPlan(context.Background(), read)
+	assert.True(errors.Is(err, ErrPlanStale), "Expected ErrPlanStale, got: %v", err)
+
+	_, err = ReadPlan(strings.NewReader(`{"version":99}`))
+	assert.Error(err, "Expected an unknown plan version to be rejected")
+
+	written := buf.String()
+	require.True(strings.Contains(written, `"reason": "missing"`), "Expected reasons to be written by name")
+	_, err = ReadPlan(strings.NewReader(strings.Replace(written, `"reason": "missing"`, `"reason": "unknown"`, 1)))
+	assert.Error(err, "Expected the unknown reason to be rejected")
+	_, err = ReadPlan(strings.NewReader(regexp.MustCompile(`,\s*"reason": "missing"`).ReplaceAllString(written, "")))
+	assert.Error(err, "Expected a download without a reason to be rejected")
 }
 
 func TestProgressReporting_MultiThreaded(t *testing.T) {
@@ -348,7 +1632,113 @@ func TestProgressReporting_MultiThreaded(t *testing.T) {
 	close(progressChan)
 	wg.Wait()
 
-	assert.True(len(receivedProgress) > 0, "Should have received progress updates")
+	require.True(len(receivedProgress) > 0, "Should have received progress updates")
+	last := receivedProgress[len(receivedProgress)-1]
+	assert.True(last.Chunks == 5 && last.ChunksDone == 5, "Expected the last update to count every chunk as done, got %d/%d", last.ChunksDone, last.Chunks)
+}
+
+func TestExecutePlan_Cancellation(t *testing.T) {
+	largeContent := strings.Repeat("a", 15*1024*1024)
+	largeFileSHA := "c95dc452b90f6eb04214518917a99f84cec17207b57bb752c2e896a63c299786"
+	mockFiles := map[string]mockFile{
+		"largefile.bin": {Path: "largefile.bin", Content: largeContent, SHA256: largeFileSHA, IsLFS: true},
+	}
+	server := setupMockServer(t, mockFiles)
+	defer server.Close()
+	baseURL = server.URL
+
+	t.Run("Cancelled context stops before any work", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		tmpDir := t.TempDir()
+		d := New(mockRepoID, WithDestination(tmpDir), WithNumConnections(5))
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = d.ExecutePlan(ctx, plan)
+		require.Error(err, "Expected an error from a cancelled context")
+		assert.True(errors.Is(err, context.Canceled), "Expected error to wrap context.Canceled, got: %v", err)
+		_, statErr := os.Stat(filepath.Join(d.getModelPath(mockRepoID), "largefile.bin"))
+		assert.True(os.IsNotExist(statErr), "Expected no output file after cancellation")
+	})
+
+	t.Run("Unread progress channel does not block after cancellation", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		d := New(mockRepoID, WithDestination(t.TempDir()), WithNumConnections(5))
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+
+		// Nobody reads this channel, so the final states cannot be delivered.
+		d = New(mockRepoID, WithDestination(d.destinationBasePath), WithNumConnections(5), WithProgress(make(chan Progress)))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- d.ExecutePlan(ctx, plan) }()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("ExecutePlan blocked on the progress channel after its context was cancelled")
+		}
+	})
+
+	t.Run("Resumes from staged chunk files", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		tmpDir := t.TempDir()
+		d := New(mockRepoID, WithDestination(tmpDir), WithNumConnections(5))
+		info, err := d.FetchRepoInfo(context.Background())
+		require.NoError(err, "")
+		plan, err := d.BuildPlan(context.Background(), info)
+		require.NoError(err, "")
+		require.Len(plan.FilesToDownload, 1, "")
+
+		// Simulate an interrupted run: chunk 0 complete, chunk 1 half written.
+		file := plan.FilesToDownload[0].File
+		stagingDir := filepath.Join(d.getModelPath(mockRepoID), ".tmp")
+		require.NoError(os.MkdirAll(stagingDir, 0o755), "")
+		chunkSize := len(largeContent) / 5
+		require.NoError(os.WriteFile(chunkFileName(stagingDir, file, 0, 5), []byte(largeContent[:chunkSize]), 0o644), "")
+		require.NoError(os.WriteFile(chunkFileName(stagingDir, file, 1, 5), []byte(largeContent[chunkSize:chunkSize+chunkSize/2]), 0o644), "")
+
+		require.NoError(d.ExecutePlan(context.Background(), plan), "")
+		verifyFileContent(t, filepath.Join(d.getModelPath(mockRepoID), "largefile.bin"), largeContent)
+		_, statErr := os.Stat(stagingDir)
+		require.True(os.IsNotExist(statErr), "Expected staging directory to be removed after a successful merge")
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Schedule overrides default rate", func(t *testing.T) {
+		assert := testutils.NewAssert(t)
+		night := RateWindow{Start: 22 * time.Hour, End: 6 * time.Hour, BytesPerSec: 0}
+		day := RateWindow{Start: 9 * time.Hour, End: 17 * time.Hour, BytesPerSec: 1024}
+		l := newRateLimiter(4096, []RateWindow{night, day})
+
+		at := func(hour int) time.Time { return time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local) }
+		assert.True(l.currentRate(at(23)) == 0, "Expected unlimited rate before midnight")
+		assert.True(l.currentRate(at(3)) == 0, "Expected unlimited rate after midnight")
+		assert.True(l.currentRate(at(12)) == 1024, "Expected the daytime window rate")
+		assert.True(l.currentRate(at(19)) == 4096, "Expected the default rate outside any window")
+	})
+
+	t.Run("Throttles reads to the configured rate", func(t *testing.T) {
+		require := testutils.NewRequire(t)
+		assert := testutils.NewAssert(t)
+		d := New(mockRepoID, WithRateLimit(256*1024))
+		// The bucket starts full, so 384 KB should take about half a second.
+		src := strings.NewReader(strings.Repeat("x", 384*1024))
+		start := time.Now()
+		n, err := io.Copy(io.Discard, d.throttle(context.Background(), src))
+		require.NoError(err, "")
+		assert.True(n == 384*1024, "Expected all bytes to be copied, got %d", n)
+		elapsed := time.Since(start)
+		assert.True(elapsed >= 400*time.Millisecond, "Expected throttling to slow the copy, took %v", elapsed)
+	})
 }
 
 func TestTimeoutHandling(t *testing.T) {
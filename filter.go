@@ -0,0 +1,230 @@
+package hfget
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Include and exclude patterns are matched against repository paths, which
+// always use '/' as the separator:
+//
+//   - '*' matches any run of characters except '/', '?' matches one such
+//     character, and '[abc]', '[a-z]' and '[!abc]' are character classes.
+//   - '**' as a whole path segment matches zero or more directories, so
+//     "**/*.json" matches "a.json" and "a/b/c.json".
+//   - '{json,txt}' matches either alternative; braces may be nested.
+//   - A pattern without a '/' matches the file name at any depth: "*.json"
+//     matches "tokenizer/vocab.json". A pattern containing a '/' matches the
+//     whole path from the repository root; a leading '/' only anchors it.
+//   - A trailing '/' matches everything inside a directory: "onnx/" matches
+//     "onnx/model.onnx" and "sub/onnx/model.onnx".
+//   - "re:" introduces a Go regular expression that is matched, unanchored,
+//     against the full path.
+//   - A leading '!' negates a pattern. Patterns are evaluated in order and the
+//     last one that matches decides, so "*.bin,!*-fp32.bin" selects every .bin
+//     except the fp32 ones. A negated pattern only removes files matched by an
+//     earlier pattern in the same list.
+//   - '\' quotes the next character, e.g. "\!important.txt".
+
+// filterPattern is a compiled include or exclude pattern.
+type filterPattern struct {
+	negate bool
+	re     *regexp.Regexp
+}
+
+// filterSet is an ordered list of patterns where the last match wins.
+type filterSet []filterPattern
+
+// compileFilterSet compiles patterns, returning an error naming the first
+// invalid one.
+func compileFilterSet(patterns []string) (filterSet, error) {
+	set := make(filterSet, 0, len(patterns))
+	for _, raw := range patterns {
+		p, err := compileFilter(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", raw, err)
+		}
+		set = append(set, p)
+	}
+	return set, nil
+}
+
+func compileFilter(raw string) (filterPattern, error) {
+	var p filterPattern
+	pattern := raw
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if pattern == "" {
+		return p, fmt.Errorf("empty pattern")
+	}
+
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return p, err
+		}
+		p.re = re
+		return p, nil
+	}
+
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return p, fmt.Errorf("pattern matches nothing")
+	}
+
+	body, err := globToRegexp(pattern)
+	if err != nil {
+		return p, err
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	expr.WriteString(body)
+	if dirOnly {
+		expr.WriteString("/.*")
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return p, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// globToRegexp translates the glob syntax described above into an
+// unanchored regular expression.
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	braceDepth := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '*':
+			start := i
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+			if i == start {
+				b.WriteString("[^/]*")
+				break
+			}
+			atSegmentStart := start == 0 || glob[start-1] == '/'
+			switch {
+			case atSegmentStart && i+1 < len(glob) && glob[i+1] == '/':
+				b.WriteString("(?:.*/)?")
+				i++ // The '/' is part of the optional group.
+			case atSegmentStart && i+1 == len(glob):
+				b.WriteString(".*")
+			default:
+				b.WriteString("[^/]*") // '**' inside a segment is a plain '*'.
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(glob) && (glob[end] == '!' || glob[end] == '^') {
+				end++
+			}
+			if end < len(glob) && glob[end] == ']' {
+				end++ // A leading ']' is literal.
+			}
+			for end < len(glob) && glob[end] != ']' {
+				end++
+			}
+			if end == len(glob) {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : end]
+			b.WriteString("[")
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^/")
+				class = class[1:]
+			}
+			// Escape a leading ']' rather than rely on its position, which
+			// the "^/" above may have changed.
+			b.WriteString(strings.NewReplacer(`\`, `\\`, "]", `\]`).Replace(class))
+			b.WriteString("]")
+			i = end
+		case '{':
+			braceDepth++
+			b.WriteString("(?:")
+		case ',':
+			if braceDepth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '}':
+			if braceDepth > 0 {
+				braceDepth--
+				b.WriteString(")")
+			} else {
+				b.WriteString(`\}`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if braceDepth > 0 {
+		return "", fmt.Errorf("unterminated brace expression")
+	}
+	return b.String(), nil
+}
+
+// matches reports whether the last pattern in s that matches path is not
+// negated. An empty set matches nothing.
+func (s filterSet) matches(path string) bool {
+	matched := false
+	for _, p := range s {
+		if p.re.MatchString(path) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
+
+// compileFilters compiles the Downloader's include and exclude patterns.
+// BuildPlan calls it before any file is matched.
+func (d *Downloader) compileFilters() error {
+	include, err := compileFilterSet(d.includePatterns)
+	if err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	exclude, err := compileFilterSet(d.excludePatterns)
+	if err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	d.includeFilter, d.excludeFilter = include, exclude
+	return nil
+}
+
+// shouldDownload reports whether path passes the quantization selection and
+// the include and exclude patterns. Exclusions win; with no include patterns
+// every file is included.
+func (d *Downloader) shouldDownload(path string) bool {
+	if d.quantSelection != nil && !d.quantSelection[path] {
+		return false
+	}
+	if d.excludeFilter.matches(path) {
+		return false
+	}
+	if len(d.includeFilter) == 0 {
+		return true
+	}
+	return d.includeFilter.matches(path)
+}
@@ -0,0 +1,212 @@
+package hfget
+
+import (
+	"errors"
+	"fmt"
+	pathpkg "path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ggufCompanionMaxSize is the largest non-GGUF file (README, config,
+// tokenizer, imatrix...) that WithQuant selects alongside the chosen
+// quantization.
+const ggufCompanionMaxSize = 10 * 1024 * 1024
+
+// ErrQuantNotFound is matched by errors.Is for a *QuantNotFoundError.
+var ErrQuantNotFound = errors.New("quantization not found")
+
+// QuantNotFoundError reports a WithQuant name that the repository does not
+// provide, along with the quantizations it does.
+type QuantNotFoundError struct {
+	Quant     string
+	Available []string
+}
+
+func (e *QuantNotFoundError) Error() string {
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("quantization %s not found: the repository has no GGUF files", e.Quant)
+	}
+	return fmt.Sprintf("quantization %s not found; available: %s", e.Quant, strings.Join(e.Available, ", "))
+}
+
+// Is lets errors.Is(err, ErrQuantNotFound) match.
+func (e *QuantNotFoundError) Is(target error) bool {
+	return target == ErrQuantNotFound
+}
+
+var (
+	// ggufQuantPattern finds quantization names such as Q4_K_M, IQ3_XXS,
+	// Q8_0, TQ1_0, BF16 or F16 delimited by '-', '_', '.' or the ends.
+	ggufQuantPattern = regexp.MustCompile(`(?i)(?:^|[-_.])((?:[IT]?Q\d(?:_[A-Z0-9]+)*)|BF16|F16|F32|FP16|FP32|MXFP4)(?:[-_.]|$)`)
+	// ggufSplitPattern matches the part suffix of a split GGUF file.
+	ggufSplitPattern = regexp.MustCompile(`-(\d{5})-of-(\d{5})$`)
+)
+
+// GGUFQuant is one quantization offered by a GGUF repository. A quantization
+// split into several parts lists every part in order.
+type GGUFQuant struct {
+	Name     string   // Upper-case quantization name, e.g. "Q4_K_M"
+	Files    []HFFile // All parts, in part order
+	Size     int64    // Total size of all parts
+	Parts    int      // Number of parts the filenames announce (1 if not split)
+	Complete bool     // False if some announced parts are missing
+}
+
+// ggufInfo is what can be read from a single GGUF file name.
+type ggufInfo struct {
+	quant  string
+	part   int // 1-based; 0 if not split
+	parts  int
+	mmproj bool
+}
+
+// parseGGUFName extracts the quantization and split part from a repository
+// path. The quantization is taken from the file name, or from the nearest
+// directory that names one for per-quant folders. It reports false for
+// paths that are not GGUF files.
+func parseGGUFName(path string) (ggufInfo, bool) {
+	base := pathpkg.Base(path)
+	if !strings.EqualFold(pathpkg.Ext(base), ".gguf") {
+		return ggufInfo{}, false
+	}
+	stem := base[:len(base)-len(".gguf")]
+	info := ggufInfo{mmproj: strings.Contains(strings.ToLower(base), "mmproj")}
+	if m := ggufSplitPattern.FindStringSubmatch(stem); m != nil {
+		info.part, _ = strconv.Atoi(m[1])
+		info.parts, _ = strconv.Atoi(m[2])
+		stem = stem[:len(stem)-len(m[0])]
+	}
+	info.quant = lastQuant(stem)
+	for dir := pathpkg.Dir(path); info.quant == "" && dir != "." && dir != "/"; dir = pathpkg.Dir(dir) {
+		info.quant = lastQuant(pathpkg.Base(dir))
+	}
+	return info, true
+}
+
+// lastQuant returns the last quantization name in s, upper-cased.
+func lastQuant(s string) string {
+	// Matches share delimiters, so search again after each one to find
+	// adjacent names.
+	var quant string
+	for rest := s; ; {
+		loc := ggufQuantPattern.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			return strings.ToUpper(quant)
+		}
+		quant = rest[loc[2]:loc[3]]
+		rest = rest[loc[3]:]
+	}
+}
+
+// GGUFQuants groups the GGUF files in files by quantization, ignoring
+// multimodal projector (mmproj) files. The result is sorted by size.
+func GGUFQuants(files []HFFile) []GGUFQuant {
+	byName := make(map[string]*GGUFQuant)
+	parts := make(map[string]map[int]bool)
+	for _, f := range files {
+		if f.Type == "directory" {
+			continue
+		}
+		info, ok := parseGGUFName(f.Path)
+		if !ok || info.mmproj || info.quant == "" {
+			continue
+		}
+		q := byName[info.quant]
+		if q == nil {
+			q = &GGUFQuant{Name: info.quant, Parts: 1}
+			byName[info.quant] = q
+			parts[info.quant] = make(map[int]bool)
+		}
+		q.Files = append(q.Files, f)
+		q.Size += f.Size
+		if info.parts > q.Parts {
+			q.Parts = info.parts
+		}
+		parts[info.quant][max(info.part, 1)] = true
+	}
+
+	quants := make([]GGUFQuant, 0, len(byName))
+	for name, q := range byName {
+		sort.SliceStable(q.Files, func(i, j int) bool {
+			a, _ := parseGGUFName(q.Files[i].Path)
+			b, _ := parseGGUFName(q.Files[j].Path)
+			return a.part < b.part
+		})
+		q.Complete = len(parts[name]) == q.Parts
+		quants = append(quants, *q)
+	}
+	sort.Slice(quants, func(i, j int) bool {
+		if quants[i].Size != quants[j].Size {
+			return quants[i].Size < quants[j].Size
+		}
+		return quants[i].Name < quants[j].Name
+	})
+	return quants
+}
+
+// selectQuant returns the set of paths WithQuant downloads: every part of
+// the chosen quantization, every non-GGUF file up to ggufCompanionMaxSize
+// and, with WithMMProj, one multimodal projector.
+func (d *Downloader) selectQuant(files []HFFile) (map[string]bool, error) {
+	want := strings.ToUpper(d.quant)
+	var chosen *GGUFQuant
+	quants := GGUFQuants(files)
+	var names []string
+	for i, q := range quants {
+		names = append(names, q.Name)
+		if q.Name == want {
+			chosen = &quants[i]
+		}
+	}
+	if chosen == nil {
+		return nil, &QuantNotFoundError{Quant: d.quant, Available: names}
+	}
+	if !chosen.Complete {
+		d.logger.Printf("Warning: quantization %s announces %d parts but only %d are present", chosen.Name, chosen.Parts, len(chosen.Files))
+	}
+
+	selected := make(map[string]bool)
+	for _, f := range chosen.Files {
+		selected[f.Path] = true
+	}
+	var projectors []HFFile
+	for _, f := range files {
+		if f.Type == "directory" {
+			continue
+		}
+		info, isGGUF := parseGGUFName(f.Path)
+		switch {
+		case !isGGUF && f.Size <= ggufCompanionMaxSize:
+			selected[f.Path] = true
+		case isGGUF && info.mmproj:
+			projectors = append(projectors, f)
+		}
+	}
+	if d.withMMProj {
+		if p, ok := pickProjector(projectors, chosen.Name); ok {
+			selected[p.Path] = true
+		} else {
+			d.logger.Printf("Warning: no mmproj file found in the repository")
+		}
+	}
+	return selected, nil
+}
+
+// pickProjector chooses one mmproj file, preferring one with the same
+// quantization as the model, then F16, BF16 and F32.
+func pickProjector(projectors []HFFile, quant string) (HFFile, bool) {
+	for _, want := range []string{quant, "F16", "BF16", "F32"} {
+		for _, p := range projectors {
+			if info, _ := parseGGUFName(p.Path); info.quant == want {
+				return p, true
+			}
+		}
+	}
+	if len(projectors) > 0 {
+		return projectors[0], true
+	}
+	return HFFile{}, false
+}
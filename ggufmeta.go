@@ -0,0 +1,372 @@
+package hfget
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	// ggufMaxHeader is the most InspectGGUF reads from one file. Headers
+	// are dominated by the tokenizer's vocabulary, a few MiB at most.
+	ggufMaxHeader = 256 << 20
+	// ggufMaxString and ggufMaxCount bound lengths read from a header, so
+	// a corrupt file fails instead of exhausting memory.
+	ggufMaxString = 16 << 20
+	ggufMaxCount  = 1 << 26
+	// ggufMaxDims is GGML_MAX_DIMS.
+	ggufMaxDims = 4
+	// ggufKeepArray is the longest array kept in GGUFHeader.Metadata;
+	// longer ones, such as the vocabulary, are summarised as a GGUFArray.
+	ggufKeepArray = 64
+)
+
+// ggufMagic starts every GGUF file.
+const ggufMagic = "GGUF"
+
+// GGUF metadata value types.
+const (
+	ggufUint8 uint32 = iota
+	ggufInt8
+	ggufUint16
+	ggufInt16
+	ggufUint32
+	ggufInt32
+	ggufFloat32
+	ggufBool
+	ggufString
+	ggufArray
+	ggufUint64
+	ggufInt64
+	ggufFloat64
+)
+
+var ggufTypeNames = []string{"uint8", "int8", "uint16", "int16", "uint32", "int32", "float32", "bool", "string", "array", "uint64", "int64", "float64"}
+
+// ggmlTypeNames names the ggml tensor types by id.
+var ggmlTypeNames = map[uint32]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 6: "Q5_0", 7: "Q5_1", 8: "Q8_0", 9: "Q8_1",
+	10: "Q2_K", 11: "Q3_K", 12: "Q4_K", 13: "Q5_K", 14: "Q6_K", 15: "Q8_K",
+	16: "IQ2_XXS", 17: "IQ2_XS", 18: "IQ3_XXS", 19: "IQ1_S", 20: "IQ4_NL", 21: "IQ3_S", 22: "IQ2_S", 23: "IQ4_XS",
+	24: "I8", 25: "I16", 26: "I32", 27: "I64", 28: "F64", 29: "IQ1_M", 30: "BF16", 34: "TQ1_0", 35: "TQ2_0", 39: "MXFP4",
+}
+
+// ggufFileTypeNames names the values of general.file_type (llama_ftype).
+var ggufFileTypeNames = map[uint64]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M", 16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K",
+	19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S", 22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0", 38: "MXFP4_MOE",
+}
+
+// GGUFArray stands in for a metadata array too long to keep, such as
+// tokenizer.ggml.tokens.
+type GGUFArray struct {
+	Type string `json:"type"` // Element type, e.g. "string"
+	Len  uint64 `json:"len"`
+}
+
+// GGUFTensor describes one tensor in a GGUF file.
+type GGUFTensor struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"` // ggml type, e.g. "Q4_K"
+	Shape  []uint64 `json:"shape"`
+	Offset uint64   `json:"offset"` // Relative to the start of the tensor data
+}
+
+// Params returns the number of elements in the tensor.
+func (t GGUFTensor) Params() int64 {
+	n := int64(1)
+	for _, dim := range t.Shape {
+		n *= int64(dim)
+	}
+	return n
+}
+
+// GGUFHeader is the metadata and tensor index at the start of a GGUF file.
+type GGUFHeader struct {
+	Path       string         `json:"path"`
+	Quant      string         `json:"quant,omitempty"` // From the file name
+	Size       int64          `json:"size"`            // Of the file and, for a split model, every other part
+	Version    uint32         `json:"version"`
+	HeaderSize int64          `json:"headerSize"` // Bytes up to the end of the tensor index
+	Metadata   map[string]any `json:"metadata"`
+	Tensors    []GGUFTensor   `json:"tensors"` // In this file; see TensorCount for split models
+}
+
+// Architecture returns general.architecture, e.g. "llama".
+func (h GGUFHeader) Architecture() string {
+	s, _ := h.Metadata["general.architecture"].(string)
+	return s
+}
+
+// ContextLength returns <architecture>.context_length, or 0.
+func (h GGUFHeader) ContextLength() uint64 {
+	return ggufUint(h.Metadata[h.Architecture()+".context_length"])
+}
+
+// FileType returns the quantization recorded in general.file_type, e.g.
+// "Q4_K_M", or "" if it is missing.
+func (h GGUFHeader) FileType() string {
+	v, ok := h.Metadata["general.file_type"]
+	if !ok {
+		return ""
+	}
+	id := ggufUint(v)
+	if name, ok := ggufFileTypeNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", id)
+}
+
+// Tokenizer returns tokenizer.ggml.model, e.g. "gpt2", and the vocabulary
+// size.
+func (h GGUFHeader) Tokenizer() (string, uint64) {
+	model, _ := h.Metadata["tokenizer.ggml.model"].(string)
+	var vocab uint64
+	switch tokens := h.Metadata["tokenizer.ggml.tokens"].(type) {
+	case GGUFArray:
+		vocab = tokens.Len
+	case []any:
+		vocab = uint64(len(tokens))
+	}
+	return model, vocab
+}
+
+// TensorCount returns the number of tensors in the model, across all parts
+// of a split model.
+func (h GGUFHeader) TensorCount() uint64 {
+	if n := ggufUint(h.Metadata["split.tensors.count"]); n > 0 {
+		return n
+	}
+	return uint64(len(h.Tensors))
+}
+
+// Params returns the number of elements in the tensors of this file.
+func (h GGUFHeader) Params() int64 {
+	var n int64
+	for _, t := range h.Tensors {
+		n += t.Params()
+	}
+	return n
+}
+
+// ggufUint converts an unsigned or positive integer metadata value.
+func ggufUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint8:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	case uint32:
+		return uint64(n)
+	case uint64:
+		return n
+	case int32:
+		return uint64(max(n, 0))
+	case int64:
+		return uint64(max(n, 0))
+	}
+	return 0
+}
+
+// ggufReader decodes the little-endian values of a GGUF header and counts
+// the bytes consumed.
+type ggufReader struct {
+	r   *bufio.Reader
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func (r *ggufReader) read(n int) []byte {
+	if r.err != nil {
+		return r.buf[:n]
+	}
+	_, r.err = io.ReadFull(r.r, r.buf[:n])
+	r.n += int64(n)
+	return r.buf[:n]
+}
+
+func (r *ggufReader) u32() uint32 { return binary.LittleEndian.Uint32(r.read(4)) }
+func (r *ggufReader) u64() uint64 { return binary.LittleEndian.Uint64(r.read(8)) }
+
+// count reads a length and rejects implausible ones.
+func (r *ggufReader) count(limit uint64, what string) uint64 {
+	n := r.u64()
+	if r.err == nil && n > limit {
+		r.err = fmt.Errorf("%s %d exceeds the limit of %d", what, n, limit)
+	}
+	return n
+}
+
+func (r *ggufReader) str() string {
+	n := r.count(ggufMaxString, "string length")
+	if r.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	r.n += int64(n)
+	return string(b)
+}
+
+// value reads a metadata value of type typ. Arrays longer than
+// ggufKeepArray are skipped over and returned as a GGUFArray.
+func (r *ggufReader) value(typ uint32, depth int) any {
+	switch typ {
+	case ggufUint8:
+		return r.read(1)[0]
+	case ggufInt8:
+		return int8(r.read(1)[0])
+	case ggufUint16:
+		return binary.LittleEndian.Uint16(r.read(2))
+	case ggufInt16:
+		return int16(binary.LittleEndian.Uint16(r.read(2)))
+	case ggufUint32:
+		return r.u32()
+	case ggufInt32:
+		return int32(r.u32())
+	case ggufFloat32:
+		return math.Float32frombits(r.u32())
+	case ggufBool:
+		return r.read(1)[0] != 0
+	case ggufString:
+		return r.str()
+	case ggufUint64:
+		return r.u64()
+	case ggufInt64:
+		return int64(r.u64())
+	case ggufFloat64:
+		return math.Float64frombits(r.u64())
+	case ggufArray:
+		if depth > 0 {
+			r.err = errors.New("nested arrays are not supported")
+			return nil
+		}
+		elem := r.u32()
+		n := r.count(ggufMaxCount, "array length")
+		if r.err != nil {
+			return nil
+		}
+		if n > ggufKeepArray {
+			for i := uint64(0); i < n && r.err == nil; i++ {
+				r.value(elem, depth+1)
+			}
+			return GGUFArray{Type: ggufTypeName(elem), Len: n}
+		}
+		values := make([]any, 0, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			values = append(values, r.value(elem, depth+1))
+		}
+		return values
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("unknown metadata value type %d", typ)
+	}
+	return nil
+}
+
+func ggufTypeName(typ uint32) string {
+	if int(typ) < len(ggufTypeNames) {
+		return ggufTypeNames[typ]
+	}
+	return fmt.Sprintf("type %d", typ)
+}
+
+// ReadGGUFHeader reads the metadata and tensor index at the start of a GGUF
+// file (versions 2 and 3).
+func ReadGGUFHeader(r io.Reader) (*GGUFHeader, error) {
+	gr := &ggufReader{r: bufio.NewReaderSize(r, 64<<10)}
+	if magic := gr.read(4); gr.err != nil || string(magic) != ggufMagic {
+		if gr.err != nil {
+			return nil, fmt.Errorf("reading magic: %w", gr.err)
+		}
+		return nil, errors.New("not a GGUF file")
+	}
+	h := &GGUFHeader{Version: gr.u32(), Metadata: make(map[string]any)}
+	if gr.err == nil && h.Version != 2 && h.Version != 3 {
+		return nil, fmt.Errorf("unsupported GGUF version %d", h.Version)
+	}
+	numTensors := gr.count(ggufMaxCount, "tensor count")
+	numKV := gr.count(ggufMaxCount, "metadata count")
+	for i := uint64(0); i < numKV && gr.err == nil; i++ {
+		key := gr.str()
+		h.Metadata[key] = gr.value(gr.u32(), 0)
+	}
+	for i := uint64(0); i < numTensors && gr.err == nil; i++ {
+		t := GGUFTensor{Name: gr.str()}
+		dims := gr.u32()
+		if gr.err == nil && dims > ggufMaxDims {
+			gr.err = fmt.Errorf("tensor %s has %d dimensions", t.Name, dims)
+		}
+		for j := uint32(0); j < dims && gr.err == nil; j++ {
+			t.Shape = append(t.Shape, gr.u64())
+		}
+		typ := gr.u32()
+		t.Type = ggmlTypeNames[typ]
+		if t.Type == "" {
+			t.Type = fmt.Sprintf("type %d", typ)
+		}
+		t.Offset = gr.u64()
+		h.Tensors = append(h.Tensors, t)
+	}
+	if gr.err != nil {
+		if errors.Is(gr.err, io.EOF) {
+			gr.err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("invalid GGUF header at byte %d: %w", gr.n, gr.err)
+	}
+	h.HeaderSize = gr.n
+	return h, nil
+}
+
+// InspectGGUF reads the headers of the repository's GGUF files with Range
+// requests, without downloading the weights. A split model is read from its
+// first part, which holds the metadata. Files the include and exclude
+// patterns would not download are skipped.
+//
+// Headers that could be read are returned even when others fail; the
+// failures are joined in the error.
+func (d *Downloader) InspectGGUF(ctx context.Context, repoInfo *RepoInfo) ([]GGUFHeader, error) {
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	quantSize := make(map[string]int64)
+	for _, q := range GGUFQuants(repoInfo.Siblings) {
+		if q.Parts > 1 {
+			quantSize[q.Files[0].Path] = q.Size
+		}
+	}
+	var files []HFFile
+	for _, f := range d.flattenTree(repoInfo.Siblings) {
+		if info, ok := parseGGUFName(f.Path); ok && info.part <= 1 && d.shouldDownload(f.Path) {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	headers, failed := inspectEach(d, files, func(f HFFile) (*GGUFHeader, error) {
+		d.logger.Printf("Reading GGUF header of %s", f.Path)
+		rf, err := d.openRemote(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		h, err := ReadGGUFHeader(&remoteReader{ctx: ctx, f: rf, limit: ggufMaxHeader})
+		if err != nil {
+			return nil, err
+		}
+		info, _ := parseGGUFName(f.Path)
+		h.Path, h.Quant, h.Size = f.Path, info.quant, f.Size
+		if total, ok := quantSize[f.Path]; ok {
+			h.Size = total
+		}
+		return h, nil
+	})
+	return headers, errors.Join(failed...)
+}
@@ -2,6 +2,7 @@ module github.com/drgo/hfget
 
 go 1.24.4
 
-require golang.org/x/term v0.32.0
-
-require golang.org/x/sys v0.33.0 // indirect
+require (
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
+)
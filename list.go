@@ -0,0 +1,43 @@
+package hfget
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// TreeOptions controls what ListTree returns.
+type TreeOptions struct {
+	Recursive bool // Also list the contents of subdirectories
+	Expand    bool // Fill in HFFile.LastCommit; the API answers more slowly
+}
+
+// ListTree lists the files and directories under dir ("" for the repository
+// root) at the Downloader's revision without building a plan. Files that the
+// include and exclude patterns would not download are left out, so a filter
+// can be checked before it is used; directories are always listed.
+func (d *Downloader) ListTree(ctx context.Context, dir string, opts TreeOptions) ([]HFFile, error) {
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if opts.Recursive {
+		query.Set("recursive", "true")
+	}
+	if opts.Expand {
+		query.Set("expand", "true")
+	}
+	d.logger.Printf("Listing %s of %s, branch: %s", dir, d.repoName, d.branch)
+	entries, err := d.fetchTree(ctx, strings.Trim(dir, "/"), query)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := entries[:0]
+	for _, e := range entries {
+		if e.Type == "directory" || d.shouldDownload(e.Path) {
+			listed = append(listed, e)
+		}
+	}
+	return listed, nil
+}
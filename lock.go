@@ -0,0 +1,160 @@
+package hfget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is matched by errors.Is for a *LockError.
+var ErrLocked = errors.New("destination is locked by another hfget process")
+
+var (
+	errLockHeld        = errors.New("lock is held")
+	errLockUnsupported = errors.New("file locking is not supported on this platform")
+)
+
+const (
+	// metaDirName is the per-model directory hfget uses for its own
+	// bookkeeping. It is never part of a repository's file list.
+	metaDirName      = ".hfget"
+	lockFileName     = "lock"
+	lockPollInterval = 500 * time.Millisecond
+)
+
+// LockError reports that another process holds the lock on a model directory.
+type LockError struct {
+	Path string
+	PID  int
+	Host string
+}
+
+func (e *LockError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is locked by another hfget process", e.Path)
+	}
+	return fmt.Sprintf("%s is locked by hfget process %d on %s", e.Path, e.PID, e.Host)
+}
+
+// Is lets errors.Is(err, ErrLocked) match.
+func (e *LockError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// lockOwner identifies the process recorded in a lock file.
+type lockOwner struct {
+	pid  int
+	host string
+}
+
+func currentLockOwner() lockOwner {
+	host, _ := os.Hostname()
+	return lockOwner{pid: os.Getpid(), host: host}
+}
+
+// readLockOwner parses the "<pid> <host>" line written by the lock holder.
+func readLockOwner(f *os.File) lockOwner {
+	buf := make([]byte, 256)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return lockOwner{}
+	}
+	pidStr, host, _ := strings.Cut(strings.TrimSpace(string(buf[:n])), " ")
+	pid, _ := strconv.Atoi(pidStr)
+	return lockOwner{pid: pid, host: host}
+}
+
+// dirLock is an advisory lock on a model directory held for the duration of
+// ExecutePlan.
+type dirLock struct {
+	f    *os.File
+	path string
+}
+
+// acquireLock takes the lock for modelPath. Depending on the Downloader's
+// options it fails immediately, waits indefinitely or waits up to a timeout
+// when another process holds the lock.
+func (d *Downloader) acquireLock(ctx context.Context, modelPath string) (*dirLock, error) {
+	dir := filepath.Join(modelPath, metaDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, lockFileName)
+
+	var deadline time.Time
+	if d.lockWait && d.lockTimeout > 0 {
+		deadline = time.Now().Add(d.lockTimeout)
+	}
+	waiting := false
+	for {
+		l, err := d.tryAcquireLock(path, modelPath)
+		if err == nil {
+			return l, nil
+		}
+		var lockErr *LockError
+		if !errors.As(err, &lockErr) || !d.lockWait {
+			return nil, err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %v waiting for lock: %w", d.lockTimeout, err)
+		}
+		if !waiting {
+			d.logger.Printf("Waiting for lock: %v", err)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (d *Downloader) tryAcquireLock(path, modelPath string) (*dirLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+	self := currentLockOwner()
+	prev := readLockOwner(f)
+	sameHost := prev.host == self.host
+
+	switch err := lockFile(f); {
+	case err == nil:
+	case errors.Is(err, errLockHeld):
+		f.Close()
+		return nil, &LockError{Path: modelPath, PID: prev.pid, Host: prev.host}
+	case errors.Is(err, errLockUnsupported):
+		// Without OS locks the recorded PID is all we have to go on.
+		if prev.pid != 0 && prev.pid != self.pid && (!sameHost || processExists(prev.pid)) {
+			f.Close()
+			return nil, &LockError{Path: modelPath, PID: prev.pid, Host: prev.host}
+		}
+	default:
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	if prev.pid != 0 && prev.pid != self.pid && sameHost && !processExists(prev.pid) {
+		d.logger.Printf("Reclaiming stale lock on %s left by dead process %d", modelPath, prev.pid)
+	}
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(fmt.Sprintf("%d %s\n", self.pid, self.host)), 0)
+	}
+	d.logger.Printf("Acquired lock on %s", modelPath)
+	return &dirLock{f: f, path: path}, nil
+}
+
+// release clears the owner record and drops the lock. The lock file itself
+// is left in place so that concurrent lockers always contend on one inode.
+func (l *dirLock) release() {
+	_ = l.f.Truncate(0)
+	_ = unlockFile(l.f)
+	_ = l.f.Close()
+}
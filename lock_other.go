@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd || dragonfly || netbsd || openbsd || windows)
+
+package hfget
+
+import "os"
+
+const canRemoveOpenFiles = true
+
+func lockFile(f *os.File) error {
+	return errLockUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	return err == nil && p != nil
+}
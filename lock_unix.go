@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || dragonfly || netbsd || openbsd
+
+package hfget
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// canRemoveOpenFiles reports whether a directory can be deleted while the
+// lock file inside it is still open, so RemoveCached can keep the lock until
+// the directory is gone.
+const canRemoveOpenFiles = true
+
+func lockFile(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return errLockHeld
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
+
+func processExists(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
@@ -93,7 +93,11 @@ func WithExcludePatterns(patterns []string) Option {
 		d.excludePatterns = patterns
 	}
 }
-// WithProgressChannel sets a channel to receive progress updates.
+// WithProgressChannel sets a channel to receive progress updates. Byte
+// counts are dropped when the channel is full. The complete, verified and
+// failed states wait for room until the context passed to BuildPlan,
+// ExecutePlan or Verify is cancelled, so a caller that stops reading should
+// cancel it.
 func WithProgressChannel(p chan<- Progress) Option {
 	return func(d *Downloader) {
 		d.Progress = p
@@ -107,6 +111,26 @@ func SkipSHACheck() Option {
 	}
 }
 
+// WithoutDiskSpaceCheck lets ExecutePlan start even when the destination
+// does not appear to have enough free space.
+func WithoutDiskSpaceCheck() Option {
+	return func(d *Downloader) {
+		d.skipDiskCheck = true
+	}
+}
+
+// WithLockWait makes ExecutePlan wait for another process's lock on the
+// destination instead of failing immediately. A timeout of zero waits
+// indefinitely.
+func WithLockWait(timeout time.Duration) Option {
+	return func(d *Downloader) {
+		d.lockWait = true
+		if timeout > 0 {
+			d.lockTimeout = timeout
+		}
+	}
+}
+
 // WithForceRedownload bypasses local file checks and downloads all files.
 func WithForceRedownload() Option {
 	return func(d *Downloader) {
@@ -114,6 +138,93 @@ func WithForceRedownload() Option {
 	}
 }
 
+// WithPrune makes BuildPlan list local files that are no longer in the
+// repository (within the include/exclude filters) so that ExecutePlan can
+// delete them after a successful download.
+func WithPrune() Option {
+	return func(d *Downloader) {
+		d.prune = true
+	}
+}
+
+// WithConflictPolicy sets how the plan treats local files that were modified
+// since the last sync. The default is ConflictOverwrite.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(d *Downloader) {
+		d.conflictPolicy = policy
+	}
+}
+
+// WithMinFileSize leaves out files smaller than n bytes.
+func WithMinFileSize(n int64) Option {
+	return func(d *Downloader) {
+		d.minFileSize = n
+	}
+}
+
+// WithMaxFileSize leaves out files larger than n bytes.
+func WithMaxFileSize(n int64) Option {
+	return func(d *Downloader) {
+		d.maxFileSize = n
+	}
+}
+
+// WithDownloadBudget limits the total size of the files a plan downloads to
+// n bytes. When the planned files do not fit, priority decides which are
+// kept; the rest are reported in DownloadPlan.FilesFiltered with
+// ReasonOverBudget.
+func WithDownloadBudget(n int64, priority BudgetPriority) Option {
+	return func(d *Downloader) {
+		d.budget = n
+		d.budgetPriority = priority
+	}
+}
+
+// WithQuant restricts the download to one quantization of a GGUF repository,
+// e.g. "Q4_K_M": every part of a split file, plus the repository's small
+// non-GGUF files such as README and config. BuildPlan returns a
+// *QuantNotFoundError if the repository does not offer it.
+func WithQuant(name string) Option {
+	return func(d *Downloader) {
+		d.quant = name
+	}
+}
+
+// WithMMProj adds a multimodal projector (mmproj) file to a WithQuant
+// selection.
+func WithMMProj() Option {
+	return func(d *Downloader) {
+		d.withMMProj = true
+	}
+}
+
+// WithFormatPreference keeps a single weight format where a repository ships
+// the same weights in several (e.g. safetensors, pytorch_model.bin and
+// tf_model.h5). The most preferred format present for each set of weights
+// in a directory is kept, so adapter_model.bin is only a duplicate of
+// adapter_model.safetensors, not of model.safetensors. Formats not listed
+// follow in the default order safetensors, pytorch, onnx, tensorflow, flax,
+// so calling it without arguments prefers safetensors. The other formats
+// are reported in DownloadPlan.FilesFiltered with ReasonDuplicateFormat.
+// Without this option every format is downloaded.
+func WithFormatPreference(order ...WeightFormat) Option {
+	return func(d *Downloader) {
+		d.preferFormats = true
+		d.formatPreference = order
+	}
+}
+
+// WithPickleScan makes ExecutePlan scan pickle-based files (.bin, .pt,
+// .pkl, .ckpt...) after they are downloaded or found valid locally, listing
+// the globals they import in DownloadPlan.PickleScans. Under
+// PickleScanRefuse, files importing anything outside the allowlist are moved
+// into the model's .hfget/quarantine directory.
+func WithPickleScan(policy PickleScanPolicy) Option {
+	return func(d *Downloader) {
+		d.pickleScan = policy
+	}
+}
+
 // WithTreeStructure enables saving to a nested directory structure (e.g., org/model).
 func WithTreeStructure() Option {
 	return func(d *Downloader) {
@@ -129,6 +240,32 @@ func WithVerboseOutput(w io.Writer) Option {
 	}
 }
 
+// WithRateLimit caps the combined download throughput of every file and
+// chunk handled by the Downloader, in bytes per second.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(d *Downloader) {
+		if bytesPerSec > 0 {
+			d.rateLimit = bytesPerSec
+		}
+	}
+}
+
+// WithConnectionRateLimit caps the throughput of each individual connection, in bytes per second.
+func WithConnectionRateLimit(bytesPerSec int64) Option {
+	return func(d *Downloader) {
+		if bytesPerSec > 0 {
+			d.connRateLimit = bytesPerSec
+		}
+	}
+}
+
+// WithRateSchedule sets time-of-day windows that override the global rate limit.
+func WithRateSchedule(windows ...RateWindow) Option {
+	return func(d *Downloader) {
+		d.rateSchedule = windows
+	}
+}
+
 // WithTimeout sets the timeout for all HTTP requests.
 func WithTimeout(timeout time.Duration) Option {
 	return func(d *Downloader) {
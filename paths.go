@@ -0,0 +1,102 @@
+package hfget
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileReject represents a repository file that will not be written because
+// its path would land outside the destination directory.
+type FileReject struct {
+	File   HFFile `json:"file"`
+	Detail string `json:"detail"`
+}
+
+// confinedPath returns the local path for the repository file rel under
+// modelPath. It returns an error if the path would end up outside modelPath,
+// either lexically (e.g. "../x") or through a symlinked directory that
+// already exists inside the destination. A symlink at the file's own path is
+// allowed: writers replace it rather than write through it, and deleting it
+// removes only the link.
+func confinedPath(modelPath, rel string) (string, error) {
+	root, err := filepath.Abs(modelPath)
+	if err != nil {
+		return "", fmt.Errorf("could not determine absolute path for destination: %w", err)
+	}
+	fullPath := filepath.Join(root, rel)
+	if !isWithin(root, fullPath) {
+		return "", errors.New("path escapes the destination directory")
+	}
+
+	realRoot, err := resolveExisting(root)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve destination: %w", err)
+	}
+	realParent, err := resolveExisting(filepath.Dir(fullPath))
+	if err != nil {
+		return "", err
+	}
+	if realPath := filepath.Join(realParent, filepath.Base(fullPath)); !isWithin(realRoot, realPath) {
+		return "", fmt.Errorf("path resolves through a symlink to %s, outside the destination directory", realPath)
+	}
+	return fullPath, nil
+}
+
+// removeSymlink deletes path if it is a symlink, so that the file written
+// in its place does not land wherever the link points.
+func removeSymlink(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// confinedDeletePath is confinedPath for a file to be deleted. Absolute
+// paths are rejected too, since a plan read from disk may have been edited.
+func confinedDeletePath(modelPath, rel string) (string, error) {
+	if filepath.IsAbs(rel) || strings.HasPrefix(filepath.ToSlash(rel), "/") {
+		return "", errors.New("absolute path in a repository-relative location")
+	}
+	return confinedPath(modelPath, filepath.FromSlash(rel))
+}
+
+// isWithin reports whether path is strictly inside root. Both must be clean
+// absolute paths.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || filepath.IsAbs(rel) {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveExisting evaluates symlinks in the longest existing prefix of path
+// and appends the components that do not exist yet.
+func resolveExisting(path string) (string, error) {
+	existing, rest := path, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// A dangling symlink would be followed when the file is created,
+		// so its target cannot be checked.
+		if _, lerr := os.Lstat(existing); lerr == nil {
+			return "", fmt.Errorf("%s is a dangling symlink", existing)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
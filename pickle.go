@@ -0,0 +1,592 @@
+package hfget
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsafePickle is matched by errors.Is for a *UnsafePickleError.
+var ErrUnsafePickle = errors.New("pickle file imports unsafe globals")
+
+// UnsafePickleError reports a pickle file refused under PickleScanRefuse.
+type UnsafePickleError struct {
+	Path        string
+	Globals     []PickleGlobal // The globals that are not on the allowlist
+	Quarantined string         // Where the file was moved, if it was
+}
+
+func (e *UnsafePickleError) Error() string {
+	names := make([]string, len(e.Globals))
+	for i, g := range e.Globals {
+		names[i] = g.String()
+	}
+	msg := fmt.Sprintf("%s imports unsafe globals: %s", e.Path, strings.Join(names, ", "))
+	if e.Quarantined != "" {
+		msg += fmt.Sprintf(" (moved to %s)", e.Quarantined)
+	}
+	return msg
+}
+
+// Is lets errors.Is(err, ErrUnsafePickle) match.
+func (e *UnsafePickleError) Is(target error) bool {
+	return target == ErrUnsafePickle
+}
+
+// PickleScanPolicy decides whether ExecutePlan scans pickle-based weight
+// files and what happens to unsafe ones.
+type PickleScanPolicy int
+
+const (
+	// PickleScanOff does not scan.
+	PickleScanOff PickleScanPolicy = iota
+	// PickleScanWarn scans and records the results in DownloadPlan.PickleScans.
+	PickleScanWarn
+	// PickleScanRefuse also moves unsafe files into the quarantine directory
+	// and makes ExecutePlan return an *UnsafePickleError for each.
+	PickleScanRefuse
+)
+
+var pickleScanPolicyNames = map[PickleScanPolicy]string{
+	PickleScanOff:    "off",
+	PickleScanWarn:   "warn",
+	PickleScanRefuse: "refuse",
+}
+
+func (p PickleScanPolicy) String() string {
+	if name, ok := pickleScanPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("PickleScanPolicy(%d)", int(p))
+}
+
+// ParsePickleScanPolicy converts "off", "warn" or "refuse" into a PickleScanPolicy.
+func ParsePickleScanPolicy(s string) (PickleScanPolicy, error) {
+	for p, name := range pickleScanPolicyNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pickle scan policy %q: want off, warn or refuse", s)
+}
+
+// PickleSafety grades a global imported by a pickle.
+type PickleSafety int
+
+const (
+	// PickleSafe is a global on the allowlist of torch/numpy rebuild helpers.
+	PickleSafe PickleSafety = iota
+	// PickleUnknown is a global that is not on the allowlist.
+	PickleUnknown
+	// PickleDangerous is a global known to run commands or code, such as
+	// os.system or builtins.eval.
+	PickleDangerous
+)
+
+var pickleSafetyNames = map[PickleSafety]string{
+	PickleSafe:      "safe",
+	PickleUnknown:   "unknown",
+	PickleDangerous: "dangerous",
+}
+
+func (s PickleSafety) String() string {
+	if name, ok := pickleSafetyNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("PickleSafety(%d)", int(s))
+}
+
+// MarshalText encodes the safety grade by name.
+func (s PickleSafety) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// PickleGlobal is a module attribute a pickle imports when loaded.
+type PickleGlobal struct {
+	Module string       `json:"module"`
+	Name   string       `json:"name"`
+	Safety PickleSafety `json:"safety"`
+}
+
+func (g PickleGlobal) String() string {
+	return g.Module + "." + g.Name
+}
+
+// PickleReport is the result of scanning one file.
+type PickleReport struct {
+	Path    string         `json:"path"`    // Repository path of the file
+	Globals []PickleGlobal `json:"globals"` // Every distinct global imported
+	Safety  PickleSafety   `json:"safety"`  // The worst grade among Globals
+	Error   string         `json:"error,omitempty"`
+}
+
+// Unsafe reports whether the file imports anything that is not allowlisted,
+// or could not be parsed.
+func (r *PickleReport) Unsafe() bool {
+	return r.Safety != PickleSafe || r.Error != ""
+}
+
+// unsafeGlobals returns the globals that are not allowlisted.
+func (r *PickleReport) unsafeGlobals() []PickleGlobal {
+	var out []PickleGlobal
+	for _, g := range r.Globals {
+		if g.Safety != PickleSafe {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// safePickleGlobals are the callables needed to rebuild torch and numpy
+// tensors, mirroring what torch.load(weights_only=True) permits.
+var safePickleGlobals = map[string]map[string]bool{
+	"collections": {"OrderedDict": true},
+	"torch._utils": {
+		"_rebuild_tensor": true, "_rebuild_tensor_v2": true, "_rebuild_tensor_v3": true,
+		"_rebuild_parameter": true, "_rebuild_parameter_with_state": true,
+		"_rebuild_device_tensor_from_numpy": true, "_rebuild_qtensor": true,
+		"_rebuild_sparse_tensor": true, "_rebuild_meta_tensor_no_storage": true,
+		"_rebuild_nested_tensor": true, "_rebuild_wrapper_subclass": true,
+	},
+	"torch": {
+		"Size": true, "device": true, "float16": true, "float32": true, "float64": true,
+		"bfloat16": true, "int8": true, "int16": true, "int32": true, "int64": true,
+		"uint8": true, "bool": true, "complex64": true, "complex128": true,
+		"float8_e4m3fn": true, "float8_e5m2": true,
+	},
+	"torch.storage":              {"UntypedStorage": true, "TypedStorage": true},
+	"numpy":                      {"ndarray": true, "dtype": true},
+	"numpy.core.multiarray":      {"_reconstruct": true, "scalar": true},
+	"numpy._core.multiarray":     {"_reconstruct": true, "scalar": true},
+	"numpy.dtypes":               {"Float16DType": true, "Float32DType": true, "Float64DType": true, "Int64DType": true, "Int32DType": true, "UInt8DType": true},
+	"_codecs":                    {"encode": true},
+	"builtins":                   {"set": true, "frozenset": true, "slice": true, "complex": true, "bytearray": true},
+	"__builtin__":                {"set": true, "frozenset": true, "slice": true, "complex": true, "bytearray": true},
+	"torch.nn.parameter":         {"Parameter": true},
+	"torch._tensor":              {"_rebuild_from_type_v2": true},
+	"torch.serialization":        {"_get_layout": true},
+	"torch.nn.modules.container": {"ParameterDict": true},
+}
+
+// dangerousPickleModules are modules whose attributes can run commands or
+// code. A global from one of them, or from a submodule, is PickleDangerous.
+var dangerousPickleModules = []string{
+	"os", "posix", "nt", "subprocess", "sys", "socket", "shutil", "runpy", "pty",
+	"webbrowser", "importlib", "ctypes", "marshal", "pickle", "_pickle", "code",
+	"commands", "multiprocessing", "asyncio", "requests", "urllib", "httplib",
+	"http", "ftplib", "telnetlib", "pip", "torch.hub", "bdb", "pdb", "timeit",
+}
+
+// dangerousBuiltins are builtins that evaluate code or reach arbitrary objects.
+var dangerousBuiltins = map[string]bool{
+	"eval": true, "exec": true, "execfile": true, "compile": true, "open": true,
+	"getattr": true, "setattr": true, "delattr": true, "__import__": true,
+	"apply": true, "input": true, "breakpoint": true, "globals": true, "locals": true,
+	"vars": true, "memoryview": true,
+}
+
+// classifyPickleGlobal grades module.name.
+func classifyPickleGlobal(module, name string) PickleSafety {
+	if names, ok := safePickleGlobals[module]; ok && names[name] {
+		return PickleSafe
+	}
+	if module == "torch" && strings.HasSuffix(name, "Storage") {
+		return PickleSafe // FloatStorage, HalfStorage, BFloat16Storage...
+	}
+	if (module == "builtins" || module == "__builtin__") && dangerousBuiltins[name] {
+		return PickleDangerous
+	}
+	for _, m := range dangerousPickleModules {
+		if module == m || strings.HasPrefix(module, m+".") {
+			return PickleDangerous
+		}
+	}
+	return PickleUnknown
+}
+
+// pickleExtensions are the file types that may contain pickles.
+var pickleExtensions = map[string]bool{
+	".bin": true, ".pt": true, ".pth": true, ".pkl": true, ".pickle": true, ".ckpt": true, ".joblib": true,
+}
+
+// isPickleCandidate reports whether path has an extension that may hold a
+// pickle. Whether it actually does is decided by ScanPickleFile.
+func isPickleCandidate(path string) bool {
+	return pickleExtensions[strings.ToLower(pathpkg.Ext(path))]
+}
+
+// quarantineDirName is where PickleScanRefuse moves unsafe files, inside
+// the model's metadata directory.
+const quarantineDirName = "quarantine"
+
+// scanForPickles scans the local copy of file if it may hold a pickle and
+// adds the report to plan. Under PickleScanRefuse an unsafe file is moved
+// into quarantine and an *UnsafePickleError is returned.
+func (d *Downloader) scanForPickles(modelPath string, file HFFile, plan *DownloadPlan) error {
+	if d.pickleScan == PickleScanOff || !isPickleCandidate(file.Path) {
+		return nil
+	}
+	fullPath := filepath.Join(modelPath, file.Path)
+	report, err := ScanPickleFile(fullPath)
+	if err != nil {
+		report = &PickleReport{Error: err.Error()}
+	}
+	if report == nil {
+		return nil // Not a pickle.
+	}
+	report.Path = file.Path
+	plan.PickleScans = append(plan.PickleScans, *report)
+	if !report.Unsafe() {
+		d.logger.Printf("Pickle scan of %s found only allowlisted globals", file.Path)
+		return nil
+	}
+	d.logger.Printf("Pickle scan of %s: %s (%d globals, error %q)", file.Path, report.Safety, len(report.Globals), report.Error)
+	if d.pickleScan != PickleScanRefuse {
+		return nil
+	}
+
+	unsafe := &UnsafePickleError{Path: file.Path, Globals: report.unsafeGlobals()}
+	if report.Error != "" && len(unsafe.Globals) == 0 {
+		unsafe.Globals = []PickleGlobal{{Module: "?", Name: "unparseable: " + report.Error, Safety: PickleUnknown}}
+	}
+	dest := filepath.Join(modelPath, metaDirName, quarantineDirName, file.Path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err == nil {
+		if err := os.Rename(fullPath, dest); err == nil {
+			unsafe.Quarantined = dest
+		}
+	}
+	if unsafe.Quarantined == "" {
+		// Never leave a refused file where it would be loaded.
+		_ = os.Remove(fullPath)
+	}
+	return unsafe
+}
+
+// maxLegacyPickles bounds how many consecutive pickles are read from a
+// non-zip file; torch's legacy format writes five before the raw tensor data.
+const maxLegacyPickles = 5
+
+// ScanPickleFile lists the globals imported by the pickles in the file at
+// path: each *.pkl entry of a torch zip archive, or the leading pickle
+// stream(s) of any other file. It returns a nil report for files that are
+// not pickles, such as GGML .bin files.
+func ScanPickleFile(path string) (*PickleReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var magic [4]byte
+	n, _ := io.ReadFull(f, magic[:])
+	found := make(map[PickleGlobal]bool)
+	switch {
+	case n == 4 && bytes.Equal(magic[:], []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		for _, entry := range zr.File {
+			if !strings.HasSuffix(entry.Name, ".pkl") {
+				continue
+			}
+			rc, err := entry.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open %s: %w", entry.Name, err)
+			}
+			err = scanPickleStream(bufio.NewReader(rc), found)
+			rc.Close()
+			if err != nil {
+				return reportFrom(found, fmt.Errorf("%s: %w", entry.Name, err)), nil
+			}
+		}
+	case n >= 1 && (magic[0] == 0x80 || strings.HasSuffix(strings.ToLower(path), ".pkl") || strings.HasSuffix(strings.ToLower(path), ".pickle")):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r := bufio.NewReader(f)
+		for i := 0; i < maxLegacyPickles; i++ {
+			if err := scanPickleStream(r, found); err != nil {
+				if i == 0 {
+					return reportFrom(found, err), nil
+				}
+				break // Past the pickles, into raw data.
+			}
+			if next, err := r.Peek(1); err != nil || next[0] != 0x80 {
+				break
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return reportFrom(found, nil), nil
+}
+
+func reportFrom(found map[PickleGlobal]bool, err error) *PickleReport {
+	report := &PickleReport{}
+	for g := range found {
+		report.Globals = append(report.Globals, g)
+		if g.Safety > report.Safety {
+			report.Safety = g.Safety
+		}
+	}
+	sort.Slice(report.Globals, func(i, j int) bool {
+		return report.Globals[i].String() < report.Globals[j].String()
+	})
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// Pickle opcodes that carry arguments or name globals. Opcodes not listed
+// here take no argument.
+const (
+	opGlobal         = 'c'
+	opInst           = 'i'
+	opStackGlobal    = 0x93
+	opStop           = '.'
+	opProto          = 0x80
+	opFrame          = 0x95
+	opShortBinUni    = 0x8c
+	opBinUnicode     = 'X'
+	opBinUnicode8    = 0x8d
+	opUnicode        = 'V'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opMemoize        = 0x94
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opLongBinGet     = 'j'
+	opExt1           = 0x82
+	opExt2           = 0x83
+	opExt4           = 0x84
+)
+
+// pickleArgs gives the argument layout of the remaining opcodes: a fixed
+// byte count, or -1 for a newline-terminated line, -4/-8 for a 4- or 8-byte
+// little-endian length prefix and -2 for a 1-byte length prefix.
+var pickleArgs = map[byte]int{
+	'(': 0, '0': 0, '1': 0, '2': 0, 'N': 0, 'Q': 0, 'R': 0, 'a': 0, 'b': 0,
+	'd': 0, '}': 0, 'e': 0, 'l': 0, ']': 0, 'o': 0, 's': 0, 't': 0, ')': 0,
+	'u': 0, 0x81: 0, 0x85: 0, 0x86: 0, 0x87: 0, 0x88: 0, 0x89: 0, 0x8f: 0,
+	0x90: 0, 0x91: 0, 0x92: 0, 0x97: 0, 0x98: 0,
+	'F': -1, 'I': -1, 'L': -1, 'P': -1,
+	'J': 4, 'K': 1, 'M': 2, 'G': 8, 0x80: 1, 0x95: 8,
+	0x8a: -2, 0x8b: -4, 'B': -4, 'C': -2, 0x8e: -8, 0x96: -8,
+}
+
+// scanPickleStream walks one pickle up to its STOP opcode and adds every
+// global it imports to found. It does not execute anything. STACK_GLOBAL
+// takes its module and name from the stack; they are only trusted when the
+// two opcodes before it that touched the stack pushed strings, as Python's
+// pickler writes them. Anything else, such as strings pushed earlier and
+// uncovered by POP, is reported as an unresolved global.
+func scanPickleStream(r *bufio.Reader, found map[PickleGlobal]bool) error {
+	var (
+		run       []string // Strings pushed since any other stack change.
+		top       string   // The value the last opcode pushed...
+		topIsStr  bool     // ...if it was a string.
+		memoCount int
+	)
+	memo := make(map[string]string) // Memoized strings only.
+	add := func(module, name string) {
+		found[PickleGlobal{Module: module, Name: name, Safety: classifyPickleGlobal(module, name)}] = true
+	}
+	push := func(s string) {
+		run = append(run, s)
+		top, topIsStr = s, true
+	}
+	other := func() {
+		run = run[:0]
+		topIsStr = false
+	}
+	remember := func(key string) {
+		if topIsStr {
+			memo[key] = top
+		} else {
+			delete(memo, key)
+		}
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("truncated pickle: %w", err)
+		}
+		switch op {
+		case opStop:
+			return nil
+		case opGlobal, opInst:
+			module, err := readPickleLine(r)
+			if err != nil {
+				return err
+			}
+			name, err := readPickleLine(r)
+			if err != nil {
+				return err
+			}
+			add(module, name)
+			other()
+		case opStackGlobal:
+			if len(run) < 2 {
+				add("?", "?") // The operands cannot be traced: do not trust them.
+			} else {
+				add(run[len(run)-2], run[len(run)-1])
+			}
+			other()
+		case opShortBinUni, opShortBinString:
+			s, err := readPickleBytes(r, 1)
+			if err != nil {
+				return err
+			}
+			push(s)
+		case opBinUnicode, opBinString:
+			s, err := readPickleBytes(r, 4)
+			if err != nil {
+				return err
+			}
+			push(s)
+		case opBinUnicode8:
+			s, err := readPickleBytes(r, 8)
+			if err != nil {
+				return err
+			}
+			push(s)
+		case opUnicode, opString:
+			s, err := readPickleLine(r)
+			if err != nil {
+				return err
+			}
+			if op == opString {
+				if unq, err := strconv.Unquote(s); err == nil {
+					s = unq
+				} else {
+					s = strings.Trim(s, `'"`)
+				}
+			}
+			push(s)
+		case opMemoize:
+			remember(strconv.Itoa(memoCount))
+			memoCount++
+		case opPut, opBinPut, opLongBinPut, opGet, opBinGet, opLongBinGet:
+			var key string
+			switch op {
+			case opPut, opGet:
+				key, err = readPickleLine(r)
+			case opBinPut, opBinGet:
+				key, err = readPickleIndex(r, 1)
+			default:
+				key, err = readPickleIndex(r, 4)
+			}
+			if err != nil {
+				return err
+			}
+			if op == opPut || op == opBinPut || op == opLongBinPut {
+				remember(key)
+			} else if v, ok := memo[key]; ok {
+				push(v)
+			} else {
+				other()
+			}
+		case opExt1, opExt2, opExt4:
+			size := map[byte]int{opExt1: 1, opExt2: 2, opExt4: 4}[op]
+			if _, err := r.Discard(size); err != nil {
+				return err
+			}
+			add("copyreg", "extension registry") // Resolved at load time.
+			other()
+		default:
+			n, ok := pickleArgs[op]
+			if !ok {
+				return fmt.Errorf("unknown pickle opcode 0x%02x", op)
+			}
+			if err := skipPickleArg(r, n); err != nil {
+				return err
+			}
+			if op != opProto && op != opFrame { // Framing leaves the stack alone.
+				other()
+			}
+		}
+	}
+}
+
+func readPickleLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("truncated pickle: %w", err)
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// readPickleLength reads a little-endian length of size bytes.
+func readPickleLength(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return 0, fmt.Errorf("truncated pickle: %w", err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func readPickleIndex(r *bufio.Reader, size int) (string, error) {
+	n, err := readPickleLength(r, size)
+	return strconv.FormatUint(n, 10), err
+}
+
+// maxPickleString bounds strings kept for STACK_GLOBAL resolution; longer
+// ones are skipped rather than buffered.
+const maxPickleString = 1 << 16
+
+func readPickleBytes(r *bufio.Reader, lengthSize int) (string, error) {
+	n, err := readPickleLength(r, lengthSize)
+	if err != nil {
+		return "", err
+	}
+	if n > maxPickleString {
+		_, err := io.CopyN(io.Discard, r, int64(n))
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", fmt.Errorf("truncated pickle: %w", err)
+	}
+	return string(buf), nil
+}
+
+func skipPickleArg(r *bufio.Reader, layout int) error {
+	var err error
+	switch layout {
+	case 0:
+	case -1:
+		_, err = readPickleLine(r)
+	case -2, -4, -8:
+		var n uint64
+		if n, err = readPickleLength(r, map[int]int{-2: 1, -4: 4, -8: 8}[layout]); err == nil {
+			_, err = io.CopyN(io.Discard, r, int64(n))
+		}
+	default:
+		_, err = r.Discard(layout)
+	}
+	if err != nil && !strings.HasPrefix(err.Error(), "truncated") {
+		err = fmt.Errorf("truncated pickle: %w", err)
+	}
+	return err
+}
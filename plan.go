@@ -0,0 +1,104 @@
+package hfget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// planVersion is the format version written into serialized plans.
+const planVersion = 1
+
+// ErrPlanStale is matched by errors.Is for a *PlanMismatchError.
+var ErrPlanStale = errors.New("plan no longer matches the remote repository")
+
+// PlanMismatchError lists the files whose remote content changed since a
+// plan was built.
+type PlanMismatchError struct {
+	Paths []string
+}
+
+func (e *PlanMismatchError) Error() string {
+	return fmt.Sprintf("%d file(s) changed on the remote since the plan was built: %s", len(e.Paths), strings.Join(e.Paths, ", "))
+}
+
+// Is lets errors.Is(err, ErrPlanStale) match.
+func (e *PlanMismatchError) Is(target error) bool {
+	return target == ErrPlanStale
+}
+
+// WriteJSON writes the plan as indented JSON.
+func (p *DownloadPlan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// ReadPlan reads a plan written by WriteJSON.
+func ReadPlan(r io.Reader) (*DownloadPlan, error) {
+	var plan DownloadPlan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d (want %d)", plan.Version, planVersion)
+	}
+	if plan.Repo == nil || plan.RepoName == "" || plan.ModelPath == "" {
+		return nil, errors.New("plan is missing its repository or destination")
+	}
+	for _, f := range plan.FilesToDownload {
+		if f.Reason == ReasonUnknown {
+			return nil, fmt.Errorf("plan downloads %q without a reason", f.File.Path)
+		}
+	}
+	for _, f := range append(append([]FileSkip{}, plan.FilesToSkip...), plan.FilesFiltered...) {
+		if f.Reason == ReasonUnknown {
+			return nil, fmt.Errorf("plan skips %q without a reason", f.File.Path)
+		}
+	}
+	for _, f := range plan.FilesToDelete {
+		if _, err := confinedDeletePath(plan.ModelPath, f.Path); err != nil {
+			return nil, fmt.Errorf("plan deletes %q: %w", f.Path, err)
+		}
+	}
+	return &plan, nil
+}
+
+// CheckPlan fetches the current remote file list and returns a
+// *PlanMismatchError if any file the plan downloads or skips has a different
+// oid than when the plan was built, or a file it deletes as stale is back in
+// the repository.
+func (d *Downloader) CheckPlan(ctx context.Context, plan *DownloadPlan) error {
+	info, err := d.FetchRepoInfo(ctx)
+	if err != nil {
+		return err
+	}
+	remote := make(map[string]string)
+	for _, f := range d.flattenTree(info.Siblings) {
+		remote[f.Path] = remoteOid(f)
+	}
+	var changed []string
+	check := func(f HFFile) {
+		if oid, ok := remote[f.Path]; !ok || oid != remoteOid(f) {
+			changed = append(changed, f.Path)
+		}
+	}
+	for _, f := range plan.FilesToDownload {
+		check(f.File)
+	}
+	for _, f := range plan.FilesToSkip {
+		check(f.File)
+	}
+	for _, f := range plan.FilesToDelete {
+		if _, ok := remote[f.Path]; ok {
+			changed = append(changed, f.Path)
+		}
+	}
+	if len(changed) > 0 {
+		return &PlanMismatchError{Paths: changed}
+	}
+	return nil
+}
@@ -14,6 +14,9 @@ const (
 	ProgressStateVerified
 	// ProgressStateSkipped indicates that the file download was skipped.
 	ProgressStateSkipped
+	// ProgressStateFailed indicates that the file could not be downloaded or
+	// verified; Message holds the error.
+	ProgressStateFailed
 )
 
 // Progress holds the state of a file operation, designed to be sent over a channel.
@@ -23,4 +26,9 @@ type Progress struct {
 	CurrentSize int64
 	State       ProgressState
 	Message     string
+	// Chunks is the number of parallel ranges the file is downloaded in
+	// (1 for a single stream) and ChunksDone how many have finished. Both
+	// are only set while Downloading.
+	Chunks     int
+	ChunksDone int
 }
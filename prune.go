@@ -0,0 +1,114 @@
+package hfget
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+)
+
+// stagingDirName is the per-model directory holding chunk files while a
+// multi-threaded download is in progress.
+const stagingDirName = ".tmp"
+
+// FileDelete represents a local file that is no longer part of the repository
+// and will be removed when the plan is executed in prune mode.
+type FileDelete struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// findStaleFiles adds to plan.FilesToDelete every local file under modelPath
+// that is not in remote but would be selected by the include/exclude filters.
+// Files outside the filters' scope are left alone, as is hfget's own
+// bookkeeping and anything under a remote directory whose contents were not
+// listed.
+func (d *Downloader) findStaleFiles(ctx context.Context, modelPath string, remote []HFFile, plan *DownloadPlan) error {
+	known := make(map[string]bool, len(remote))
+	listed := make(map[string]bool)
+	for _, f := range remote {
+		if f.Type == "directory" {
+			continue
+		}
+		known[f.Path] = true
+		for dir := pathpkg.Dir(f.Path); dir != "."; dir = pathpkg.Dir(dir) {
+			listed[dir] = true
+		}
+	}
+	opaque := make(map[string]bool)
+	for _, f := range remote {
+		if f.Type == "directory" && !listed[f.Path] {
+			opaque[f.Path] = true
+		}
+	}
+	err := filepath.WalkDir(modelPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == modelPath {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(modelPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if rel == metaDirName || rel == stagingDirName || opaque[rel] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Backups of locally modified files are user data, never stale.
+		if known[rel] || isBackupName(pathpkg.Base(rel)) || !d.shouldDownload(rel) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		d.logger.Printf("Local file '%s' is no longer in the repository, planning deletion.", rel)
+		plan.FilesToDelete = append(plan.FilesToDelete, FileDelete{Path: rel, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s for stale files: %w", modelPath, err)
+	}
+	return nil
+}
+
+// deleteStaleFiles removes the plan's stale files and any directories left
+// empty by their removal. It returns one error per failure. Paths are checked
+// again because the plan may have been read from disk, and a path that
+// escapes modelPath is refused.
+func (d *Downloader) deleteStaleFiles(modelPath string, files []FileDelete) []error {
+	var errs []error
+	root, err := filepath.Abs(modelPath)
+	if err != nil {
+		return []error{fmt.Errorf("could not determine absolute path for destination: %w", err)}
+	}
+	for _, f := range files {
+		fullPath, err := confinedDeletePath(root, f.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("refusing to delete %s: %w", f.Path, err))
+			continue
+		}
+		d.logger.Printf("Pruning stale file: %s", f.Path)
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", f.Path, err))
+			continue
+		}
+		// Remove now-empty parents; os.Remove refuses non-empty directories.
+		for dir := filepath.Dir(fullPath); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,137 @@
+package hfget
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxThrottledRead caps the size of a single read through a rate limiter so
+// that throughput stays smooth instead of arriving in large bursts.
+const maxThrottledRead = 32 * 1024
+
+// RateWindow overrides the download rate limit during a daily time window.
+// Start and End are offsets from local midnight; a window whose End is before
+// its Start wraps past midnight (e.g. 22:00-06:00). A BytesPerSec of zero or
+// less means unlimited.
+type RateWindow struct {
+	Start       time.Duration
+	End         time.Duration
+	BytesPerSec int64
+}
+
+func (w RateWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// rateLimiter is a token bucket shared by every reader it throttles. The
+// bucket holds at most one second worth of tokens.
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     int64
+	schedule []RateWindow
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+func newRateLimiter(bytesPerSec int64, schedule []RateWindow) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSec, schedule: schedule, now: time.Now}
+}
+
+// currentRate returns the limit in effect at t; the first matching schedule
+// window wins over the default rate.
+func (l *rateLimiter) currentRate(t time.Time) int64 {
+	for _, w := range l.schedule {
+		if w.contains(t) {
+			return w.BytesPerSec
+		}
+	}
+	return l.rate
+}
+
+// wait blocks until n bytes may pass through the limiter or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.now()
+	rate := l.currentRate(now)
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		l.mu.Unlock()
+		return nil
+	}
+	if l.last.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		if l.tokens > float64(rate) {
+			l.tokens = float64(rate)
+		}
+	}
+	l.last = now
+	// Reserve the tokens up front; a negative balance is the debt this
+	// caller has to sleep off, which keeps concurrent readers fair.
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledReader passes reads through one or more rate limiters.
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		for _, l := range tr.limiters {
+			if werr := l.wait(tr.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	return n, err
+}
+
+// throttle wraps r with the Downloader's shared limiter and, if configured,
+// a fresh per-connection limiter. It returns r unchanged when no limit is set.
+func (d *Downloader) throttle(ctx context.Context, r io.Reader) io.Reader {
+	var limiters []*rateLimiter
+	if d.limiter != nil {
+		limiters = append(limiters, d.limiter)
+	}
+	if d.connRateLimit > 0 {
+		limiters = append(limiters, newRateLimiter(d.connRateLimit, nil))
+	}
+	if len(limiters) == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiters: limiters}
+}
@@ -0,0 +1,125 @@
+package hfget
+
+import "fmt"
+
+// PlanReason explains why BuildPlan put a file in a particular list of a
+// DownloadPlan.
+type PlanReason int
+
+const (
+	// ReasonUnknown is the zero value. BuildPlan never sets it, and ReadPlan
+	// rejects a plan that contains it, e.g. because a reason was left out.
+	ReasonUnknown PlanReason = iota
+	// ReasonMissing means the file does not exist locally.
+	ReasonMissing
+	// ReasonSizeMismatch means the local file has a different size.
+	ReasonSizeMismatch
+	// ReasonChecksumMismatch means the local file's SHA256 differs from the LFS oid.
+	ReasonChecksumMismatch
+	// ReasonUnreadable means the local file exists but could not be checked.
+	ReasonUnreadable
+	// ReasonForced means the download was requested regardless of local state.
+	ReasonForced
+	// ReasonLocallyModified means the file was edited since the last sync;
+	// see DownloadPlan.FilesConflicted.
+	ReasonLocallyModified
+	// ReasonUpToDate means the local file matches the repository.
+	ReasonUpToDate
+	// ReasonFiltered means the file was excluded by the include/exclude patterns.
+	ReasonFiltered
+	// ReasonRejected means the file failed a safety check and will not be written.
+	ReasonRejected
+	// ReasonSizeLimit means the file is outside the minimum or maximum file size.
+	ReasonSizeLimit
+	// ReasonOverBudget means the file did not fit in the download budget.
+	ReasonOverBudget
+	// ReasonDuplicateFormat means the same weights are downloaded in a
+	// preferred format; see WithFormatPreference.
+	ReasonDuplicateFormat
+)
+
+var planReasonNames = map[PlanReason]string{
+	ReasonUnknown:          "unknown",
+	ReasonMissing:          "missing",
+	ReasonSizeMismatch:     "size-mismatch",
+	ReasonChecksumMismatch: "checksum-mismatch",
+	ReasonUnreadable:       "unreadable",
+	ReasonForced:           "forced",
+	ReasonLocallyModified:  "locally-modified",
+	ReasonUpToDate:         "up-to-date",
+	ReasonFiltered:         "filtered",
+	ReasonRejected:         "rejected",
+	ReasonSizeLimit:        "size-limit",
+	ReasonOverBudget:       "over-budget",
+	ReasonDuplicateFormat:  "duplicate-format",
+}
+
+func (r PlanReason) String() string {
+	if name, ok := planReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("PlanReason(%d)", int(r))
+}
+
+// MarshalText encodes the reason by name.
+func (r PlanReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a reason name written by MarshalText. "unknown" is
+// rejected like any other name that is not a valid reason.
+func (r *PlanReason) UnmarshalText(text []byte) error {
+	for reason, name := range planReasonNames {
+		if string(text) == name && reason != ReasonUnknown {
+			*r = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown plan reason %q", text)
+}
+
+// VerificationMethod records how a local file was checked against the
+// repository.
+type VerificationMethod int
+
+const (
+	// VerifyNone means the file was not verified.
+	VerifyNone VerificationMethod = iota
+	// VerifySize means only the file size was compared, either because the
+	// file is not stored in LFS or because checksums were disabled.
+	VerifySize
+	// VerifySHA256 means the local file was hashed and matched the LFS oid.
+	VerifySHA256
+	// VerifyStreamedSHA256 means the file was hashed while it was downloaded.
+	VerifyStreamedSHA256
+)
+
+var verificationMethodNames = map[VerificationMethod]string{
+	VerifyNone:           "none",
+	VerifySize:           "size",
+	VerifySHA256:         "sha256",
+	VerifyStreamedSHA256: "streamed-sha256",
+}
+
+func (m VerificationMethod) String() string {
+	if name, ok := verificationMethodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("VerificationMethod(%d)", int(m))
+}
+
+// MarshalText encodes the method by name.
+func (m VerificationMethod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a method name written by MarshalText.
+func (m *VerificationMethod) UnmarshalText(text []byte) error {
+	for method, name := range verificationMethodNames {
+		if string(text) == name {
+			*m = method
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown verification method %q", text)
+}
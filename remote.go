@@ -0,0 +1,144 @@
+package hfget
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// remoteFile reads parts of a repository file with HTTP Range requests, so
+// that headers can be inspected without downloading the whole file.
+type remoteFile struct {
+	d    *Downloader
+	path string
+	url  string
+	size int64
+}
+
+// openRemote resolves the download URL of file.
+func (d *Downloader) openRemote(ctx context.Context, file HFFile) (*remoteFile, error) {
+	url, err := d.resolveDownloadURL(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", file.Path, err)
+	}
+	return &remoteFile{d: d, path: file.Path, url: url, size: file.Size}, nil
+}
+
+// readRange returns up to n bytes starting at off; fewer at the end of the
+// file. A server that ignores the Range header still works, at the cost of
+// reading the skipped bytes.
+func (r *remoteFile) readRange(ctx context.Context, off, n int64) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	if r.d.authToken != "" {
+		req.Header.Add("Authorization", "Bearer "+r.d.authToken)
+	}
+	resp, err := r.d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed for %s: %w", r.path, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", r.path, err)
+		}
+	default:
+		if err := handleAPIError(resp, r.url); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unexpected status code %d for ranged request to %s", resp.StatusCode, r.path)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", r.path, err)
+	}
+	return data, nil
+}
+
+const (
+	// remoteReaderChunk is the first Range a remoteReader requests; each
+	// further request doubles, up to remoteReaderMaxChunk.
+	remoteReaderChunk    = 256 << 10
+	remoteReaderMaxChunk = 16 << 20
+)
+
+// remoteReader reads a remoteFile sequentially from the start, for headers
+// whose length is only known once they are parsed. Ranges grow as reading
+// continues, so a small header takes one request and a large one a few.
+type remoteReader struct {
+	ctx   context.Context
+	f     *remoteFile
+	buf   []byte
+	off   int64 // File offset just past buf
+	chunk int64
+	limit int64 // Bytes that may be read in total
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.off >= r.f.size {
+			return 0, io.EOF
+		}
+		if r.off >= r.limit {
+			return 0, fmt.Errorf("header is larger than %d bytes", r.limit)
+		}
+		if r.chunk == 0 {
+			r.chunk = remoteReaderChunk
+		}
+		data, err := r.f.readRange(r.ctx, r.off, min(r.chunk, r.f.size-r.off, r.limit-r.off))
+		if err != nil {
+			return 0, err
+		}
+		if len(data) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.buf = data
+		r.off += int64(len(data))
+		r.chunk = min(r.chunk*2, remoteReaderMaxChunk)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// inspectEach calls read for every file, d.numConnections at a time. It
+// returns the results in file order, leaving out failures, which are
+// returned prefixed with the file's path.
+func inspectEach[T any](d *Downloader, files []HFFile, read func(HFFile) (*T, error)) ([]T, []error) {
+	results := make([]*T, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, max(d.numConnections, 1))
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = read(f)
+		}()
+	}
+	wg.Wait()
+
+	var ok []T
+	var failed []error
+	for i, r := range results {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", files[i].Path, errs[i]))
+			continue
+		}
+		ok = append(ok, *r)
+	}
+	return ok, failed
+}
@@ -0,0 +1,265 @@
+package hfget
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	pathpkg "path"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxSafetensorsHeader is the largest header accepted, matching the
+	// limit of the reference implementation.
+	maxSafetensorsHeader = 100 << 20
+	// safetensorsPrefetch is how much of a file the first Range request
+	// reads. It holds the whole header of all but the largest shards, so
+	// most files need a single request.
+	safetensorsPrefetch = 256 << 10
+)
+
+// SafetensorsTensor describes one tensor in a safetensors header. Its data
+// lies at DataOffsets, relative to the end of the header.
+type SafetensorsTensor struct {
+	Name        string   `json:"name"`
+	DType       string   `json:"dtype"`
+	Shape       []int64  `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// Params returns the number of elements in the tensor.
+func (t SafetensorsTensor) Params() int64 {
+	n := int64(1)
+	for _, dim := range t.Shape {
+		n *= dim
+	}
+	return n
+}
+
+// SafetensorsHeader is the parsed header of a safetensors file.
+type SafetensorsHeader struct {
+	Path       string              `json:"path"`
+	Size       int64               `json:"size"`       // Size of the whole file
+	HeaderSize int64               `json:"headerSize"` // Length of the JSON header
+	Metadata   map[string]string   `json:"metadata,omitempty"`
+	Tensors    []SafetensorsTensor `json:"tensors"` // In data order
+}
+
+// Params returns the number of elements in all tensors.
+func (h SafetensorsHeader) Params() int64 {
+	var n int64
+	for _, t := range h.Tensors {
+		n += t.Params()
+	}
+	return n
+}
+
+// TensorBytes returns the size of the tensor data the header describes.
+func (h SafetensorsHeader) TensorBytes() int64 {
+	var n int64
+	for _, t := range h.Tensors {
+		n += t.DataOffsets[1] - t.DataOffsets[0]
+	}
+	return n
+}
+
+// DTypes returns the number of parameters stored in each dtype.
+func (h SafetensorsHeader) DTypes() map[string]int64 {
+	dtypes := make(map[string]int64)
+	for _, t := range h.Tensors {
+		dtypes[t.DType] += t.Params()
+	}
+	return dtypes
+}
+
+// ReadSafetensorsHeader reads and parses the header at the start of a
+// safetensors file.
+func ReadSafetensorsHeader(r io.Reader) (*SafetensorsHeader, error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading header length: %w", err)
+	}
+	n, err := safetensorsHeaderLength(prefix[:])
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading %d-byte header: %w", n, err)
+	}
+	return decodeSafetensorsHeader(data)
+}
+
+// safetensorsHeaderLength decodes the little-endian length that starts a
+// safetensors file.
+func safetensorsHeaderLength(prefix []byte) (int64, error) {
+	n := binary.LittleEndian.Uint64(prefix)
+	if n == 0 || n > maxSafetensorsHeader {
+		return 0, fmt.Errorf("invalid header length %d: not a safetensors file", n)
+	}
+	return int64(n), nil
+}
+
+// decodeSafetensorsHeader parses the JSON header of a safetensors file.
+func decodeSafetensorsHeader(data []byte) (*SafetensorsHeader, error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	h := &SafetensorsHeader{HeaderSize: int64(len(data))}
+	for name, raw := range entries {
+		if name == "__metadata__" {
+			if err := json.Unmarshal(raw, &h.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid __metadata__: %w", err)
+			}
+			continue
+		}
+		t := SafetensorsTensor{Name: name}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, fmt.Errorf("invalid entry for tensor %s: %w", name, err)
+		}
+		t.Name = name
+		if t.DType == "" || t.DataOffsets[0] < 0 || t.DataOffsets[1] < t.DataOffsets[0] {
+			return nil, fmt.Errorf("invalid entry for tensor %s: dtype %q, offsets %v", name, t.DType, t.DataOffsets)
+		}
+		h.Tensors = append(h.Tensors, t)
+	}
+	sort.Slice(h.Tensors, func(i, j int) bool {
+		if h.Tensors[i].DataOffsets[0] != h.Tensors[j].DataOffsets[0] {
+			return h.Tensors[i].DataOffsets[0] < h.Tensors[j].DataOffsets[0]
+		}
+		return h.Tensors[i].Name < h.Tensors[j].Name
+	})
+	return h, nil
+}
+
+// safetensorsIndex is a model.safetensors.index.json file.
+type safetensorsIndex struct {
+	Metadata  map[string]any    `json:"metadata"`
+	WeightMap map[string]string `json:"weight_map"` // Tensor name to shard file
+}
+
+// shards returns the files the index maps tensors to, sorted.
+func (idx *safetensorsIndex) shards() []string {
+	seen := make(map[string]bool)
+	var shards []string
+	for _, shard := range idx.WeightMap {
+		if !seen[shard] {
+			seen[shard] = true
+			shards = append(shards, shard)
+		}
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+// isSafetensorsIndex reports whether path names a shard index, such as
+// model.safetensors.index.json.
+func isSafetensorsIndex(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".safetensors.index.json")
+}
+
+// InspectSafetensors reads the headers of the repository's safetensors files
+// with Range requests, without downloading the weights. Files the include
+// and exclude patterns would not download are skipped. Shard indexes are read
+// too, and shards an index names that the repository lacks are reported.
+//
+// Headers that could be read are returned even when others fail; the
+// failures are joined in the error.
+func (d *Downloader) InspectSafetensors(ctx context.Context, repoInfo *RepoInfo) ([]SafetensorsHeader, error) {
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	var files, indexes []HFFile
+	present := make(map[string]bool)
+	for _, f := range d.flattenTree(repoInfo.Siblings) {
+		present[f.Path] = true
+		switch {
+		case !d.shouldDownload(f.Path):
+		case isSafetensorsIndex(f.Path):
+			indexes = append(indexes, f)
+		case strings.EqualFold(pathpkg.Ext(f.Path), ".safetensors"):
+			files = append(files, f)
+		}
+	}
+
+	var errs []error
+	for _, f := range indexes {
+		idx, err := d.fetchSafetensorsIndex(ctx, f)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+			continue
+		}
+		for _, shard := range idx.shards() {
+			if p := pathpkg.Join(pathpkg.Dir(f.Path), shard); !present[p] {
+				errs = append(errs, fmt.Errorf("%s: shard %s is not in the repository", f.Path, p))
+			}
+		}
+	}
+
+	headers, failed := inspectEach(d, files, func(f HFFile) (*SafetensorsHeader, error) {
+		d.logger.Printf("Reading safetensors header of %s", f.Path)
+		return d.fetchSafetensorsHeader(ctx, f)
+	})
+	return headers, errors.Join(append(errs, failed...)...)
+}
+
+// fetchSafetensorsHeader reads the header of a remote safetensors file,
+// issuing a second Range request only when it does not fit the prefetch.
+func (d *Downloader) fetchSafetensorsHeader(ctx context.Context, file HFFile) (*SafetensorsHeader, error) {
+	rf, err := d.openRemote(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := rf.readRange(ctx, 0, min(safetensorsPrefetch, file.Size))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("file is too short (%d bytes) to be a safetensors file", len(data))
+	}
+	n, err := safetensorsHeaderLength(data[:8])
+	if err != nil {
+		return nil, err
+	}
+	if 8+n > file.Size {
+		return nil, fmt.Errorf("header length %d exceeds the file size %d", n, file.Size)
+	}
+	if have := int64(len(data)); have < 8+n {
+		rest, err := rf.readRange(ctx, have, 8+n-have)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, rest...)
+	}
+	if int64(len(data)) < 8+n {
+		return nil, fmt.Errorf("header truncated at %d of %d bytes", len(data)-8, n)
+	}
+	h, err := decodeSafetensorsHeader(data[8 : 8+n])
+	if err != nil {
+		return nil, err
+	}
+	h.Path, h.Size = file.Path, file.Size
+	return h, nil
+}
+
+// fetchSafetensorsIndex downloads and parses a shard index.
+func (d *Downloader) fetchSafetensorsIndex(ctx context.Context, file HFFile) (*safetensorsIndex, error) {
+	rf, err := d.openRemote(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := rf.readRange(ctx, 0, file.Size)
+	if err != nil {
+		return nil, err
+	}
+	var idx safetensorsIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("invalid index: %w", err)
+	}
+	return &idx, nil
+}
@@ -0,0 +1,101 @@
+package hfget
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateFileName = "state.json"
+
+// syncState records what hfget last wrote into a model directory so that
+// later runs can tell local edits apart from partial or corrupt downloads.
+type syncState struct {
+	Repo     string                `json:"repo"`
+	Revision string                `json:"revision"`
+	Commit   string                `json:"commit,omitempty"` // The commit Revision resolved to
+	LastSync time.Time             `json:"lastSync"`
+	Files    map[string]fileRecord `json:"files"`
+}
+
+// fileRecord is the remote oid of a file and the local size and modification
+// time observed right after hfget wrote or verified it.
+type fileRecord struct {
+	Oid     string    `json:"oid"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// loadSyncState reads the state for modelPath. A missing or unreadable state
+// file yields an empty state, which simply disables conflict detection.
+func loadSyncState(modelPath string) *syncState {
+	state := &syncState{Files: make(map[string]fileRecord)}
+	data, err := os.ReadFile(filepath.Join(modelPath, metaDirName, stateFileName))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil || state.Files == nil {
+		return &syncState{Files: make(map[string]fileRecord)}
+	}
+	return state
+}
+
+// save writes the state atomically via a temporary file and rename.
+func (s *syncState) save(modelPath string) error {
+	dir := filepath.Join(modelPath, metaDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, stateFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, stateFileName))
+}
+
+// record stores the current local stat of fullPath against the remote file.
+func (s *syncState) record(file HFFile, fullPath string) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return
+	}
+	s.Files[file.Path] = fileRecord{Oid: remoteOid(file), Size: info.Size(), ModTime: info.ModTime()}
+}
+
+// modifiedSinceSync reports whether the local file at fullPath has changed
+// since hfget last recorded it. Files without a record are never reported.
+func (s *syncState) modifiedSinceSync(file HFFile, fullPath string) (os.FileInfo, bool) {
+	rec, ok := s.Files[file.Path]
+	if !ok {
+		return nil, false
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, false
+	}
+	return info, info.Size() != rec.Size || !info.ModTime().Equal(rec.ModTime)
+}
+
+// current reports whether the record for file matches its remote oid and
+// the local stat of fullPath.
+func (s *syncState) current(file HFFile, fullPath string) bool {
+	rec, ok := s.Files[file.Path]
+	if !ok || rec.Oid != remoteOid(file) {
+		return false
+	}
+	_, modified := s.modifiedSinceSync(file, fullPath)
+	return !modified
+}
+
+// remoteOid returns the content identifier the Hub reports for file.
+func remoteOid(file HFFile) string {
+	if file.LFS.Oid != "" {
+		return file.LFS.Oid
+	}
+	return file.Oid
+}
@@ -0,0 +1,213 @@
+package hfget
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// safetensorsDTypeSizes is the size in bytes of one element of each dtype.
+// Tensors with other dtypes are checked against the file size only.
+var safetensorsDTypeSizes = map[string]int64{
+	"BOOL": 1, "U8": 1, "I8": 1, "F8_E4M3": 1, "F8_E5M2": 1,
+	"U16": 2, "I16": 2, "F16": 2, "BF16": 2,
+	"U32": 4, "I32": 4, "F32": 4,
+	"U64": 8, "I64": 8, "F64": 8,
+}
+
+// StructureIssue is a problem ValidateStructure found in a local checkpoint.
+type StructureIssue struct {
+	Path   string `json:"path"` // Relative to the validated directory
+	Detail string `json:"detail"`
+}
+
+// StructureReport is the result of ValidateStructure.
+type StructureReport struct {
+	Dir     string           `json:"dir"`
+	Checked []string         `json:"checked"` // Safetensors files and shard indexes that were read
+	Issues  []StructureIssue `json:"issues,omitempty"`
+}
+
+// OK reports whether no issues were found.
+func (r *StructureReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *StructureReport) addIssue(path, format string, args ...any) {
+	r.Issues = append(r.Issues, StructureIssue{Path: path, Detail: fmt.Sprintf(format, args...)})
+}
+
+// ValidateStructure checks the repository's local copy with
+// ValidateStructure; see ModelPath.
+func (d *Downloader) ValidateStructure(ctx context.Context) (*StructureReport, error) {
+	return ValidateStructure(ctx, d.ModelPath())
+}
+
+// ModelPath returns the local directory the repository is downloaded to.
+func (d *Downloader) ModelPath() string {
+	return d.getModelPath(d.repoName)
+}
+
+// ValidateStructure checks that the safetensors checkpoints under dir are
+// complete and readable, which a matching checksum alone does not show:
+// every shard a *.safetensors.index.json names must exist and hold the
+// tensors the index maps to it, and every safetensors header must parse
+// with each tensor's data inside the file and sized for its dtype and
+// shape. Problems are returned as issues in the report; the error is for
+// failures to read dir itself.
+func ValidateStructure(ctx context.Context, dir string) (*StructureReport, error) {
+	report := &StructureReport{Dir: dir}
+	var files, indexes []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == metaDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case isSafetensorsIndex(rel):
+			indexes = append(indexes, rel)
+		case strings.EqualFold(pathpkg.Ext(rel), ".safetensors"):
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	sort.Strings(indexes)
+
+	headers := make(map[string]*SafetensorsHeader)
+	for _, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Checked = append(report.Checked, rel)
+		h, err := validateSafetensorsFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			report.addIssue(rel, "%v", err)
+			continue
+		}
+		for _, problem := range h.problems() {
+			report.addIssue(rel, "%s", problem)
+		}
+		headers[rel] = h
+	}
+
+	for _, rel := range indexes {
+		report.Checked = append(report.Checked, rel)
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			report.addIssue(rel, "%v", err)
+			continue
+		}
+		var idx safetensorsIndex
+		if err := json.Unmarshal(data, &idx); err != nil {
+			report.addIssue(rel, "invalid index: %v", err)
+			continue
+		}
+		validateIndex(report, rel, &idx, headers)
+	}
+	return report, nil
+}
+
+// validateSafetensorsFile reads the header of a local safetensors file.
+func validateSafetensorsFile(path string) (*SafetensorsHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadSafetensorsHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	h.Size = info.Size()
+	return h, nil
+}
+
+// problems lists the tensors of h whose data does not fit the file, does
+// not match their dtype and shape, or overlaps the previous tensor.
+func (h SafetensorsHeader) problems() []string {
+	var problems []string
+	dataSize := h.Size - 8 - h.HeaderSize
+	var prevEnd int64
+	var prevName string
+	for _, t := range h.Tensors {
+		start, end := t.DataOffsets[0], t.DataOffsets[1]
+		if end > dataSize {
+			problems = append(problems, fmt.Sprintf("tensor %s ends at byte %d of a %d-byte data section (file truncated?)", t.Name, end, dataSize))
+		}
+		if size, ok := safetensorsDTypeSizes[t.DType]; ok && t.Params()*size != end-start {
+			problems = append(problems, fmt.Sprintf("tensor %s is %d bytes, but %s%v needs %d", t.Name, end-start, t.DType, t.Shape, t.Params()*size))
+		}
+		if start < prevEnd {
+			problems = append(problems, fmt.Sprintf("tensor %s overlaps %s", t.Name, prevName))
+		}
+		if end > prevEnd {
+			prevEnd, prevName = end, t.Name
+		}
+	}
+	return problems
+}
+
+// validateIndex checks that every shard idx names was read and holds the
+// tensors the index maps to it.
+func validateIndex(report *StructureReport, rel string, idx *safetensorsIndex, headers map[string]*SafetensorsHeader) {
+	if len(idx.WeightMap) == 0 {
+		report.addIssue(rel, "index has an empty weight_map")
+		return
+	}
+	tensors := make(map[string]map[string]bool)
+	for _, shard := range idx.shards() {
+		shardPath := pathpkg.Join(pathpkg.Dir(rel), shard)
+		h, ok := headers[shardPath]
+		if !ok {
+			// A shard that exists but failed to parse was already reported.
+			if !slices.Contains(report.Checked, shardPath) {
+				report.addIssue(rel, "shard %s is missing", shardPath)
+			}
+			continue
+		}
+		names := make(map[string]bool, len(h.Tensors))
+		for _, t := range h.Tensors {
+			names[t.Name] = true
+		}
+		tensors[shardPath] = names
+	}
+
+	var missing []string
+	for name, shard := range idx.WeightMap {
+		if names, ok := tensors[pathpkg.Join(pathpkg.Dir(rel), shard)]; ok && !names[name] {
+			missing = append(missing, fmt.Sprintf("%s (in %s)", name, shard))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		if len(missing) > 5 {
+			missing = append(missing[:5], fmt.Sprintf("and %d more", len(missing)-5))
+		}
+		report.addIssue(rel, "tensors missing from their shards: %s", strings.Join(missing, ", "))
+	}
+}
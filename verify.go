@@ -0,0 +1,255 @@
+package hfget
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// lockfileVersion is the format version written into lockfiles.
+const lockfileVersion = 1
+
+// ErrVerification is matched by errors.Is for a *VerificationError.
+var ErrVerification = errors.New("local files do not match the repository")
+
+// ErrChecksumMismatch and ErrSizeMismatch are wrapped by the errors for a
+// file whose content does not match the repository.
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrSizeMismatch     = errors.New("size mismatch")
+)
+
+// VerificationError reports the files Verify found missing, different or
+// unexpected.
+type VerificationError struct {
+	Failed int // Files whose status is not FileOK
+	Total  int
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%d of %d file(s) failed verification", e.Failed, e.Total)
+}
+
+// Is lets errors.Is(err, ErrVerification) match.
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrVerification
+}
+
+// FileStatus is the outcome of checking one local file in Verify.
+type FileStatus int
+
+const (
+	// FileOK means the local file matches the expected size and checksum.
+	FileOK FileStatus = iota
+	// FileMissing means the file does not exist locally.
+	FileMissing
+	// FileSizeMismatch means the local file has a different size.
+	FileSizeMismatch
+	// FileChecksumMismatch means the local file's SHA256 differs from the LFS oid.
+	FileChecksumMismatch
+	// FileUnreadable means the local file exists but could not be checked.
+	FileUnreadable
+	// FileExtra means the local file is not in the repository or lockfile.
+	FileExtra
+)
+
+var fileStatusNames = map[FileStatus]string{
+	FileOK:               "ok",
+	FileMissing:          "missing",
+	FileSizeMismatch:     "size-mismatch",
+	FileChecksumMismatch: "checksum-mismatch",
+	FileUnreadable:       "unreadable",
+	FileExtra:            "extra",
+}
+
+func (s FileStatus) String() string {
+	if name, ok := fileStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("FileStatus(%d)", int(s))
+}
+
+// MarshalText encodes the status by name.
+func (s FileStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status name written by MarshalText.
+func (s *FileStatus) UnmarshalText(text []byte) error {
+	for status, name := range fileStatusNames {
+		if string(text) == name {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown file status %q", text)
+}
+
+// fileStatusOf maps the reason verifyLocalFile gives to a FileStatus.
+func fileStatusOf(reason PlanReason) FileStatus {
+	switch reason {
+	case ReasonUpToDate:
+		return FileOK
+	case ReasonMissing:
+		return FileMissing
+	case ReasonSizeMismatch:
+		return FileSizeMismatch
+	case ReasonChecksumMismatch:
+		return FileChecksumMismatch
+	default:
+		return FileUnreadable
+	}
+}
+
+// FileCheck is the result of checking one file in Verify.
+type FileCheck struct {
+	Path     string             `json:"path"`
+	Size     int64              `json:"size"` // Expected size, or the local size of an extra file
+	Status   FileStatus         `json:"status"`
+	Verified VerificationMethod `json:"verified,omitempty"`
+	Detail   string             `json:"detail,omitempty"`
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	Repo      string      `json:"repo"`
+	Revision  string      `json:"revision,omitempty"` // The commit the expected files were read at
+	ModelPath string      `json:"modelPath"`
+	Files     []FileCheck `json:"files"`
+}
+
+// Counts returns the number of files with each status.
+func (r *VerifyReport) Counts() map[FileStatus]int {
+	counts := make(map[FileStatus]int)
+	for _, f := range r.Files {
+		counts[f.Status]++
+	}
+	return counts
+}
+
+// Err returns a *VerificationError if any file is not FileOK. Extra files
+// count as failures unless allowExtra is set.
+func (r *VerifyReport) Err(allowExtra bool) error {
+	var failed int
+	for _, f := range r.Files {
+		if f.Status != FileOK && (f.Status != FileExtra || !allowExtra) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return &VerificationError{Failed: failed, Total: len(r.Files)}
+	}
+	return nil
+}
+
+// Verify checks the local copy of the repository against repoInfo without
+// downloading anything: every file selected by the include/exclude filters
+// must exist with the expected size and, for LFS files, SHA256. Local files
+// the filters would select but repoInfo does not list are reported as
+// FileExtra. Progress is sent as for BuildPlan. The error is for failures
+// to scan the directory or a cancelled ctx; mismatches are in the report.
+func (d *Downloader) Verify(ctx context.Context, repoInfo *RepoInfo) (*VerifyReport, error) {
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Repo: repoInfo.ID, Revision: repoInfo.SHA, ModelPath: d.getModelPath(repoInfo.ID)}
+	for _, file := range d.flattenTree(repoInfo.Siblings) {
+		if !d.shouldDownload(file.Path) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		check := FileCheck{Path: file.Path, Size: file.Size}
+		fullPath, err := confinedPath(report.ModelPath, file.Path)
+		if err != nil {
+			check.Status, check.Detail = FileUnreadable, err.Error()
+			report.Files = append(report.Files, check)
+			continue
+		}
+		reason, method, err := d.verifyLocalFile(ctx, fullPath, file, false)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		check.Status, check.Verified = fileStatusOf(reason), method
+		if err != nil && check.Status != FileMissing {
+			check.Detail = err.Error()
+		}
+		d.sendProgress(ctx, file.Path, ProgressStateVerified, file.Size, file.Size, check.Status.String())
+		report.Files = append(report.Files, check)
+	}
+
+	// findStaleFiles already knows which local files belong to the repository.
+	var extra DownloadPlan
+	if err := d.findStaleFiles(ctx, report.ModelPath, repoInfo.Siblings, &extra); err != nil {
+		return nil, err
+	}
+	for _, f := range extra.FilesToDelete {
+		report.Files = append(report.Files, FileCheck{Path: f.Path, Size: f.Size, Status: FileExtra})
+	}
+	return report, nil
+}
+
+// Lockfile pins the files of a repository at one revision so that a local
+// copy can be verified later without contacting the Hub.
+type Lockfile struct {
+	Version   int       `json:"version"`
+	Repo      string    `json:"repo"`
+	Revision  string    `json:"revision"` // The commit the files were read at
+	IsDataset bool      `json:"isDataset,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Files     []HFFile  `json:"files"`
+}
+
+// NewLockfile records the files of repoInfo selected by the include/exclude
+// filters.
+func (d *Downloader) NewLockfile(repoInfo *RepoInfo) (*Lockfile, error) {
+	if err := d.compileFilters(); err != nil {
+		return nil, err
+	}
+	lock := &Lockfile{
+		Version:   lockfileVersion,
+		Repo:      repoInfo.ID,
+		Revision:  repoInfo.SHA,
+		IsDataset: d.isDataset,
+		CreatedAt: time.Now().UTC(),
+		Files:     []HFFile{},
+	}
+	for _, f := range d.flattenTree(repoInfo.Siblings) {
+		if d.shouldDownload(f.Path) {
+			f.LastCommit = nil
+			lock.Files = append(lock.Files, f)
+		}
+	}
+	return lock, nil
+}
+
+// RepoInfo returns the locked files as a RepoInfo for Verify.
+func (l *Lockfile) RepoInfo() *RepoInfo {
+	return &RepoInfo{ID: l.Repo, SHA: l.Revision, Siblings: l.Files}
+}
+
+// WriteJSON writes the lockfile as indented JSON.
+func (l *Lockfile) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// ReadLockfile reads a lockfile written by WriteJSON.
+func ReadLockfile(r io.Reader) (*Lockfile, error) {
+	var lock Lockfile
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return nil, fmt.Errorf("failed to decode lockfile: %w", err)
+	}
+	if lock.Version != lockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d (want %d)", lock.Version, lockfileVersion)
+	}
+	if lock.Repo == "" {
+		return nil, errors.New("lockfile is missing its repository")
+	}
+	return &lock, nil
+}
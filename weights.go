@@ -0,0 +1,152 @@
+package hfget
+
+import (
+	"fmt"
+	pathpkg "path"
+	"strings"
+)
+
+// WeightFormat is a serialization format for model weights.
+type WeightFormat int
+
+const (
+	// FormatSafetensors is *.safetensors.
+	FormatSafetensors WeightFormat = iota
+	// FormatPyTorch is pickled PyTorch weights: pytorch_model*.bin,
+	// adapter_model.bin and model or consolidated *.pt/*.pth files.
+	FormatPyTorch
+	// FormatONNX is *.onnx with any external data files.
+	FormatONNX
+	// FormatTensorFlow is Keras/TensorFlow *.h5.
+	FormatTensorFlow
+	// FormatFlax is Flax *.msgpack.
+	FormatFlax
+)
+
+// defaultFormatPreference is used for formats a preference list leaves out.
+var defaultFormatPreference = []WeightFormat{FormatSafetensors, FormatPyTorch, FormatONNX, FormatTensorFlow, FormatFlax}
+
+var weightFormatNames = map[WeightFormat]string{
+	FormatSafetensors: "safetensors",
+	FormatPyTorch:     "pytorch",
+	FormatONNX:        "onnx",
+	FormatTensorFlow:  "tensorflow",
+	FormatFlax:        "flax",
+}
+
+func (f WeightFormat) String() string {
+	if name, ok := weightFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("WeightFormat(%d)", int(f))
+}
+
+// ParseWeightFormat converts "safetensors", "pytorch", "onnx", "tensorflow"
+// or "flax" into a WeightFormat.
+func ParseWeightFormat(s string) (WeightFormat, error) {
+	for f, name := range weightFormatNames {
+		if strings.EqualFold(s, name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weight format %q: want safetensors, pytorch, onnx, tensorflow or flax", s)
+}
+
+// formatDirs are directory names that hold an alternative export of the
+// weights in their parent directory, such as the onnx/ folder of a
+// transformers.js-ready repository.
+var formatDirs = map[string]bool{"onnx": true, "tf": true, "flax": true}
+
+// WeightFormatOf classifies a repository path as a weight file (or a shard
+// index of one) and reports false for anything else.
+func WeightFormatOf(path string) (WeightFormat, bool) {
+	base := strings.ToLower(pathpkg.Base(path))
+	base = strings.TrimSuffix(base, ".index.json")
+	switch ext := pathpkg.Ext(base); {
+	case ext == ".safetensors":
+		return FormatSafetensors, true
+	case ext == ".bin" && (strings.Contains(base, "pytorch_model") || strings.HasPrefix(base, "adapter_model")),
+		(ext == ".pt" || ext == ".pth") && (strings.Contains(base, "model") || strings.HasPrefix(base, "consolidated")):
+		return FormatPyTorch, true
+	case ext == ".onnx", ext == ".onnx_data", strings.HasSuffix(base, ".onnx.data"):
+		return FormatONNX, true
+	case ext == ".h5":
+		return FormatTensorFlow, true
+	case ext == ".msgpack":
+		return FormatFlax, true
+	}
+	return 0, false
+}
+
+// weightSet identifies one set of weights that a repository may ship in
+// several formats.
+type weightSet struct {
+	dir  string
+	stem string
+}
+
+// weightGroup returns the set of weights path belongs to. Format folders
+// such as onnx/ count as part of their parent, so that an ONNX export is
+// recognised as a duplicate of the weights beside it. Within a directory,
+// pytorch_model.bin, tf_model.h5, flax_model.msgpack and model.safetensors
+// (and their shards) are the same set, while e.g. adapter_model.bin only
+// duplicates adapter_model.safetensors.
+func weightGroup(path string, format WeightFormat) weightSet {
+	dir := pathpkg.Dir(path)
+	if formatDirs[strings.ToLower(pathpkg.Base(dir))] {
+		dir = pathpkg.Dir(dir)
+	}
+	if format == FormatONNX {
+		return weightSet{dir: dir, stem: "model"}
+	}
+	base := strings.TrimSuffix(strings.ToLower(pathpkg.Base(path)), ".index.json")
+	stem := ggufSplitPattern.ReplaceAllString(strings.TrimSuffix(base, pathpkg.Ext(base)), "")
+	if strings.HasPrefix(stem, "consolidated") {
+		return weightSet{dir: dir, stem: "model"}
+	}
+	for _, prefix := range []string{"pytorch_", "tf_", "flax_"} {
+		stem = strings.TrimPrefix(stem, prefix)
+	}
+	return weightSet{dir: dir, stem: stem}
+}
+
+// duplicateFormats finds weights that a directory holds in more than one
+// format and returns the files of every format except the most
+// preferred one present, keyed by path.
+func (d *Downloader) duplicateFormats(files []HFFile) map[string]bool {
+	rank := make(map[WeightFormat]int)
+	for _, f := range append(append([]WeightFormat{}, d.formatPreference...), defaultFormatPreference...) {
+		if _, ok := rank[f]; !ok {
+			rank[f] = len(rank)
+		}
+	}
+
+	formats := make(map[weightSet]map[WeightFormat]bool)
+	for _, f := range files {
+		if format, ok := WeightFormatOf(f.Path); ok {
+			group := weightGroup(f.Path, format)
+			if formats[group] == nil {
+				formats[group] = make(map[WeightFormat]bool)
+			}
+			formats[group][format] = true
+		}
+	}
+	preferred := make(map[weightSet]WeightFormat)
+	for group, present := range formats {
+		first := true
+		for format := range present {
+			if first || rank[format] < rank[preferred[group]] {
+				preferred[group] = format
+				first = false
+			}
+		}
+	}
+
+	duplicates := make(map[string]bool)
+	for _, f := range files {
+		if format, ok := WeightFormatOf(f.Path); ok && format != preferred[weightGroup(f.Path, format)] {
+			duplicates[f.Path] = true
+		}
+	}
+	return duplicates
+}